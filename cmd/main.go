@@ -7,17 +7,24 @@ import (
 	"livon/internal/app/server"
 	"livon/internal/app/worker"
 	"livon/internal/config"
+	"livon/internal/core/contracts"
 	"livon/internal/core/services"
 	"livon/internal/platform/logger"
+	"livon/internal/platform/metrics"
 	"livon/internal/platform/telemetry"
+	"livon/internal/plugins/memory"
+	natsPlugin "livon/internal/plugins/nats"
 	"livon/internal/plugins/postgres"
 	redisPlugin "livon/internal/plugins/redis"
 	"livon/internal/plugins/twilio"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -30,19 +37,21 @@ func main() {
 	cfg := config.Load()
 
 	// Logger
-	log := logger.NewLogger(*cfg)
+	log, logLevels := logger.NewLogger(*cfg)
 	log.Info("starting application")
 
-	otelShutdown, err := telemetry.InitTelemetry(ctx, *cfg)
+	otelShutdown, metricsHandler, err := telemetry.InitTelemetry(ctx, *cfg)
 	if err != nil {
-		log.Error("failed to initialize telemetry", "err", err)
+		log.Error("failed to initialize telemetry", logger.Err(err))
+		otelShutdown = func(context.Context) error { return nil }
+		metricsHandler = http.NotFoundHandler()
 	}
 	defer func() {
 		log.Info("flushing telemetry...")
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Service.ShutdownTimeout)
 		defer cancel()
 		if err := otelShutdown(shutdownCtx); err != nil {
-			log.Error("telemetry shutdown failed", "err", err)
+			log.Error("telemetry shutdown failed", logger.Err(err))
 		}
 	}()
 
@@ -54,35 +63,202 @@ func main() {
 	}
 	log.Info("postgress connected")
 	var rdb *redis.Client
-	if rdb, err = redisPlugin.NewRedisClient(ctx, *cfg.Redis); err != nil {
-		log.Error("redis connection failed", "url", cfg.Redis.URL)
-		return
+	if cfg.Backend.State == "redis" || cfg.Backend.Queue == "redis" {
+		if rdb, err = redisPlugin.NewRedisClient(ctx, *cfg.Redis); err != nil {
+			log.Error("redis connection failed", "url", cfg.Redis.URL)
+			return
+		}
+		log.Info("redis connected")
+	}
+	var (
+		nc *nats.Conn
+		js jetstream.JetStream
+	)
+	if cfg.Backend.Queue == "nats" {
+		if nc, js, err = natsPlugin.NewNATSClient(*cfg.NATS); err != nil {
+			log.Error("nats connection failed", "url", cfg.NATS.URL)
+			return
+		}
+		log.Info("nats connected")
 	}
-	log.Info("redis connected")
 	// Adapters
 	userRepo := postgres.NewUserRepository(pdb)
 	convRepo := postgres.NewConversationRepo(pdb)
 	partRepo := postgres.NewParticipantRepo(pdb)
+	restRepo := postgres.NewRestrictionRepo(pdb)
+	accessRepo := postgres.NewAccessRepo(pdb)
+	blockRepo := postgres.NewBlockRepo(pdb)
 	msgRepo := postgres.NewMessageRepo(pdb)
-	presStore := redisPlugin.NewRedisPresenceStore(rdb)
-	msgQueue := redisPlugin.NewRedisMessageQueue(rdb)
+	var (
+		presStore   contracts.PresenceStore
+		bus         contracts.ClusterBus
+		resumeStore contracts.ResumeStore
+		leases      contracts.LeaseStore
+		msgQueue    contracts.MessageQueue
+	)
+	switch cfg.Backend.State {
+	case "redis":
+		presStore = redisPlugin.NewRedisPresenceStore(rdb)
+		bus = redisPlugin.NewRedisClusterBus(rdb)
+		resumeStore = redisPlugin.NewRedisResumeStore(rdb)
+		leases = redisPlugin.NewRedisLeaseStore(rdb)
+	case "memory":
+		// Single node: nothing is shared with other replicas
+		presStore = memory.NewMemoryPresenceStore()
+		bus = memory.NewMemoryClusterBus()
+		resumeStore = memory.NewMemoryResumeStore()
+		leases = memory.NewMemoryLeaseStore()
+	case "postgres":
+		presStore = postgres.NewPresenceStore(pdb)
+		bus = postgres.NewClusterBus(logger.Module(log, "postgres"), pdb)
+		resumeStore = postgres.NewResumeStore(pdb)
+		leases = postgres.NewLeaseStore(pdb)
+	default:
+		log.Error("unknown state backend", "backend", cfg.Backend.State)
+		return
+	}
+	switch cfg.Backend.Queue {
+	case "redis":
+		msgQueue = redisPlugin.NewRedisMessageQueue(logger.Module(log, "redis"), rdb, *cfg.Worker)
+	case "memory":
+		msgQueue = memory.NewMemoryMessageQueue(logger.Module(log, "memory"), *cfg.Worker)
+	case "nats":
+		if msgQueue, err = natsPlugin.NewNATSMessageQueue(ctx, logger.Module(log, "nats"), js, *cfg.Worker, *cfg.NATS); err != nil {
+			log.Error("nats stream setup failed", "stream", cfg.NATS.Stream, logger.Err(err))
+			return
+		}
+	case "postgres":
+		msgQueue = postgres.NewMessageQueue(logger.Module(log, "postgres"), pdb, *cfg.Worker)
+	default:
+		log.Error("unknown queue backend", "backend", cfg.Backend.Queue)
+		return
+	}
+	log.Info("backends selected", "state", cfg.Backend.State, "queue", cfg.Backend.Queue)
 
 	tw := twilio.NewTwilioClient(*cfg.Twilio)
 
 	// Core Services
 	hub := registry.NewRegistry()
-	txManager := services.NewTxManager(log, pdb)
-	userSvc := services.NewUserService(log, userRepo, tw)
-	sessSvc := services.NewSessionService(log, partRepo, txManager)
-	msgSvc := services.NewMessageService(log, msgQueue, hub, msgRepo, txManager)
+	txManager := services.NewTxManager(logger.Module(log, "tx"), pdb)
+	userSvc := services.NewUserService(logger.Module(log, "user"), userRepo, tw)
+	sessSvc := services.NewSessionService(logger.Module(log, "session"), partRepo, restRepo, resumeStore, txManager, *cfg.Session)
+	msgSvc := services.NewMessageService(logger.Module(log, "messages"), msgQueue, hub, bus, msgRepo, txManager, *cfg.Worker)
+
+	accessSvc := services.NewAccessService(logger.Module(log, "access"), accessRepo, convRepo, partRepo, txManager, *cfg.Invite)
 
-	tokenSvc := services.NewTokenService(log, cfg.SecretToken)
-	managerSvc := services.NewManagerService(log, convRepo, presStore, sessSvc, msgSvc, txManager)
+	blockSvc := services.NewBlockService(logger.Module(log, "block"), blockRepo, partRepo, bus)
+	hub.FilterDelivery(blockSvc.Hides)
 
-	wrkr := worker.NewConversationWorker(log, *msgQueue, msgSvc, cfg.Worker.MessageGroup)
-	hub.RunWorker(wrkr.Run)
+	limiter := services.NewRateLimiter(logger.Module(log, "ratelimit"), *cfg.RateLimit)
+
+	tokenSvc := services.NewTokenService(logger.Module(log, "token"), cfg.SecretToken)
+	managerSvc := services.NewManagerService(logger.Module(log, "manager"), convRepo, presStore, sessSvc, msgSvc, accessSvc, blockSvc, hub, bus, limiter, txManager)
+
+	adminSvc := services.NewAdminService(logger.Module(log, "admin"), convRepo, presStore, msgQueue, bus, hub, *cfg.Worker)
+
+	wrkr := worker.NewConversationWorker(logger.Module(log, "worker"), msgQueue, msgSvc, *cfg.Worker)
+	pool := worker.NewPool(logger.Module(log, "worker"), msgQueue, leases, wrkr, *cfg.Worker, uuid.NewString())
 
 	// Server
-	srv := server.NewServer(log, cfg.Service.Name, "8080", userSvc, tokenSvc, managerSvc, hub)
-	srv.Start()
+	srv := server.NewServer(log, *cfg.Service, "8080", *cfg.WebSocket, userSvc, tokenSvc, managerSvc, accessSvc, blockSvc, hub, pool)
+	srv.ExposeMetrics(metricsHandler)
+	if cfg.WebSocket.GlobalMaxHandshakes > 0 && cfg.Backend.State == "redis" {
+		srv.ShareHandshakeLimit(redisPlugin.NewRedisHandshakeGate(rdb, cfg.WebSocket.GlobalMaxHandshakes, cfg.WebSocket.HandshakeTTL))
+	}
+	if err := metrics.ObserveRegistry(func() (int, int) {
+		st := hub.Stats()
+		return st.Connections, len(st.Rooms)
+	}); err != nil {
+		log.Error("registry metrics registration failed", logger.Err(err))
+	}
+	if err := metrics.ObserveStreams(pool.Topics, func(ctx context.Context, topic string) (int64, int64, error) {
+		b, err := msgQueue.Backlog(ctx, topic, cfg.Worker.MessageGroup)
+		return b.Lag, b.Pending, err
+	}); err != nil {
+		log.Error("stream metrics registration failed", logger.Err(err))
+	}
+	srv.AddHealthCheck("postgres", pdb.PingContext)
+	if nc != nil {
+		srv.AddHealthCheck("nats", nc.FlushWithContext)
+	}
+	if rdb != nil {
+		srv.AddHealthCheck("redis", func(ctx context.Context) error { return rdb.Ping(ctx).Err() })
+	}
+	// Stopped by srv.Shutdown once the sockets are closed, not by the signal
+	go func() {
+		if err := pool.Run(context.WithoutCancel(ctx)); err != nil {
+			log.Error("worker pool failed", logger.Err(err))
+		}
+	}()
+	// Messages persisted by any replica reach this node's rooms
+	go func() {
+		if err := msgSvc.Run(ctx); err != nil {
+			log.Error("message subscription failed", logger.Err(err))
+		}
+	}()
+	// Admin commands from any replica are applied to this node's connections
+	go func() {
+		if err := adminSvc.Run(ctx); err != nil {
+			log.Error("admin command subscription failed", logger.Err(err))
+		}
+	}()
+	// Role changes and room settings from any replica reach this node's rooms
+	go func() {
+		if err := managerSvc.Run(ctx); err != nil {
+			log.Error("room event subscription failed", logger.Err(err))
+		}
+	}()
+	// Blocks changed through any replica reach this node's viewers
+	go func() {
+		if err := blockSvc.Run(ctx); err != nil {
+			log.Error("block subscription failed", logger.Err(err))
+		}
+	}()
+	var adminSrv *server.AdminServer
+	if cfg.Admin.Token != "" {
+		adminSrv = server.NewAdminServer(logger.Module(log, "admin"), *cfg.Admin, adminSvc, logLevels, srv.StatusDetails())
+		go func() {
+			if err := adminSrv.Start(); err != nil {
+				log.Error("admin server failed", logger.Err(err))
+			}
+		}()
+	} else {
+		log.Warn("ADMIN_TOKEN not set, admin API disabled")
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Start() }()
+	select {
+	case <-ctx.Done():
+		log.Info("shutdown signal received")
+	case err := <-serveErr:
+		if err != nil {
+			log.Error("server failed", logger.Err(err))
+		}
+	}
+
+	// Graceful shutdown, bounded by one deadline
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Service.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("server shutdown incomplete", logger.Err(err))
+	}
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+			log.Error("admin server shutdown failed", logger.Err(err))
+		}
+	}
+	if nc != nil {
+		if err := nc.Drain(); err != nil {
+			log.Error("nats drain failed", logger.Err(err))
+		}
+	}
+	if rdb != nil {
+		if err := rdb.Close(); err != nil {
+			log.Error("redis close failed", logger.Err(err))
+		}
+	}
+	if err := pdb.Close(); err != nil {
+		log.Error("postgres close failed", logger.Err(err))
+	}
+	log.Info("shutdown complete")
 }
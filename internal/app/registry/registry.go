@@ -5,27 +5,43 @@ import (
 	"encoding/json"
 	"livon/internal/core/contracts"
 	"livon/internal/core/domain"
+	"sort"
 	"sync"
 )
 
+// RoomStats describes one locally hosted conversation.
+type RoomStats struct {
+	ConversationID string `json:"conversation_id"`
+	Clients        int    `json:"clients"`
+}
+
+// Stats is a point-in-time snapshot of the local node's registry.
+type Stats struct {
+	Connections int         `json:"connections"`
+	Rooms       []RoomStats `json:"rooms"`
+}
+
+// clientSet holds the connections of one sender or one room.
+type clientSet map[contracts.Client]struct{}
+
 type Registry struct {
-	mu         sync.RWMutex
-	clients    map[string]contracts.Client // sender_id → client
-	room_hub   map[string]map[string]contracts.Client
-	workers    map[string]context.CancelFunc
-	run_worker func(ctx context.Context, convID string) error
+	mu       sync.RWMutex
+	clients  map[string]clientSet // sender_id → its devices
+	room_hub map[string]clientSet
+	hide     func(ctx context.Context, recipientID, authorID string) bool
 }
 
 func NewRegistry() *Registry {
 	return &Registry{
-		clients:  make(map[string]contracts.Client),
-		room_hub: make(map[string]map[string]contracts.Client),
-		workers:  make(map[string]context.CancelFunc),
+		clients:  make(map[string]clientSet),
+		room_hub: make(map[string]clientSet),
 	}
 }
 
-func (h *Registry) RunWorker(run_worker func(ctx context.Context, convID string) error) {
-	h.run_worker = run_worker
+// FilterDelivery installs a check that withholds an author's messages from a
+// recipient. It must be set before clients register.
+func (h *Registry) FilterDelivery(hide func(ctx context.Context, recipientID, authorID string) bool) {
+	h.hide = hide
 }
 
 func (h *Registry) Register(c contracts.Client) {
@@ -34,13 +50,13 @@ func (h *Registry) Register(c contracts.Client) {
 	convID := c.ConversationID()
 	senderID := c.SenderID()
 	if h.room_hub[convID] == nil {
-		h.room_hub[convID] = make(map[string]contracts.Client)
-		ctx, cancel := context.WithCancel(context.Background())
-		h.workers[convID] = cancel
-		go h.run_worker(ctx, convID)
+		h.room_hub[convID] = make(clientSet)
+	}
+	h.room_hub[convID][c] = struct{}{}
+	if h.clients[senderID] == nil {
+		h.clients[senderID] = make(clientSet)
 	}
-	h.room_hub[convID][senderID] = c
-	h.clients[senderID] = c
+	h.clients[senderID][c] = struct{}{}
 }
 
 func (h *Registry) Unregister(c contracts.Client) {
@@ -48,37 +64,145 @@ func (h *Registry) Unregister(c contracts.Client) {
 	defer h.mu.Unlock()
 	convID := c.ConversationID()
 	senderID := c.SenderID()
-	delete(h.room_hub[convID], senderID)
-	delete(h.clients, senderID)
+	delete(h.room_hub[convID], c)
+	// Another device of the same sender keeps its entry
+	delete(h.clients[senderID], c)
+	if len(h.clients[senderID]) == 0 {
+		delete(h.clients, senderID)
+	}
 	if len(h.room_hub[convID]) == 0 {
 		delete(h.room_hub, convID)
-		// stop worker
-		if cancel := h.workers[convID]; cancel != nil {
-			cancel()
-			delete(h.workers, convID)
-		}
 	}
 }
 
 func (h *Registry) SendAck(ctx context.Context, senderID string, ack domain.AckMessage) {
-	h.mu.RLock()
-	c := h.clients[senderID]
-	h.mu.RUnlock()
-	if c == nil {
+	devices := h.senderClients(senderID)
+	if len(devices) == 0 {
 		return
 	}
 	data, _ := json.Marshal(ack)
-	_ = c.Send(ctx, data)
+	for _, c := range devices {
+		_ = c.Send(ctx, data)
+	}
 }
 
-func (h *Registry) Broadcast(ctx context.Context, convID string, msg domain.ChatMessage) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	data, _ := json.Marshal(msg)
-	for sid, c := range h.room_hub[convID] {
-		if sid == msg.SenderID {
+// Fan-out happens on a snapshot taken under the read lock, so a slow
+// client never holds up Register/Unregister. The sender's other devices get
+// the message too, so every screen shows the whole conversation. Connections
+// that are not sent the message still account for its seq, so they do not
+// wait on it as a gap.
+func (h *Registry) Broadcast(ctx context.Context, convID string, msg domain.ChatMessage, fromConnID string) {
+	for _, c := range h.roomClients(convID) {
+		switch {
+		case c.SenderID() == msg.SenderID && c.ConnectionID() == fromConnID:
+			c.SkipMessage(ctx, msg.Seq, true)
+		case h.hidden(ctx, c, msg.SenderID):
+			c.SkipMessage(ctx, msg.Seq, false)
+		default:
+			_ = c.SendMessage(ctx, msg)
+		}
+	}
+}
+
+func (h *Registry) BroadcastPresence(ctx context.Context, convID string, ev domain.PresenceEvent) {
+	data, _ := json.Marshal(ev)
+	for _, c := range h.roomClients(convID) {
+		_ = c.SendPresence(ctx, data)
+	}
+}
+
+func (h *Registry) BroadcastSystem(ctx context.Context, convID string, ev domain.SystemEvent) {
+	data, _ := json.Marshal(ev)
+	for _, c := range h.roomClients(convID) {
+		if ev.Message != nil && h.hidden(ctx, c, ev.Message.SenderID) {
 			continue
 		}
 		_ = c.Send(ctx, data)
 	}
 }
+
+func (h *Registry) hidden(ctx context.Context, c contracts.Client, authorID string) bool {
+	return h.hide != nil && h.hide(ctx, c.SenderID(), authorID)
+}
+
+func (h *Registry) roomClients(convID string) []contracts.Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.room_hub[convID].snapshot()
+}
+
+func (h *Registry) senderClients(senderID string) []contracts.Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.clients[senderID].snapshot()
+}
+
+func (s clientSet) snapshot() []contracts.Client {
+	clients := make([]contracts.Client, 0, len(s))
+	for c := range s {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// CloseAll sends final() to every local client and closes it with code/reason.
+// final is called once per client so each can get its own frame.
+func (h *Registry) CloseAll(ctx context.Context, final func() []byte, code int, reason string) {
+	h.mu.RLock()
+	var clients []contracts.Client
+	for _, room := range h.room_hub {
+		clients = append(clients, room.snapshot()...)
+	}
+	h.mu.RUnlock()
+	for _, c := range clients {
+		if final != nil {
+			_ = c.Send(ctx, final())
+		}
+		c.Disconnect(code, reason)
+	}
+}
+
+// DisconnectSender closes every local connection of senderID.
+func (h *Registry) DisconnectSender(senderID string, code int, reason string) bool {
+	devices := h.senderClients(senderID)
+	for _, c := range devices {
+		c.Disconnect(code, reason)
+	}
+	return len(devices) > 0
+}
+
+// DisconnectConversation closes every local connection in a room.
+func (h *Registry) DisconnectConversation(convID string, code int, reason string) int {
+	clients := h.roomClients(convID)
+	for _, c := range clients {
+		c.Disconnect(code, reason)
+	}
+	return len(clients)
+}
+
+// Stats reports local connections and rooms.
+func (h *Registry) Stats() Stats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	st := Stats{Rooms: make([]RoomStats, 0, len(h.room_hub))}
+	for convID, room := range h.room_hub {
+		st.Connections += len(room)
+		st.Rooms = append(st.Rooms, RoomStats{
+			ConversationID: convID,
+			Clients:        len(room),
+		})
+	}
+	sort.Slice(st.Rooms, func(i, j int) bool { return st.Rooms[i].ConversationID < st.Rooms[j].ConversationID })
+	return st
+}
+
+// Conversations lists the conversations with at least one local client.
+func (h *Registry) Conversations() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]string, 0, len(h.room_hub))
+	for convID := range h.room_hub {
+		ids = append(ids, convID)
+	}
+	return ids
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"livon/internal/app/server/handlers"
+	"livon/internal/config"
+	"livon/internal/core/services"
+	"livon/pkg/middleware"
+)
+
+// AdminServer serves the operator API on its own port, so it can be kept off
+// the public load balancer. Every route requires the admin bearer token.
+type AdminServer struct {
+	log        *slog.Logger
+	mux        *http.ServeMux
+	cfg        config.AdminConfig
+	handler    *handlers.AdminHandler
+	httpServer *http.Server
+}
+
+func NewAdminServer(
+	log *slog.Logger,
+	cfg config.AdminConfig,
+	adminSvc services.IAdminService,
+	logLevels http.Handler,
+	status http.Handler,
+) *AdminServer {
+	s := &AdminServer{
+		log:     log,
+		mux:     http.NewServeMux(),
+		cfg:     cfg,
+		handler: handlers.NewAdminHandler(adminSvc),
+	}
+	s.httpServer = &http.Server{
+		Addr:         ":" + cfg.Port,
+		Handler:      middleware.RequestID(middleware.RequestLogger(log)(middleware.AdminAuth(cfg.Token)(s.mux))),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+	}
+	s.routes(logLevels, status)
+	return s
+}
+
+func (s *AdminServer) routes(logLevels, status http.Handler) {
+	s.mux.Handle("GET /admin/status", status)
+	s.mux.HandleFunc("GET /admin/conversations", s.handler.ListConversations)
+	s.mux.HandleFunc("GET /admin/conversations/{id}/stream", s.handler.StreamInfo)
+	s.mux.HandleFunc("POST /admin/conversations/{id}/close", s.handler.CloseConversation)
+	s.mux.HandleFunc("DELETE /admin/conversations/{id}", s.handler.PurgeConversation)
+	s.mux.HandleFunc("POST /admin/conversations/{id}/dead-letters/replay", s.handler.ReplayDeadLetters)
+	s.mux.HandleFunc("POST /admin/senders/{id}/disconnect", s.handler.DisconnectSender)
+	s.mux.Handle("GET /admin/log-level", logLevels)
+	s.mux.Handle("PUT /admin/log-level", logLevels)
+}
+
+// Start blocks serving the admin API; it returns nil once Shutdown has been called.
+func (s *AdminServer) Start() error {
+	s.log.Info("starting admin server", "port", s.cfg.Port)
+	if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *AdminServer) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
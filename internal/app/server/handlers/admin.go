@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"livon/internal/core/domain"
+	"livon/internal/core/services"
+	"livon/internal/platform/logger"
+	"net/http"
+)
+
+type AdminHandler struct {
+	admin services.IAdminService
+}
+
+func NewAdminHandler(admin services.IAdminService) *AdminHandler {
+	return &AdminHandler{admin: admin}
+}
+
+// ListConversations lists conversations with online participants across replicas.
+func (h *AdminHandler) ListConversations(w http.ResponseWriter, r *http.Request) {
+	convs, err := h.admin.ListConversations(r.Context())
+	if err != nil {
+		adminError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"conversations": convs})
+}
+
+// StreamInfo shows the backlog, pending entries and dead letters of a conversation.
+func (h *AdminHandler) StreamInfo(w http.ResponseWriter, r *http.Request) {
+	info, err := h.admin.StreamInfo(r.Context(), r.PathValue("id"))
+	if err != nil {
+		adminError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (h *AdminHandler) DisconnectSender(w http.ResponseWriter, r *http.Request) {
+	if err := h.admin.DisconnectSender(r.Context(), r.PathValue("id")); err != nil {
+		adminError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "disconnect requested"})
+}
+
+func (h *AdminHandler) CloseConversation(w http.ResponseWriter, r *http.Request) {
+	if err := h.admin.CloseConversation(r.Context(), r.PathValue("id")); err != nil {
+		adminError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "close requested"})
+}
+
+func (h *AdminHandler) PurgeConversation(w http.ResponseWriter, r *http.Request) {
+	if err := h.admin.PurgeConversation(r.Context(), r.PathValue("id")); err != nil {
+		adminError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "purged"})
+}
+
+func (h *AdminHandler) ReplayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	n, err := h.admin.ReplayDeadLetters(r.Context(), r.PathValue("id"))
+	if err != nil {
+		adminError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"replayed": n})
+}
+
+func adminError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidConversationID), errors.Is(err, domain.ErrInvalidParticipantID):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, domain.ErrConversationNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	default:
+		logger.FromContext(r.Context()).ErrorContext(r.Context(), "admin handler - request failed", logger.Err(err))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+}
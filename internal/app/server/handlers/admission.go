@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
+	"livon/internal/platform/logger"
+	"livon/internal/platform/metrics"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reasons an upgrade is turned away, reported on livon.ws.handshakes.rejected
+const (
+	rejectQueueFull    = "queue_full"
+	rejectQueueTimeout = "queue_timeout"
+	rejectCanceled     = "canceled"
+	rejectClusterLimit = "cluster_limit"
+)
+
+// admission bounds concurrent handshakes so a reconnect storm cannot pile
+// HandleConnect work onto Postgres and Redis all at once. Each node has its own
+// slots with a capped wait queue in front; the optional gate adds a limit shared
+// by the whole cluster.
+type admission struct {
+	cfg    config.WebSocketConfig
+	slots  chan struct{} // nil when the node limit is disabled
+	queued atomic.Int64
+	gate   contracts.HandshakeGate
+}
+
+func newAdmission(cfg config.WebSocketConfig) *admission {
+	a := &admission{cfg: cfg}
+	if cfg.MaxHandshakes > 0 {
+		a.slots = make(chan struct{}, cfg.MaxHandshakes)
+	}
+	return a
+}
+
+// admit waits for a handshake slot. On success it returns a release func,
+// safe to call more than once; otherwise it returns nil and the reason.
+func (a *admission) admit(ctx context.Context) (func(), string) {
+	release := func() {}
+	if a.slots != nil {
+		if reason := a.acquireLocal(ctx); reason != "" {
+			return nil, reason
+		}
+		release = func() { <-a.slots }
+	}
+	if a.gate != nil {
+		id := uuid.NewString()
+		ok, err := a.gate.TryAcquire(ctx, id)
+		switch {
+		case err != nil:
+			// The shared limit is a safeguard; losing it must not lock everyone out
+			logger.FromContext(ctx).WarnContext(ctx, "ws handler - admit - handshake gate unavailable", logger.Err(err))
+		case !ok:
+			release()
+			return nil, rejectClusterLimit
+		default:
+			local := release
+			release = func() {
+				local()
+				_ = a.gate.Release(context.WithoutCancel(ctx), id)
+			}
+		}
+	}
+	var once sync.Once
+	return func() { once.Do(release) }, ""
+}
+
+// acquireLocal takes a node slot, queueing for up to HandshakeWait when none is
+// free. It returns the rejection reason, or "" once a slot is held.
+func (a *admission) acquireLocal(ctx context.Context) string {
+	select {
+	case a.slots <- struct{}{}:
+		return ""
+	default:
+	}
+	if a.queued.Add(1) > int64(a.cfg.HandshakeQueue) {
+		a.queued.Add(-1)
+		return rejectQueueFull
+	}
+	defer a.queued.Add(-1)
+	metrics.HandshakesWaiting.Add(ctx, 1)
+	defer metrics.HandshakesWaiting.Add(ctx, -1)
+	timer := time.NewTimer(a.cfg.HandshakeWait)
+	defer timer.Stop()
+	select {
+	case a.slots <- struct{}{}:
+		return ""
+	case <-timer.C:
+		return rejectQueueTimeout
+	case <-ctx.Done():
+		return rejectCanceled
+	}
+}
+
+// retryAfter is the backoff sent with try_again_later: RetryBase doubled per
+// failed attempt up to RetryMax, with the upper half randomised so rejected
+// clients do not come back in lockstep.
+func (a *admission) retryAfter(attempt int) time.Duration {
+	d := a.cfg.RetryBase
+	for i := 0; i < attempt && d < a.cfg.RetryMax; i++ {
+		d *= 2
+	}
+	d = min(d, a.cfg.RetryMax)
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(d-half)
+}
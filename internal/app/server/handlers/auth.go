@@ -3,8 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"livon/internal/core/services"
-	"livon/pkg/middleware"
-	"log/slog"
+	"livon/internal/platform/logger"
 	"net/http"
 )
 
@@ -19,7 +18,7 @@ func NewAuthHandler(u *services.UserService, t *services.TokenService) *AuthHand
 
 // Requesting the OTP
 func (h *AuthHandler) RequestOTP(w http.ResponseWriter, r *http.Request) {
-	log, _ := r.Context().Value(middleware.LoggerKey).(*slog.Logger)
+	log := logger.FromContext(r.Context())
 	var req struct {
 		Phone string `json:"phone"`
 	}
@@ -29,18 +28,18 @@ func (h *AuthHandler) RequestOTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := h.userSvc.RequestOTP(r.Context(), req.Phone); err != nil {
-		log.ErrorContext(r.Context(), "auth handler - request otp failed", "phone", req.Phone)
+		log.ErrorContext(r.Context(), "auth handler - request otp failed", logger.Phone(req.Phone))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "OTP sent successfully"})
-	log.InfoContext(r.Context(), "auth handler - request otp sent", "phone", req.Phone)
+	log.InfoContext(r.Context(), "auth handler - request otp sent", logger.Phone(req.Phone))
 }
 
 // Verifying and Creating the Identity
 func (h *AuthHandler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
-	log, _ := r.Context().Value(middleware.LoggerKey).(*slog.Logger)
+	log := logger.FromContext(r.Context())
 	var req struct {
 		Phone string `json:"phone"`
 		Code  string `json:"code"`
@@ -53,15 +52,15 @@ func (h *AuthHandler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 	// Verify OTP and Create/Get User in DB
 	user, err := h.userSvc.VerifyOTP(r.Context(), req.Phone, req.Code)
 	if err != nil {
-		log.ErrorContext(r.Context(), "auth handler - verify otp failed", "phone", req.Phone, "code", req.Code)
+		log.ErrorContext(r.Context(), "auth handler - verify otp failed", logger.Phone(req.Phone))
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
-	log.InfoContext(r.Context(), "auth handler - verify otp success", "phone", req.Phone, "code", req.Code)
+	log.InfoContext(r.Context(), "auth handler - verify otp success", logger.Phone(req.Phone))
 	// Generate the JWT using the phone number as 'sub'
 	token, err := h.tokenSvc.GenerateToken(user.ID) // user.ID is the phone number
 	if err != nil {
-		log.ErrorContext(r.Context(), "auth handler - generate token failed", "phone", req.Phone)
+		log.ErrorContext(r.Context(), "auth handler - generate token failed", logger.Phone(req.Phone))
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
@@ -71,5 +70,5 @@ func (h *AuthHandler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 		"user_id":    user.ID,
 		"created_at": user.CreatedAt,
 	})
-	log.InfoContext(r.Context(), "auth handler - token send success", "phone", req.Phone)
+	log.InfoContext(r.Context(), "auth handler - token send success", logger.Phone(req.Phone))
 }
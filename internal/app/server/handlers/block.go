@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"livon/internal/core/domain"
+	"livon/internal/core/services"
+	"livon/internal/platform/logger"
+	"livon/pkg/middleware"
+	"net/http"
+)
+
+type BlockHandler struct {
+	blocks services.IBlockService
+}
+
+func NewBlockHandler(blocks services.IBlockService) *BlockHandler {
+	return &BlockHandler{blocks: blocks}
+}
+
+// Block hides a sender's user from the caller everywhere. The response is the
+// same whoever the sender turns out to be.
+func (h *BlockHandler) Block(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	var req struct {
+		SenderID string `json:"sender_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+	if err := h.blocks.Block(r.Context(), userID, req.SenderID); err != nil {
+		blockError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unblock lifts the block placed through the sender_id in the path.
+func (h *BlockHandler) Unblock(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	if err := h.blocks.Unblock(r.Context(), userID, r.PathValue("sender_id")); err != nil {
+		blockError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func blockError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidParticipantID):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, domain.ErrParticipantNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	default:
+		logger.FromContext(r.Context()).ErrorContext(r.Context(), "block handler - request failed", logger.Err(err))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+}
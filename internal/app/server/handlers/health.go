@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"livon/internal/app/registry"
+	"livon/internal/app/worker"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HealthCheck pings one dependency.
+type HealthCheck func(ctx context.Context) error
+
+type dependencyStatus struct {
+	OK        bool    `json:"ok"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type HealthHandler struct {
+	hub     *registry.Registry
+	ws      *WSHandler
+	pool    *worker.Pool
+	timeout time.Duration
+	mu      sync.RWMutex
+	checks  map[string]HealthCheck
+}
+
+func NewHealthHandler(hub *registry.Registry, ws *WSHandler, pool *worker.Pool) *HealthHandler {
+	return &HealthHandler{
+		hub:     hub,
+		ws:      ws,
+		pool:    pool,
+		timeout: 2 * time.Second,
+		checks:  make(map[string]HealthCheck),
+	}
+}
+
+// AddCheck registers a dependency probed by /readyz, /debug/status and /admin/status.
+func (h *HealthHandler) AddCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// Liveness only proves the process is serving HTTP.
+func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readiness fails while draining, when a dependency is unreachable,
+// or when the stream consumers are not running.
+func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	failures := make(map[string]string)
+	if h.ws.Draining() {
+		failures["server"] = "draining"
+	}
+	// The probes are public; the errors themselves are only on the admin status
+	for name, st := range h.probe(r.Context()) {
+		if !st.OK {
+			failures[name] = "unreachable"
+		}
+	}
+	if !h.pool.Running() {
+		failures["workers"] = "stream consumers not running"
+	}
+	if len(failures) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "unavailable", "failures": failures})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// Status is the public view of the node: counts and whether each dependency
+// answers, nothing that names a conversation or echoes an error.
+func (h *HealthHandler) Status(w http.ResponseWriter, r *http.Request) {
+	stats := h.hub.Stats()
+	deps := make(map[string]string)
+	for name, st := range h.probe(r.Context()) {
+		deps[name] = "fail"
+		if st.OK {
+			deps[name] = "ok"
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"draining":     h.ws.Draining(),
+		"connections":  stats.Connections,
+		"rooms":        len(stats.Rooms),
+		"workers":      h.pool.Running(),
+		"dependencies": deps,
+	})
+}
+
+// Details is the operator view served on the admin listener: every room with
+// its client count, the owned partitions and each dependency's latency and error.
+func (h *HealthHandler) Details(w http.ResponseWriter, r *http.Request) {
+	stats := h.hub.Stats()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"draining":     h.ws.Draining(),
+		"connections":  stats.Connections,
+		"rooms":        stats.Rooms,
+		"workers":      h.pool.Stats(),
+		"dependencies": h.probe(r.Context()),
+	})
+}
+
+// probe runs every check concurrently, each bounded by h.timeout.
+func (h *HealthHandler) probe(ctx context.Context) map[string]dependencyStatus {
+	h.mu.RLock()
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]HealthCheck, len(names))
+	for i, name := range names {
+		checks[i] = h.checks[name]
+	}
+	h.mu.RUnlock()
+
+	results := make([]dependencyStatus, len(names))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+			start := time.Now()
+			err := check(cctx)
+			results[i] = dependencyStatus{
+				OK:        err == nil,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	out := make(map[string]dependencyStatus, len(names))
+	for i, name := range names {
+		out[name] = results[i]
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"livon/internal/core/domain"
+	"livon/internal/core/services"
+	"livon/internal/platform/logger"
+	"livon/pkg/middleware"
+	"net/http"
+	"time"
+)
+
+type InviteHandler struct {
+	access services.IAccessService
+}
+
+func NewInviteHandler(access services.IAccessService) *InviteHandler {
+	return &InviteHandler{access: access}
+}
+
+// Create issues an invite for the conversation; the caller must be in it as an owner or moderator.
+func (h *InviteHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	var req struct {
+		TTLSec    int64 `json:"ttl_sec"`
+		SingleUse bool  `json:"single_use"`
+	}
+	// An empty body asks for the defaults
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return
+	}
+	inv, token, err := h.access.CreateInvite(r.Context(), userID, r.PathValue("id"), time.Duration(req.TTLSec)*time.Second, req.SingleUse)
+	if err != nil {
+		inviteError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"invite_id":  inv.ID,
+		"token":      token,
+		"expires_at": inv.ExpiresAt,
+		"single_use": inv.SingleUse,
+	})
+}
+
+// Revoke stops an invite from admitting anyone else.
+func (h *InviteHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	if err := h.access.RevokeInvite(r.Context(), userID, r.PathValue("id"), r.PathValue("invite_id")); err != nil {
+		inviteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func inviteError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidConversationID):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, domain.ErrPermissionDenied):
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, domain.ErrInviteNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	default:
+		logger.FromContext(r.Context()).ErrorContext(r.Context(), "invite handler - request failed", logger.Err(err))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+}
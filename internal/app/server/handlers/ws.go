@@ -2,35 +2,113 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"livon/internal/app/registry"
 	"livon/internal/app/server/ws"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
 	"livon/internal/core/domain"
 	"livon/internal/core/services"
+	"livon/internal/platform/logger"
+	"livon/internal/platform/metrics"
 	"livon/pkg/middleware"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  32,
+	WriteBufferSize: 32,
+	CheckOrigin: func(r *http.Request) bool {
+		return true // tighten later
+	},
+}
+
 type WSHandler struct {
-	hub     *registry.Registry
-	manager *services.ManagerService
+	cfg       config.WebSocketConfig
+	hub       *registry.Registry
+	manager   *services.ManagerService
+	admission *admission
+	mu        sync.Mutex
+	draining  bool
+	sessions  sync.WaitGroup
 }
 
-func NewWSHandler(hub *registry.Registry, manager *services.ManagerService) *WSHandler {
+func NewWSHandler(cfg config.WebSocketConfig, hub *registry.Registry, manager *services.ManagerService) *WSHandler {
 	return &WSHandler{
-		hub:     hub,
-		manager: manager,
+		cfg:       cfg,
+		hub:       hub,
+		manager:   manager,
+		admission: newAdmission(cfg),
 	}
 }
 
+// ShareHandshakeLimit adds a cluster-wide handshake limit on top of the node's
+// own. Call it before the server starts.
+func (s *WSHandler) ShareHandshakeLimit(gate contracts.HandshakeGate) {
+	s.admission.gate = gate
+}
+
+// Drain stops accepting new upgrades; sessions already running are unaffected.
+func (s *WSHandler) Drain() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.draining = true
+	s.manager.Drain()
+}
+
+// Draining reports whether Drain has been called.
+func (s *WSHandler) Draining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draining
+}
+
+// Wait blocks until every session has run its disconnect cleanup or ctx expires.
+// Call it only after Drain so no new session can start.
+func (s *WSHandler) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.sessions.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// begin registers a session unless the handler is draining.
+func (s *WSHandler) begin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draining {
+		return false
+	}
+	s.sessions.Add(1)
+	return true
+}
+
 func (s *WSHandler) Handler(w http.ResponseWriter, r *http.Request) {
-	log, _ := r.Context().Value(middleware.LoggerKey).(*slog.Logger)
+	log := logger.FromContext(r.Context())
+	if !s.begin() {
+		log.WarnContext(r.Context(), "ws handler - draining - upgrade refused")
+		http.Error(w, "Server is draining", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.sessions.Done()
 	span := trace.SpanFromContext(r.Context())
-	log.Info("Context Check", "has_span", span.SpanContext().IsValid(), "trace_id", span.SpanContext().TraceID().String())
 	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
 	if !ok {
 		log.ErrorContext(r.Context(), "ws handler - unauthorised missing user_id")
@@ -38,61 +116,200 @@ func (s *WSHandler) Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	span.SetAttributes(attribute.String("user.id", userID))
+	release, reason := s.admission.admit(r.Context())
+	if release == nil {
+		s.tryAgainLater(w, r, reason)
+		return
+	}
+	defer release()
 	sessionCtx := context.WithoutCancel(r.Context())
 	ctx, cancel := context.WithCancel(sessionCtx)
-	var upgrader = websocket.Upgrader{
-		ReadBufferSize:  32,
-		WriteBufferSize: 32,
-		CheckOrigin: func(r *http.Request) bool {
-			return true // tighten later
-		},
-	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.ErrorContext(r.Context(), "ws handler - upgrade - ws upgrade failed", "err", err)
+		log.ErrorContext(r.Context(), "ws handler - upgrade - ws upgrade failed", logger.Err(err))
 		cancel()
 		return
 	}
 	defer conn.Close()
 	conn.SetCloseHandler(func(code int, text string) error {
-		log.Info("ws handler - ws closed", "user_id", userID)
+		log.Info("ws handler - ws closed", logger.User(userID))
 		cancel()
 		return nil
 	})
-	websocket := ws.NewWebSocket(ctx, conn)
+	socket := ws.NewWebSocket(ctx, conn, s.cfg.PingInterval, s.cfg.PongTimeout)
 
 	convID := r.URL.Query().Get("conv_id")
-	forceNew := r.URL.Query().Get("new") == "1"
-	senderID, isNew, err := s.manager.HandleConnect(ctx, userID, convID, forceNew)
-	if err != nil || senderID == "" {
-		log.ErrorContext(r.Context(), "ws handler - handle connect - no sender id", "err", err)
+	// since_seq lets a client that was dropped resume from the last seq it saw
+	sinceSeq, _ := strconv.ParseInt(r.URL.Query().Get("since_seq"), 10, 64)
+	opts := services.ConnectOptions{
+		ForceNew:    r.URL.Query().Get("new") == "1",
+		Invite:      r.URL.Query().Get("invite"),
+		DisplayName: r.URL.Query().Get("name"),
+		ResumeToken: r.URL.Query().Get("resume"),
+		SinceSeq:    sinceSeq,
+	}
+	policy := ws.ParsePolicy(r.URL.Query().Get("slow_policy"), ws.ParsePolicy(s.cfg.SlowConsumerPolicy, ws.PolicyDisconnect))
+	session, err := s.manager.HandleConnect(ctx, userID, convID, opts)
+	if err != nil {
+		log.ErrorContext(r.Context(), "ws handler - handle connect - no sender id", logger.Err(err))
+		switch {
+		case errors.Is(err, domain.ErrBanned):
+			socket.CloseWithReason(domain.CloseBanned, domain.CloseReasonBanned)
+		case errors.Is(err, domain.ErrInviteRequired), errors.Is(err, domain.ErrInviteInvalid):
+			socket.CloseWithReason(domain.CloseInviteRequired, domain.CloseReasonInviteRequired)
+		case errors.Is(err, domain.ErrDisplayNameTaken):
+			socket.CloseWithReason(domain.CloseDisplayNameRejected, domain.CloseReasonDisplayNameTaken)
+		case errors.Is(err, domain.ErrInvalidDisplayName):
+			socket.CloseWithReason(domain.CloseDisplayNameRejected, domain.CloseReasonInvalidDisplayName)
+		}
 		return
 	}
+	senderID := session.SenderID.String()
+	connID := session.ConnectionID
 	resp := domain.HandshakeResponse{
 		Type:          domain.TypeHandshake,
 		SenderID:      senderID,
-		IsNewIdentity: isNew,
+		IsNewIdentity: session.IsNewIdentity,
+		Role:          session.Role,
+		DisplayName:   session.DisplayName,
+		AvatarSeed:    session.AvatarSeed,
+		ResumeToken:   session.ResumeToken,
+		Resumed:       session.Resumed,
 	}
 	_ = conn.WriteJSON(resp)
 	span.SetAttributes(
 		attribute.String("chat.sender_id", senderID),
 		attribute.String("chat.conv_id", convID),
-		attribute.Bool("chat.is_new_session", isNew),
+		attribute.Bool("chat.is_new_session", session.IsNewIdentity),
+		attribute.String("chat.role", string(session.Role)),
+		attribute.Bool("chat.resumed", session.Resumed),
 	)
-	log.InfoContext(r.Context(), "ws handler - ws connection established", "sender_id", senderID)
+	log.InfoContext(r.Context(), "ws handler - ws connection established", logger.Sender(senderID))
 	// Start registry and worker
-	client := ws.NewClient(ctx, websocket, senderID, convID)
+	client := ws.NewClient(ctx, socket, senderID, convID, connID, policy, s.cfg.OutboxSize, s.cfg.ReorderWait)
+	if session.ResumeSeq > 0 {
+		client.HoldDelivered(session.ResumeSeq)
+	}
 	s.hub.Register(client)
-	defer s.manager.HandleDisconnect(ctx, senderID, convID)
+	// Cleanup must outlive ctx, which is cancelled as soon as the socket closes
+	defer s.manager.HandleDisconnect(context.WithoutCancel(ctx), senderID, convID, connID)
+	defer func() {
+		s.manager.SaveResumePoint(context.WithoutCancel(ctx), session, client.LastDeliveredSeq())
+	}()
 	defer s.hub.Unregister(client)
-	log.InfoContext(r.Context(), "ws handler - register - client updated into registry", "sender_id", senderID)
-	// Heartbeat
-	go s.manager.HandleHeartbeat(ctx, senderID, convID)
-	log.InfoContext(r.Context(), "ws handler - handle heartbeat - heartbeat started", "sender_id", senderID)
+	log.InfoContext(r.Context(), "ws handler - register - client updated into registry", logger.Sender(senderID))
+	if s.Draining() {
+		// Raced with a drain that already swept the registry
+		client.Disconnect(websocket.CloseGoingAway, domain.CloseReasonGoingAway)
+	}
+	s.manager.BroadcastPresence(ctx, convID)
+	// Replay missed messages after registering; live ones are held until it ends
+	if session.ResumeSeq > 0 {
+		prev := session.ResumeSeq
+		for _, m := range s.manager.HandleResync(ctx, senderID, convID, session.ResumeSeq, session.ReplaySince) {
+			msg := domain.NewChatMessage(&m)
+			msg.PrevSeq = prev
+			data, _ := json.Marshal(msg)
+			if err := client.SendWait(ctx, m.Seq, data); err != nil {
+				break
+			}
+			prev = m.Seq
+		}
+		client.ReleaseDelivered(ctx, prev)
+	}
+	// The handshake is over once the backlog is replayed; free the slot for the next upgrade
+	release()
+	// Heartbeat, driven by pongs and inbound frames rather than a server timer
+	alive := make(chan struct{}, 1)
+	socket.OnAlive(func() {
+		select {
+		case alive <- struct{}{}:
+		default:
+		}
+	})
+	go s.manager.HandleHeartbeat(ctx, senderID, convID, connID, alive)
+	log.InfoContext(r.Context(), "ws handler - handle heartbeat - heartbeat started", logger.Sender(senderID))
+	// Inbound frames are processed one at a time in send order
+	inbox := ws.NewInbox(ctx, s.cfg.InboxSize, func(data []byte) {
+		if err := s.manager.HandleMessage(ctx, senderID, convID, connID, data); err != nil {
+			s.reject(ctx, client, err)
+		}
+	})
+	defer inbox.Close()
 	// Read loop
-	websocket.ReadLoop(func(data []byte) {
-		go func(msgData []byte) {
-			s.manager.HandleMessage(ctx, senderID, convID, msgData)
-		}(data)
+	socket.ReadLoop(inbox.Push)
+}
+
+// tryAgainLater turns an upgrade away. The socket is still upgraded because
+// browsers cannot read the status of a refused upgrade; the client gets a
+// reconnect hint with a jittered backoff and a 1013 close.
+func (s *WSHandler) tryAgainLater(w http.ResponseWriter, r *http.Request, reason string) {
+	log := logger.FromContext(r.Context())
+	// attempt counts the client's consecutive rejections and grows the backoff
+	attempt, _ := strconv.Atoi(r.URL.Query().Get("attempt"))
+	retry := s.admission.retryAfter(attempt)
+	metrics.HandshakesRejected.Add(r.Context(), 1, metric.WithAttributes(attribute.String("reason", reason)))
+	log.WarnContext(r.Context(), "ws handler - admit - upgrade turned away",
+		slog.String("reason", reason), slog.Int64("retry_after_ms", retry.Milliseconds()))
+	header := http.Header{"Retry-After": {strconv.FormatInt(int64(retry.Round(time.Second)/time.Second), 10)}}
+	conn, err := upgrader.Upgrade(w, r, header)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_ = conn.WriteJSON(domain.ReconnectHint{
+		Type:         domain.TypeReconnect,
+		Reason:       domain.CloseReasonTryAgainLater,
+		RetryAfterMs: retry.Milliseconds(),
+	})
+	msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, domain.CloseReasonTryAgainLater)
+	_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+// reject reports a refused frame to the client; rate limits also apply their escalation.
+func (s *WSHandler) reject(ctx context.Context, client *ws.RuntimeClient, err error) {
+	var rl *domain.RateLimitError
+	if errors.As(err, &rl) {
+		data, _ := json.Marshal(domain.ErrorMessage{
+			Type:         domain.TypeError,
+			Code:         domain.ErrCodeRateLimited,
+			Message:      rl.Error(),
+			Action:       string(rl.Action),
+			RetryAfterMs: rl.RetryAfter.Milliseconds(),
+		})
+		_ = client.Send(ctx, data)
+		if rl.Action == domain.RateLimitDisconnect {
+			client.Disconnect(websocket.ClosePolicyViolation, domain.ErrCodeRateLimited)
+		}
+		return
+	}
+	var muted *domain.MutedError
+	if errors.As(err, &muted) {
+		data, _ := json.Marshal(domain.ErrorMessage{
+			Type:         domain.TypeError,
+			Code:         domain.ErrCodeMuted,
+			Message:      muted.Error(),
+			RetryAfterMs: time.Until(muted.Until).Milliseconds(),
+		})
+		_ = client.Send(ctx, data)
+		return
+	}
+	var code string
+	switch {
+	case errors.Is(err, domain.ErrPermissionDenied):
+		code = domain.ErrCodeForbidden
+	case errors.Is(err, domain.ErrMessageNotFound), errors.Is(err, domain.ErrParticipantNotFound):
+		code = domain.ErrCodeNotFound
+	case errors.Is(err, domain.ErrInvalidFrame), errors.Is(err, domain.ErrInvalidRole), errors.Is(err, domain.ErrInvalidParticipantID):
+		code = domain.ErrCodeBadRequest
+	default:
+		// Internal failures are logged by the services and not exposed
+		return
+	}
+	data, _ := json.Marshal(domain.ErrorMessage{
+		Type:    domain.TypeError,
+		Code:    code,
+		Message: err.Error(),
 	})
+	_ = client.Send(ctx, data)
 }
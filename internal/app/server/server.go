@@ -1,43 +1,77 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
 	"time"
 
 	"livon/internal/app/registry"
 	"livon/internal/app/server/handlers"
+	"livon/internal/app/worker"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
+	"livon/internal/core/domain"
 	"livon/internal/core/services"
+	"livon/internal/platform/logger"
 	"livon/pkg/middleware"
+
+	"github.com/gorilla/websocket"
 )
 
 type Server struct {
 	log         *slog.Logger
 	mux         *http.ServeMux
 	app         string
+	svc         config.ServiceConfig
 	port        string
 	authHandler *handlers.AuthHandler
 	wsHandler   *handlers.WSHandler
+	invites     *handlers.InviteHandler
+	blocks      *handlers.BlockHandler
+	health      *handlers.HealthHandler
 	tokenSvc    *services.TokenService
+	hub         *registry.Registry
+	pool        *worker.Pool
+	httpServer  *http.Server
 }
 
 func NewServer(
 	log *slog.Logger,
-	app string,
+	svc config.ServiceConfig,
 	port string,
+	wsCfg config.WebSocketConfig,
 	userSvc *services.UserService,
 	tokenSvc *services.TokenService,
 	managerSvc *services.ManagerService,
+	accessSvc *services.AccessService,
+	blockSvc *services.BlockService,
 	hub *registry.Registry,
+	pool *worker.Pool,
 ) *Server {
 	s := &Server{
-		app:         app,
+		app:         svc.Name,
+		svc:         svc,
 		log:         log,
 		mux:         http.NewServeMux(),
 		port:        port,
 		authHandler: handlers.NewAuthHandler(userSvc, tokenSvc),
-		wsHandler:   handlers.NewWSHandler(hub, managerSvc),
+		wsHandler:   handlers.NewWSHandler(wsCfg, hub, managerSvc),
+		invites:     handlers.NewInviteHandler(accessSvc),
+		blocks:      handlers.NewBlockHandler(blockSvc),
 		tokenSvc:    tokenSvc,
+		hub:         hub,
+		pool:        pool,
+	}
+	s.health = handlers.NewHealthHandler(hub, s.wsHandler, pool)
+	s.httpServer = &http.Server{
+		Addr:         ":" + port,
+		Handler:      s.mux,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
 	}
 
 	s.routes()
@@ -47,25 +81,95 @@ func NewServer(
 func (s *Server) routes() {
 	// Initialize Middleware
 	auth := middleware.AuthMiddleware(s.tokenSvc)
+	reqID := middleware.RequestID
 	log := middleware.RequestLogger(s.log)
 	trace := middleware.TracerMiddleware(s.app)
+	metrics := middleware.MetricsMiddleware(s.app)
 	// Public Routes
-	s.mux.Handle("POST /auth/register", trace(log(http.Handler(http.HandlerFunc(s.authHandler.RequestOTP)))))
-	s.mux.Handle("POST /auth/verify", trace(log(http.Handler(http.HandlerFunc(s.authHandler.VerifyOTP)))))
+	s.mux.Handle("POST /auth/register", reqID(metrics(trace(log(http.Handler(http.HandlerFunc(s.authHandler.RequestOTP)))))))
+	s.mux.Handle("POST /auth/verify", reqID(metrics(trace(log(http.Handler(http.HandlerFunc(s.authHandler.VerifyOTP)))))))
 
 	// Protected Routes
 	// The middleware extracts the 'sub' (phone) from JWT and puts it in Context.
-	s.mux.Handle("/ws", trace(log(auth(http.HandlerFunc(s.wsHandler.Handler)))))
+	s.mux.Handle("/ws", reqID(trace(log(auth(http.HandlerFunc(s.wsHandler.Handler))))))
+	s.mux.Handle("POST /conversations/{id}/invites", reqID(metrics(trace(log(auth(http.HandlerFunc(s.invites.Create)))))))
+	s.mux.Handle("DELETE /conversations/{id}/invites/{invite_id}", reqID(metrics(trace(log(auth(http.HandlerFunc(s.invites.Revoke)))))))
+	s.mux.Handle("POST /blocks", reqID(metrics(trace(log(auth(http.HandlerFunc(s.blocks.Block)))))))
+	s.mux.Handle("DELETE /blocks/{sender_id}", reqID(metrics(trace(log(auth(http.HandlerFunc(s.blocks.Unblock)))))))
+
+	// Probes (no request logging, they run every few seconds)
+	s.mux.HandleFunc("GET /healthz", s.health.Liveness)
+	s.mux.HandleFunc("GET /readyz", s.health.Readiness)
+	s.mux.HandleFunc("GET /debug/status", s.health.Status)
 }
 
+// StatusDetails is the detailed node status, for the admin listener.
+func (s *Server) StatusDetails() http.Handler {
+	return http.HandlerFunc(s.health.Details)
+}
+
+// ExposeMetrics serves the Prometheus scrape endpoint on /metrics.
+func (s *Server) ExposeMetrics(h http.Handler) {
+	s.mux.Handle("GET /metrics", h)
+}
+
+// ShareHandshakeLimit caps concurrent /ws handshakes across the cluster.
+func (s *Server) ShareHandshakeLimit(gate contracts.HandshakeGate) {
+	s.wsHandler.ShareHandshakeLimit(gate)
+}
+
+// AddHealthCheck registers a dependency probed by /readyz, /debug/status and /admin/status.
+func (s *Server) AddHealthCheck(name string, check handlers.HealthCheck) {
+	s.health.AddCheck(name, check)
+}
+
+// Start blocks serving HTTP; it returns nil once Shutdown has been called.
 func (s *Server) Start() error {
-	server := &http.Server{
-		Addr:         ":" + s.port,
-		Handler:      s.mux,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+	s.log.Info("starting server", "port", s.port)
+	if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
+	return nil
+}
 
-	s.log.Info("starting server", "port", s.port)
-	return server.ListenAndServe()
+// Shutdown drains the node in order: fail readiness and refuse new upgrades,
+// stop the listener, tell connected clients to reconnect elsewhere, let
+// the stream consumers finish their current entries and hand their partitions
+// over, and wait for every session's presence flush. Every step shares ctx's deadline.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.log.InfoContext(ctx, "server - shutdown - draining")
+	s.wsHandler.Drain()
+	// Give the orchestrator time to observe /readyz failing before the listener goes away
+	select {
+	case <-time.After(s.svc.DrainDelay):
+	case <-ctx.Done():
+	}
+	var errs []error
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	// Spread the hints so the drained clients do not all land on the survivors at once
+	hint := func() []byte {
+		retry := s.svc.ReconnectAfter
+		if s.svc.ReconnectJitter > 0 {
+			retry += rand.N(s.svc.ReconnectJitter)
+		}
+		data, _ := json.Marshal(domain.ReconnectHint{
+			Type:         domain.TypeReconnect,
+			Reason:       domain.CloseReasonGoingAway,
+			RetryAfterMs: retry.Milliseconds(),
+		})
+		return data
+	}
+	s.hub.CloseAll(ctx, hint, websocket.CloseGoingAway, domain.CloseReasonGoingAway)
+	if err := s.pool.Stop(ctx); err != nil {
+		s.log.ErrorContext(ctx, "server - shutdown - workers did not finish", logger.Err(err))
+		errs = append(errs, err)
+	}
+	if err := s.wsHandler.Wait(ctx); err != nil {
+		s.log.ErrorContext(ctx, "server - shutdown - sessions did not finish", logger.Err(err))
+		errs = append(errs, err)
+	}
+	s.log.InfoContext(ctx, "server - shutdown - drained")
+	return errors.Join(errs...)
 }
@@ -2,69 +2,325 @@ package ws
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"livon/internal/core/domain"
+	"livon/internal/platform/metrics"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	ErrClientClosed = errors.New("client closed")
+	ErrSlowConsumer = errors.New("slow consumer")
+)
+
+// SlowConsumerPolicy decides what happens when a client's outbound queue is full.
+type SlowConsumerPolicy string
+
+const (
+	// PolicyDropOldest evicts the oldest queued frame to make room.
+	PolicyDropOldest SlowConsumerPolicy = "drop_oldest"
+	// PolicyCoalescePresence keeps only the latest presence snapshot
+	// and otherwise drops the oldest frame.
+	PolicyCoalescePresence SlowConsumerPolicy = "coalesce_presence"
+	// PolicyDisconnect closes the socket with CloseSlowConsumer;
+	// the client resyncs from its last seq on reconnect.
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"
 )
 
+// ParsePolicy returns the named policy, or fallback if the name is unknown.
+func ParsePolicy(name string, fallback SlowConsumerPolicy) SlowConsumerPolicy {
+	switch p := SlowConsumerPolicy(name); p {
+	case PolicyDropOldest, PolicyCoalescePresence, PolicyDisconnect:
+		return p
+	}
+	return fallback
+}
+
+type closeFrame struct {
+	code   int
+	reason string
+	flush  bool
+}
+
+// outFrame is a queued frame; seq is set for chat messages.
+type outFrame struct {
+	data      []byte
+	seq       int64
+	releaseAt bool // end of a replay, see HoldDelivered
+}
+
 type RuntimeClient struct {
 	ctx      context.Context
 	cancel   context.CancelFunc
 	ws       *WebSocket
 	senderID string
 	convID   string
-	out      chan []byte
+	connID   string
+	policy   SlowConsumerPolicy
+	mu       sync.Mutex // serialises evictions from out and presence
+	out      chan outFrame
+	presence chan []byte
+	kick     chan closeFrame
 	once     sync.Once
+	// Delivery tracking for resume tokens; held belongs to writeLoop
+	delivered atomic.Int64 // highest seq written to the socket
+	dropped   atomic.Int64 // lowest seq evicted from the queue, 0 if none
+	hold      atomic.Bool
+	held      int64
+	order     *reorder
 }
 
 func NewClient(
 	parent context.Context,
 	ws *WebSocket,
-	senderID, convID string,
+	senderID, convID, connID string,
+	policy SlowConsumerPolicy,
+	outboxSize int,
+	reorderWait time.Duration,
 ) *RuntimeClient {
 	ctx, cancel := context.WithCancel(parent)
+	if outboxSize <= 0 {
+		outboxSize = 1
+	}
 	c := &RuntimeClient{
 		ctx:      ctx,
 		cancel:   cancel,
 		ws:       ws,
 		senderID: senderID,
 		convID:   convID,
-		out:      make(chan []byte, 256),
+		connID:   connID,
+		policy:   policy,
+		out:      make(chan outFrame, outboxSize),
+		presence: make(chan []byte, 1),
+		kick:     make(chan closeFrame, 1),
 	}
+	c.order = newReorder(reorderWait, c.deliver, c.gap)
 	go c.writeLoop()
 	return c
 }
 
 func (c *RuntimeClient) SenderID() string       { return c.senderID }
 func (c *RuntimeClient) ConversationID() string { return c.convID }
+func (c *RuntimeClient) ConnectionID() string   { return c.connID }
 
+// Send queues a frame without blocking; a full queue is handled by the client's policy.
 func (c *RuntimeClient) Send(ctx context.Context, data []byte) error {
+	return c.enqueue(ctx, outFrame{data: data})
+}
+
+// SendMessage queues a chat message once the seqs before it are accounted
+// for, or the reorder wait runs out. Its seq counts towards LastDeliveredSeq
+// once written.
+func (c *RuntimeClient) SendMessage(ctx context.Context, msg domain.ChatMessage) error {
+	if c.ctx.Err() != nil {
+		return ErrClientClosed
+	}
+	c.order.push(msg.Seq, slot{msg: &msg})
+	return nil
+}
+
+// SkipMessage accounts for a seq the client is not sent.
+func (c *RuntimeClient) SkipMessage(ctx context.Context, seq int64, known bool) {
+	c.order.push(seq, slot{known: known})
+}
+
+// deliver queues a message released by the reorder buffer.
+func (c *RuntimeClient) deliver(msg domain.ChatMessage) {
+	data, _ := json.Marshal(msg)
+	_ = c.enqueue(c.ctx, outFrame{data: data, seq: msg.Seq})
+}
+
+// gap tells the client that from..to will not arrive. They were never
+// written, so resume tokens must not count past them.
+func (c *RuntimeClient) gap(from, to int64) {
+	metrics.MessageGaps.Add(c.ctx, 1)
+	c.noteDropped(from)
+	data, _ := json.Marshal(domain.GapNotice{Type: domain.TypeGap, FromSeq: from, ToSeq: to})
+	_ = c.enqueue(c.ctx, outFrame{data: data})
+}
+
+func (c *RuntimeClient) enqueue(ctx context.Context, f outFrame) error {
+	if c.ctx.Err() != nil {
+		return ErrClientClosed
+	}
+	select {
+	case c.out <- f:
+		return nil
+	default:
+	}
+	if c.policy == PolicyDisconnect {
+		metrics.FramesDropped.Add(ctx, 1, metric.WithAttributes(attribute.String("policy", string(c.policy))))
+		c.Disconnect(domain.CloseSlowConsumer, domain.CloseReasonSlowConsumer)
+		return ErrSlowConsumer
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		select {
+		case c.out <- f:
+			return nil
+		default:
+		}
+		select {
+		case old := <-c.out:
+			metrics.FramesDropped.Add(ctx, 1, metric.WithAttributes(attribute.String("policy", string(c.policy))))
+			c.noteDropped(old.seq)
+		default:
+		}
+	}
+}
+
+// SendWait queues a chat message, waiting for room instead of applying the policy.
+// Used for replaying history, where the burst is expected.
+func (c *RuntimeClient) SendWait(ctx context.Context, seq int64, data []byte) error {
+	return c.enqueueWait(ctx, outFrame{data: data, seq: seq})
+}
+
+func (c *RuntimeClient) enqueueWait(ctx context.Context, f outFrame) error {
 	select {
-	case c.out <- data:
+	case c.out <- f:
 		return nil
 	case <-c.ctx.Done():
-		return errors.New("client closed")
+		return ErrClientClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SendPresence queues a presence snapshot. Under PolicyCoalescePresence a
+// pending snapshot is replaced rather than queued behind chat frames.
+func (c *RuntimeClient) SendPresence(ctx context.Context, data []byte) error {
+	if c.policy != PolicyCoalescePresence {
+		return c.Send(ctx, data)
+	}
+	if c.ctx.Err() != nil {
+		return ErrClientClosed
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.presence:
+		metrics.FramesDropped.Add(ctx, 1, metric.WithAttributes(attribute.String("policy", string(c.policy))))
+	default:
+	}
+	c.presence <- data
+	return nil
+}
+
+// HoldDelivered pins LastDeliveredSeq at seq while missed messages are
+// replayed: live frames may overtake the replay in the queue, so nothing counts
+// as delivered until ReleaseDelivered's marker has been written after them.
+// Live messages are held in seq order until then.
+// It must be called before the client is registered.
+func (c *RuntimeClient) HoldDelivered(seq int64) {
+	c.delivered.Store(seq)
+	c.hold.Store(true)
+	c.order.pause()
+}
+
+// ReleaseDelivered queues the end of the replay started by HoldDelivered and
+// releases the live messages that came after lastSeq, the last one replayed.
+func (c *RuntimeClient) ReleaseDelivered(ctx context.Context, lastSeq int64) {
+	_ = c.enqueueWait(ctx, outFrame{releaseAt: true})
+	c.order.resume(lastSeq)
+}
+
+// LastDeliveredSeq is the seq up to which every message meant for this client
+// was written to the socket, as far as the client can tell.
+func (c *RuntimeClient) LastDeliveredSeq() int64 {
+	seq := c.delivered.Load()
+	if d := c.dropped.Load(); d > 0 && d <= seq {
+		seq = d - 1
+	}
+	return seq
+}
+
+func (c *RuntimeClient) noteDropped(seq int64) {
+	for seq > 0 {
+		d := c.dropped.Load()
+		if (d != 0 && d <= seq) || c.dropped.CompareAndSwap(d, seq) {
+			return
+		}
 	}
 }
 
 func (c *RuntimeClient) Close() {
 	c.once.Do(func() {
+		c.order.stop()
 		c.cancel()
-		close(c.out)
 		c.ws.Close()
 	})
 }
 
+// Disconnect closes with the given close code; queued frames are flushed first
+// unless the client is being dropped for falling behind.
+func (c *RuntimeClient) Disconnect(code int, reason string) {
+	select {
+	case c.kick <- closeFrame{code: code, reason: reason, flush: code != domain.CloseSlowConsumer}:
+	default:
+	}
+}
+
 func (c *RuntimeClient) writeLoop() {
 	defer c.Close()
 	for {
 		select {
 		case <-c.ctx.Done():
 			return
-		case data, ok := <-c.out:
-			if !ok {
-				return
+		case f := <-c.kick:
+			if f.flush {
+				c.flush()
 			}
-			_ = c.ws.WriteMessage(data)
+			c.ws.CloseWithReason(f.code, f.reason)
+			return
+		case data := <-c.presence:
+			c.write(data)
+		case f := <-c.out:
+			c.writeFrame(f)
+		}
+	}
+}
+
+func (c *RuntimeClient) writeFrame(f outFrame) {
+	if f.releaseAt {
+		c.hold.Store(false)
+		if c.held > c.delivered.Load() {
+			c.delivered.Store(c.held)
+		}
+		return
+	}
+	if !c.write(f.data) || f.seq == 0 {
+		return
+	}
+	if c.hold.Load() {
+		c.held = max(c.held, f.seq)
+	} else if f.seq > c.delivered.Load() {
+		c.delivered.Store(f.seq)
+	}
+}
+
+func (c *RuntimeClient) write(data []byte) bool {
+	if err := c.ws.WriteMessage(data); err != nil {
+		return false
+	}
+	metrics.FramesOutbound.Add(c.ctx, 1)
+	return true
+}
+
+// flush writes whatever is already queued without blocking for more.
+func (c *RuntimeClient) flush() {
+	for {
+		select {
+		case f := <-c.out:
+			c.writeFrame(f)
+		default:
+			return
 		}
 	}
 }
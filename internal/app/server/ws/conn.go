@@ -2,7 +2,7 @@ package ws
 
 import (
 	"context"
-	"log"
+	"livon/internal/platform/logger"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -10,13 +10,29 @@ import (
 
 type WebSocket struct {
 	*websocket.Conn
-	ctx    context.Context
-	cancel context.CancelFunc
+	ctx          context.Context
+	cancel       context.CancelFunc
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	onAlive      func()
 }
 
-func NewWebSocket(parent context.Context, conn *websocket.Conn) *WebSocket {
+func NewWebSocket(parent context.Context, conn *websocket.Conn, pingInterval, pongTimeout time.Duration) *WebSocket {
 	ctx, cancel := context.WithCancel(parent)
-	return &WebSocket{Conn: conn, ctx: ctx, cancel: cancel}
+	return &WebSocket{
+		Conn:         conn,
+		ctx:          ctx,
+		cancel:       cancel,
+		pingInterval: pingInterval,
+		pongTimeout:  pongTimeout,
+		onAlive:      func() {},
+	}
+}
+
+// OnAlive registers a callback run whenever the peer proves it is alive
+// (a pong or any inbound frame). It must be set before ReadLoop starts.
+func (w *WebSocket) OnAlive(fn func()) {
+	w.onAlive = fn
 }
 
 func (w *WebSocket) WriteMessage(data []byte) error {
@@ -33,15 +49,27 @@ func (w *WebSocket) ReadLoop(onMsg func([]byte)) {
 	// Configure Read Limits (Protects against memory exhaustion)
 	w.Conn.SetReadLimit(512 * 1024) // 512KB max message size
 
+	// A peer that stops answering pings hits the read deadline and the loop exits,
+	// so half-open TCP connections don't linger.
+	w.extendDeadline()
+	w.Conn.SetPongHandler(func(string) error {
+		w.extendDeadline()
+		w.onAlive()
+		return nil
+	})
+	go w.pingLoop()
+
 	for {
 		_, data, err := w.Conn.ReadMessage()
 		if err != nil {
 			// Check if it's a clean closure or an error
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("Unexpected close error: %v", err)
+				logger.FromContext(w.ctx).WarnContext(w.ctx, "ws - read loop - unexpected close", logger.Err(err))
 			}
 			break // Exit the loop
 		}
+		w.extendDeadline()
+		w.onAlive()
 
 		if len(data) > 0 {
 			onMsg(data)
@@ -49,6 +77,37 @@ func (w *WebSocket) ReadLoop(onMsg func([]byte)) {
 	}
 }
 
+func (w *WebSocket) extendDeadline() {
+	if w.pongTimeout > 0 {
+		_ = w.Conn.SetReadDeadline(time.Now().Add(w.pongTimeout))
+	}
+}
+
+// pingLoop sends protocol pings; WriteControl is safe alongside the write loop.
+func (w *WebSocket) pingLoop() {
+	if w.pingInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(w.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// CloseWithReason sends a close frame carrying code and reason, then closes.
+func (w *WebSocket) CloseWithReason(code int, reason string) {
+	_ = w.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	w.Close()
+}
+
 func (w *WebSocket) Close() {
 	w.cancel()
 	_ = w.Conn.Close()
@@ -0,0 +1,55 @@
+package ws
+
+import (
+	"context"
+	"livon/internal/platform/metrics"
+)
+
+// Inbox processes the inbound frames of one connection on a single goroutine,
+// so frames are handled in the order the client sent them. Push blocks while
+// the queue is full, which stalls the read loop and lets TCP push back on the client.
+type Inbox struct {
+	ctx    context.Context
+	frames chan []byte
+	handle func([]byte)
+	done   chan struct{}
+}
+
+func NewInbox(ctx context.Context, size int, handle func([]byte)) *Inbox {
+	if size <= 0 {
+		size = 1
+	}
+	i := &Inbox{
+		ctx:    ctx,
+		frames: make(chan []byte, size),
+		handle: handle,
+		done:   make(chan struct{}),
+	}
+	go i.run()
+	return i
+}
+
+// Push queues a frame, blocking while the inbox is full.
+func (i *Inbox) Push(data []byte) {
+	select {
+	case i.frames <- data:
+		metrics.FramesInbound.Add(i.ctx, 1)
+		metrics.InboxDepth.Add(i.ctx, 1)
+	case <-i.ctx.Done():
+	}
+}
+
+// Close stops accepting frames and waits until queued ones are processed.
+// It must be called after the read loop has returned.
+func (i *Inbox) Close() {
+	close(i.frames)
+	<-i.done
+}
+
+func (i *Inbox) run() {
+	defer close(i.done)
+	for data := range i.frames {
+		metrics.InboxDepth.Add(i.ctx, -1)
+		i.handle(data)
+	}
+}
@@ -0,0 +1,161 @@
+package ws
+
+import (
+	"livon/internal/core/domain"
+	"slices"
+	"sync"
+	"time"
+)
+
+// reorder puts a connection's chat messages back in seq order. Messages reach
+// a node from whichever replica persisted them, so one can overtake another;
+// a message ahead of a missing seq is held for up to wait. When the wait runs
+// out the held messages are released anyway, each hole announced by gap.
+type reorder struct {
+	wait    time.Duration
+	deliver func(msg domain.ChatMessage)
+	gap     func(from, to int64)
+
+	mu      sync.Mutex
+	started bool  // last is set: by the first message, or by resume
+	paused  bool  // a replay is running; hold everything until resume
+	last    int64 // highest seq accounted for
+	prev    int64 // highest seq the client knows of, stamped as PrevSeq
+	pending map[int64]slot
+	gen     int // invalidates a timer that fired after being replaced
+	timer   *time.Timer
+}
+
+// slot is a held seq; msg is nil for a seq the connection is not sent.
+type slot struct {
+	msg   *domain.ChatMessage
+	known bool
+}
+
+func newReorder(wait time.Duration, deliver func(domain.ChatMessage), gap func(from, to int64)) *reorder {
+	return &reorder{
+		wait:    wait,
+		deliver: deliver,
+		gap:     gap,
+		pending: make(map[int64]slot),
+	}
+}
+
+// push releases seq and whatever it unblocks, or holds it behind a missing seq.
+func (r *reorder) push(seq int64, s slot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.started && !r.paused {
+		// A fresh connection has nothing to compare the first message with
+		r.started = true
+		r.last = seq - 1
+		r.prev = 0
+	}
+	if r.started && seq <= r.last {
+		// A duplicate, or a seq already reported as a gap
+		return
+	}
+	if _, ok := r.pending[seq]; ok {
+		return
+	}
+	r.pending[seq] = s
+	if !r.paused {
+		r.drain()
+	}
+}
+
+// pause holds every message, without a time limit, until resume.
+func (r *reorder) pause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paused = true
+	r.stopTimer()
+}
+
+// resume continues after a replay that ended at seq: held messages up to seq
+// were part of it, the rest are released in order.
+func (r *reorder) resume(seq int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paused = false
+	r.started = true
+	r.last = max(r.last, seq)
+	r.prev = max(r.prev, seq)
+	for s := range r.pending {
+		if s <= r.last {
+			delete(r.pending, s)
+		}
+	}
+	r.drain()
+}
+
+func (r *reorder) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopTimer()
+}
+
+// drain releases the run of consecutive seqs after last. The wait restarts
+// whenever it makes progress, so each hole gets the full wait.
+func (r *reorder) drain() {
+	progressed := false
+	for {
+		s, ok := r.pending[r.last+1]
+		if !ok {
+			break
+		}
+		delete(r.pending, r.last+1)
+		r.last++
+		r.release(r.last, s)
+		progressed = true
+	}
+	if len(r.pending) == 0 || progressed {
+		r.stopTimer()
+	}
+	if len(r.pending) > 0 && r.timer == nil {
+		gen := r.gen
+		r.timer = time.AfterFunc(r.wait, func() { r.expire(gen) })
+	}
+}
+
+// expire gives up on the missing seqs and releases everything held.
+func (r *reorder) expire(gen int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if gen != r.gen || r.paused {
+		return
+	}
+	r.timer = nil
+	seqs := make([]int64, 0, len(r.pending))
+	for seq := range r.pending {
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+	for _, seq := range seqs {
+		if seq > r.last+1 {
+			r.gap(r.last+1, seq-1)
+		}
+		r.last = seq
+		r.release(seq, r.pending[seq])
+		delete(r.pending, seq)
+	}
+}
+
+func (r *reorder) release(seq int64, s slot) {
+	if s.msg != nil {
+		msg := *s.msg
+		msg.PrevSeq = r.prev
+		r.deliver(msg)
+	}
+	if s.msg != nil || s.known {
+		r.prev = seq
+	}
+}
+
+func (r *reorder) stopTimer() {
+	r.gen++
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+}
@@ -0,0 +1,154 @@
+package ws
+
+import (
+	"livon/internal/core/domain"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// released records what a reorder hands on; the timer calls in from its own goroutine.
+type released struct {
+	mu    sync.Mutex
+	seqs  []int64
+	prevs []int64
+	gaps  [][2]int64
+}
+
+func (r *released) deliver(msg domain.ChatMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seqs = append(r.seqs, msg.Seq)
+	r.prevs = append(r.prevs, msg.PrevSeq)
+}
+
+func (r *released) gap(from, to int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gaps = append(r.gaps, [2]int64{from, to})
+}
+
+func (r *released) snapshot() ([]int64, []int64, [][2]int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.seqs), slices.Clone(r.prevs), slices.Clone(r.gaps)
+}
+
+// waitFor polls until n messages were released or a second has passed.
+func (r *released) waitFor(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if seqs, _, _ := r.snapshot(); len(seqs) >= n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	seqs, _, _ := r.snapshot()
+	t.Fatalf("released %v, want %d messages", seqs, n)
+}
+
+func newTestReorder(wait time.Duration) (*reorder, *released) {
+	out := &released{}
+	r := newReorder(wait, out.deliver, out.gap)
+	return r, out
+}
+
+func msg(seq int64) slot {
+	return slot{msg: &domain.ChatMessage{Seq: seq}}
+}
+
+func TestReorderPush(t *testing.T) {
+	type push struct {
+		seq  int64
+		slot slot
+	}
+	sent := func(seqs ...int64) []push {
+		out := make([]push, len(seqs))
+		for i, s := range seqs {
+			out[i] = push{s, msg(s)}
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		name      string
+		pushes    []push
+		wantSeqs  []int64
+		wantPrevs []int64
+	}{
+		{"in order", sent(1, 2, 3), []int64{1, 2, 3}, []int64{0, 1, 2}},
+		{"overtaken", sent(1, 3, 2), []int64{1, 2, 3}, []int64{0, 1, 2}},
+		{"duplicates", sent(1, 2, 2, 1, 3), []int64{1, 2, 3}, []int64{0, 1, 2}},
+		{"first message starts the run", sent(5, 7, 6), []int64{5, 6, 7}, []int64{0, 5, 6}},
+		{"known seq not sent", []push{{1, msg(1)}, {3, msg(3)}, {2, slot{known: true}}}, []int64{1, 3}, []int64{0, 2}},
+		{"unknown seq not sent", []push{{1, msg(1)}, {3, msg(3)}, {2, slot{}}}, []int64{1, 3}, []int64{0, 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, out := newTestReorder(time.Hour)
+			defer r.stop()
+			for _, p := range tc.pushes {
+				r.push(p.seq, p.slot)
+			}
+			seqs, prevs, gaps := out.snapshot()
+			if !slices.Equal(seqs, tc.wantSeqs) || !slices.Equal(prevs, tc.wantPrevs) {
+				t.Errorf("released seqs %v prevs %v, want %v and %v", seqs, prevs, tc.wantSeqs, tc.wantPrevs)
+			}
+			if len(gaps) != 0 {
+				t.Errorf("gaps %v before the wait ran out", gaps)
+			}
+		})
+	}
+}
+
+func TestReorderReleasesGapOnTimeout(t *testing.T) {
+	r, out := newTestReorder(20 * time.Millisecond)
+	defer r.stop()
+	r.push(1, msg(1))
+	r.push(4, msg(4))
+	r.push(6, msg(6))
+	if seqs, _, _ := out.snapshot(); !slices.Equal(seqs, []int64{1}) {
+		t.Fatalf("released %v before the wait ran out, want [1]", seqs)
+	}
+	out.waitFor(t, 3)
+	seqs, prevs, gaps := out.snapshot()
+	if !slices.Equal(seqs, []int64{1, 4, 6}) || !slices.Equal(prevs, []int64{0, 1, 4}) {
+		t.Errorf("released seqs %v prevs %v, want [1 4 6] and [0 1 4]", seqs, prevs)
+	}
+	if want := [][2]int64{{2, 3}, {5, 5}}; !slices.Equal(gaps, want) {
+		t.Errorf("gaps %v, want %v", gaps, want)
+	}
+	// A seq that arrives after its gap was reported is dropped
+	r.push(5, msg(5))
+	r.push(7, msg(7))
+	if seqs, _, _ := out.snapshot(); !slices.Equal(seqs, []int64{1, 4, 6, 7}) {
+		t.Errorf("released %v, want [1 4 6 7]", seqs)
+	}
+}
+
+func TestReorderPauseResume(t *testing.T) {
+	r, out := newTestReorder(20 * time.Millisecond)
+	defer r.stop()
+	r.pause()
+	r.push(3, msg(3))
+	r.push(4, msg(4))
+	r.push(6, msg(6))
+	// A pause has no time limit
+	time.Sleep(60 * time.Millisecond)
+	if seqs, _, _ := out.snapshot(); len(seqs) != 0 {
+		t.Fatalf("released %v while paused", seqs)
+	}
+	// The replay covered up to 4; 6 waits for 5
+	r.resume(4)
+	if seqs, _, _ := out.snapshot(); len(seqs) != 0 {
+		t.Fatalf("released %v right after resume, want nothing before 5", seqs)
+	}
+	r.push(5, msg(5))
+	seqs, prevs, gaps := out.snapshot()
+	if !slices.Equal(seqs, []int64{5, 6}) || !slices.Equal(prevs, []int64{4, 5}) {
+		t.Errorf("released seqs %v prevs %v, want [5 6] and [4 5]", seqs, prevs)
+	}
+	if len(gaps) != 0 {
+		t.Errorf("gaps %v, want none", gaps)
+	}
+}
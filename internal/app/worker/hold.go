@@ -0,0 +1,136 @@
+package worker
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// hold lists the entries of a conversation left pending after one of them
+// failed, oldest first. The first one blocks the conversation: nothing newer
+// is persisted until it is.
+type hold struct {
+	ids  []string
+	seen time.Time // when the blocking entry was last handed to the worker
+}
+
+// holds keeps the held conversations across reads. A partition is read by one
+// consumer, so a conversation's hold is only ever consulted by that consumer.
+type holds struct {
+	expiry time.Duration // a blocking entry not seen again for this long is gone
+
+	mu    sync.Mutex
+	convs map[uuid.UUID]*hold
+}
+
+// newHolds returns holds for a queue that redelivers pending entries after
+// claimIdle. A blocking entry comes back within about twice that; one that
+// does not was dead-lettered or purged, and its hold is dropped. Without
+// redelivery nothing would come back, so nothing is held.
+func newHolds(claimIdle time.Duration) *holds {
+	return &holds{expiry: 3 * claimIdle, convs: make(map[uuid.UUID]*hold)}
+}
+
+// admit splits the items of a conversation, in stream order, into those that
+// may be persisted now and those that must stay pending behind earlier
+// entries. It reports whether a hold was dropped because its blocking entry
+// never came back.
+func (h *holds) admit(convID uuid.UUID, items []batchItem) (run, wait []batchItem, expired bool) {
+	if h.expiry <= 0 {
+		return items, nil, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	for id, held := range h.convs {
+		if now.Sub(held.seen) > h.expiry {
+			delete(h.convs, id)
+			expired = expired || id == convID
+		}
+	}
+	held := h.convs[convID]
+	if held == nil {
+		return items, nil, expired
+	}
+	inBatch := make(map[string]bool, len(items))
+	for _, it := range items {
+		inBatch[it.id] = true
+	}
+	if !inBatch[held.ids[0]] {
+		return nil, items, expired
+	}
+	held.seen = now
+	// An entry runs only if no earlier held entry is missing from the batch
+	for i, it := range items {
+		for _, id := range held.ids {
+			if !inBatch[id] && streamIDBefore(id, it.id) {
+				return items[:i], items[i:], expired
+			}
+		}
+	}
+	return items, nil, expired
+}
+
+// settle records what became of the admitted items: processed ones, persisted
+// or rejected for their content, leave the hold; pending ones, from the first
+// failure on, join it.
+func (h *holds) settle(convID uuid.UUID, processed, pending []string) {
+	if h.expiry <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	held := h.convs[convID]
+	if held == nil {
+		if len(pending) == 0 {
+			return
+		}
+		held = &hold{}
+		h.convs[convID] = held
+	}
+	blocker := ""
+	if len(held.ids) > 0 {
+		blocker = held.ids[0]
+	}
+	held.ids = slices.DeleteFunc(held.ids, func(id string) bool { return slices.Contains(processed, id) })
+	for _, id := range pending {
+		if !slices.Contains(held.ids, id) {
+			held.ids = append(held.ids, id)
+		}
+	}
+	if len(held.ids) == 0 {
+		delete(h.convs, convID)
+		return
+	}
+	slices.SortFunc(held.ids, func(a, b string) int {
+		if streamIDBefore(a, b) {
+			return -1
+		}
+		if streamIDBefore(b, a) {
+			return 1
+		}
+		return 0
+	})
+	if held.ids[0] != blocker {
+		held.seen = time.Now()
+	}
+}
+
+// streamIDBefore orders entry ids. Every adapter's ids grow in stream order,
+// either as a number or as "<ms>-<seq>".
+func streamIDBefore(a, b string) bool {
+	aHi, aLo, _ := strings.Cut(a, "-")
+	bHi, bLo, _ := strings.Cut(b, "-")
+	ah, _ := strconv.ParseUint(aHi, 10, 64)
+	bh, _ := strconv.ParseUint(bHi, 10, 64)
+	if ah != bh {
+		return ah < bh
+	}
+	al, _ := strconv.ParseUint(aLo, 10, 64)
+	bl, _ := strconv.ParseUint(bLo, 10, 64)
+	return al < bl
+}
@@ -0,0 +1,296 @@
+package worker
+
+import (
+	"context"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
+	"livon/internal/core/services"
+	"livon/internal/platform/logger"
+	"log/slog"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PoolStats is a point-in-time view of the partitions a node consumes.
+type PoolStats struct {
+	Running    bool  `json:"running"`
+	Partitions int   `json:"partitions"` // partitions in the cluster
+	Consumers  int   `json:"consumers"`
+	Owned      []int `json:"owned"` // partitions leased by this node
+}
+
+// Pool runs a fixed number of stream consumers per node, whatever the number
+// of conversations. Conversations are hashed onto cfg.Partitions topics and
+// each partition is leased to one node at a time, so every conversation's
+// messages are persisted by exactly one consumer, in order. Live nodes take
+// roughly equal shares of the partitions and rebalance as nodes come and go.
+type Pool struct {
+	log    *slog.Logger
+	queue  contracts.MessageQueue
+	leases contracts.LeaseStore
+	worker contracts.AsyncWorker
+	cfg    config.WorkerConfig
+	node   string
+
+	mu       sync.Mutex
+	owned    map[int]bool   // leased partitions
+	dropping map[int]bool   // leased but withdrawn from the consumers
+	reading  []map[int]bool // per consumer, the partitions of its current read
+	cancel   context.CancelFunc
+	stopped  bool
+	running  atomic.Bool
+	done     chan struct{}
+}
+
+func NewPool(
+	log *slog.Logger,
+	queue contracts.MessageQueue,
+	leases contracts.LeaseStore,
+	worker contracts.AsyncWorker,
+	cfg config.WorkerConfig,
+	node string,
+) *Pool {
+	cfg.Partitions = max(cfg.Partitions, 1)
+	cfg.Consumers = max(cfg.Consumers, 1)
+	cfg.BatchSize = max(cfg.BatchSize, 1)
+	return &Pool{
+		log:      log,
+		queue:    queue,
+		leases:   leases,
+		worker:   worker,
+		cfg:      cfg,
+		node:     node,
+		owned:    make(map[int]bool),
+		dropping: make(map[int]bool),
+		reading:  make([]map[int]bool, cfg.Consumers),
+		done:     make(chan struct{}),
+	}
+}
+
+// Run consumes the partitions this node owns until Stop is called or ctx is
+// cancelled, then releases its leases so other nodes take over at once.
+func (p *Pool) Run(ctx context.Context) error {
+	defer close(p.done)
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return nil
+	}
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.mu.Unlock()
+	p.running.Store(true)
+	defer p.running.Store(false)
+	p.log.InfoContext(ctx, "worker pool - run - starting", slog.Int("consumers", p.cfg.Consumers), slog.Int("partitions", p.cfg.Partitions))
+	var consumers sync.WaitGroup
+	for i := range p.cfg.Consumers {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			if err := p.queue.ConsumeStreams(ctx, p.cfg.MessageGroup, p.cfg.BatchSize, p.topics(i), p.worker.ProcessBatch); err != nil {
+				p.log.ErrorContext(ctx, "worker pool - run - consumer failed", slog.Int("consumer", i), logger.Err(err))
+			}
+		}()
+	}
+	p.rebalance(ctx)
+	ticker := time.NewTicker(p.cfg.LeaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			consumers.Wait()
+			p.releaseAll(context.WithoutCancel(ctx))
+			p.log.InfoContext(ctx, "worker pool - run - stopped")
+			return nil
+		case <-ticker.C:
+			p.rebalance(ctx)
+		}
+	}
+}
+
+// Stop ends Run and waits until the consumers have finished the entries they
+// hold and the leases are released, or ctx expires.
+func (p *Pool) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	p.stopped = true
+	cancel := p.cancel
+	p.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Running reports whether the consumers are running.
+func (p *Pool) Running() bool {
+	return p.running.Load()
+}
+
+// Topics lists the stream topics of the partitions this node owns.
+func (p *Pool) Topics() []string {
+	parts := p.Stats().Owned
+	topics := make([]string, 0, len(parts))
+	for _, part := range parts {
+		topics = append(topics, services.PartitionTopic(part))
+	}
+	return topics
+}
+
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := PoolStats{
+		Running:    p.running.Load(),
+		Partitions: p.cfg.Partitions,
+		Consumers:  p.cfg.Consumers,
+		Owned:      make([]int, 0, len(p.owned)),
+	}
+	for part := range p.owned {
+		st.Owned = append(st.Owned, part)
+	}
+	sort.Ints(st.Owned)
+	return st
+}
+
+// topics returns the read set of consumer i: the owned partitions that hash
+// to it. Each call starts a new read, so the partitions it leaves out are no
+// longer being read by that consumer.
+func (p *Pool) topics(i int) func() []string {
+	return func() []string {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		reading := make(map[int]bool)
+		topics := make([]string, 0, len(p.owned)/p.cfg.Consumers+1)
+		for part := range p.owned {
+			if part%p.cfg.Consumers == i && !p.dropping[part] {
+				reading[part] = true
+				topics = append(topics, services.PartitionTopic(part))
+			}
+		}
+		p.reading[i] = reading
+		return topics
+	}
+}
+
+func (p *Pool) leaseKey(part int) string {
+	return "partition:" + p.cfg.MessageGroup + ":" + strconv.Itoa(part)
+}
+
+// rebalance renews the node's leases and moves its share towards
+// ceil(partitions / live nodes): extra partitions, and those whose lease was
+// lost, are withdrawn from the consumers and released once no consumer reads
+// them; missing ones are taken from the partitions nobody holds.
+func (p *Pool) rebalance(ctx context.Context) {
+	live, err := p.leases.Heartbeat(ctx, p.cfg.MessageGroup, p.node, p.cfg.LeaseTTL)
+	if err != nil {
+		if ctx.Err() == nil {
+			p.log.ErrorContext(ctx, "worker pool - rebalance - heartbeat failed", logger.Err(err))
+		}
+		return
+	}
+	target := (p.cfg.Partitions + max(live, 1) - 1) / max(live, 1)
+	p.mu.Lock()
+	held := make([]int, 0, len(p.owned))
+	for part := range p.owned {
+		held = append(held, part)
+	}
+	p.mu.Unlock()
+	for _, part := range held {
+		ok, err := p.leases.Acquire(ctx, p.leaseKey(part), p.node, p.cfg.LeaseTTL)
+		if err != nil {
+			// Keep consuming; the lease has until its TTL to be renewed
+			p.log.ErrorContext(ctx, "worker pool - rebalance - renew failed", slog.Int("partition", part), logger.Err(err))
+			continue
+		}
+		if !ok {
+			// A consumer may still be persisting its last read of the partition;
+			// it is withdrawn like a released one and forgotten once that read
+			// is over. The new owner leaves those entries to it until ClaimIdle.
+			p.mu.Lock()
+			lost := !p.dropping[part]
+			p.dropping[part] = true
+			p.mu.Unlock()
+			if lost {
+				p.log.WarnContext(ctx, "worker pool - rebalance - lease lost", slog.Int("partition", part))
+			}
+		}
+	}
+	p.mu.Lock()
+	var release []int
+	for part := range p.dropping {
+		if !p.reading[part%p.cfg.Consumers][part] {
+			release = append(release, part)
+			delete(p.dropping, part)
+			delete(p.owned, part)
+		}
+	}
+	active := make([]int, 0, len(p.owned))
+	for part := range p.owned {
+		if !p.dropping[part] {
+			active = append(active, part)
+		}
+	}
+	sort.Ints(active)
+	for len(active) > target {
+		part := active[len(active)-1]
+		active = active[:len(active)-1]
+		p.dropping[part] = true
+	}
+	p.mu.Unlock()
+	for _, part := range release {
+		if err := p.leases.Release(ctx, p.leaseKey(part), p.node); err != nil {
+			p.log.ErrorContext(ctx, "worker pool - rebalance - release failed", slog.Int("partition", part), logger.Err(err))
+		}
+		p.log.InfoContext(ctx, "worker pool - rebalance - partition released", slog.Int("partition", part))
+	}
+	// Start at a random partition so nodes joining together pick different ones
+	offset := rand.N(p.cfg.Partitions)
+	for i := 0; i < p.cfg.Partitions && len(active) < target; i++ {
+		part := (offset + i) % p.cfg.Partitions
+		p.mu.Lock()
+		mine := p.owned[part]
+		p.mu.Unlock()
+		if mine {
+			continue
+		}
+		ok, err := p.leases.Acquire(ctx, p.leaseKey(part), p.node, p.cfg.LeaseTTL)
+		if err != nil {
+			p.log.ErrorContext(ctx, "worker pool - rebalance - acquire failed", slog.Int("partition", part), logger.Err(err))
+			return
+		}
+		if !ok {
+			continue
+		}
+		p.mu.Lock()
+		p.owned[part] = true
+		p.mu.Unlock()
+		active = append(active, part)
+		p.log.InfoContext(ctx, "worker pool - rebalance - partition acquired", slog.Int("partition", part))
+	}
+}
+
+// releaseAll gives up every lease; the consumers must have stopped.
+func (p *Pool) releaseAll(ctx context.Context) {
+	p.mu.Lock()
+	held := make([]int, 0, len(p.owned))
+	for part := range p.owned {
+		held = append(held, part)
+	}
+	p.owned = make(map[int]bool)
+	p.dropping = make(map[int]bool)
+	p.mu.Unlock()
+	for _, part := range held {
+		if err := p.leases.Release(ctx, p.leaseKey(part), p.node); err != nil {
+			p.log.ErrorContext(ctx, "worker pool - release all - release failed", slog.Int("partition", part), logger.Err(err))
+		}
+	}
+}
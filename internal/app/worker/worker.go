@@ -3,84 +3,198 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"livon/internal/config"
 	"livon/internal/core/contracts"
 	"livon/internal/core/domain"
 	"livon/internal/core/services"
-	"livon/internal/plugins/redis"
+	"livon/internal/platform/logger"
+	"livon/internal/platform/metrics"
 	"log/slog"
+	"slices"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("conversation-worker")
+
 type ConversationWorker struct {
 	log      *slog.Logger
-	queue    redis.RedisMessageQueue
+	queue    contracts.MessageQueue
 	messages *services.MessageService
 	conGroup string
+	holds    *holds
 }
 
 func NewConversationWorker(
 	log *slog.Logger,
-	queue redis.RedisMessageQueue,
+	queue contracts.MessageQueue,
 	messages *services.MessageService,
-	conGroup string,
+	cfg config.WorkerConfig,
 ) contracts.AsyncWorker {
 	return &ConversationWorker{
 		log:      log,
 		queue:    queue,
 		messages: messages,
-		conGroup: conGroup,
+		conGroup: cfg.MessageGroup,
+		holds:    newHolds(cfg.ClaimIdle),
 	}
 }
 
 /*
 	type AsyncWorker interface {
-		// Run starts the consumer loop for a specific conversation partition
-		Run(ctx context.Context, convID string) error
-		// ProcessMessage receives messages from redis stream for conversation topic
-		// Send Ack to redis stream for message
-		// Executes messages.SaveAndBrodcast method
-		// Delete message from stream
-		ProcessMessage(ctx context.Context, msgID string, rawData []byte) error
+		// ProcessBatch receives a batch of entries from redis stream for a partition topic
+		// Executes messages.SaveAndBroadcastBatch once per conversation in the batch
+		// Send Ack to redis stream for the entries persisted.
+		// Delete them from stream; the others stay pending
+		ProcessBatch(ctx context.Context, topic string, entries []StreamEntry) error
 	}
 */
 
-func (w *ConversationWorker) Run(
-	ctx context.Context,
-	convID string,
-) error {
-	w.queue.SubscribeToStream(ctx, convID, w.conGroup, w.ProcessMessage)
-	w.log.InfoContext(ctx, "worker - process message - subscribe to stream success", "topic", convID, "group", w.conGroup)
-	return nil
+// batchItem is one decoded entry of a batch.
+type batchItem struct {
+	id      string
+	payload *domain.MessagePayload
 }
 
-func (w *ConversationWorker) ProcessMessage(
+func (w *ConversationWorker) ProcessBatch(
 	ctx context.Context,
-	messageID string, // Added messageID parameter
-	raw []byte,
+	topic string,
+	entries []contracts.StreamEntry,
 ) error {
-	var payload domain.MessagePayload
-	if err := json.Unmarshal(raw, &payload); err != nil {
-		w.log.Error("worker - process message - wrong payload")
-		return err
+	// Entries come from many producers, so the batch span links to each of
+	// their spans instead of continuing one of their traces.
+	links := make([]trace.Link, 0, len(entries))
+	for _, e := range entries {
+		producer := otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(e.Headers))
+		if sc := trace.SpanContextFromContext(producer); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
 	}
-	if err := w.messages.SaveAndBroadcast(ctx, &payload); err != nil {
-		w.log.ErrorContext(ctx, "worker - process message - save and broadcast failed", "message_id", messageID)
-		return err
+	ctx, span := tracer.Start(ctx, "ConversationWorker.ProcessBatch",
+		trace.WithNewRoot(),
+		trace.WithLinks(links...),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "redis"),
+			attribute.String("messaging.destination.name", topic),
+			attribute.String("messaging.consumer.group.name", w.conGroup),
+			attribute.Int("messaging.batch.message_count", len(entries)),
+		),
+	)
+	defer span.End()
+	metrics.StreamBatchSize.Record(ctx, int64(len(entries)))
+	// A partition carries many conversations; each is persisted in stream order
+	var convs []uuid.UUID
+	groups := make(map[uuid.UUID][]batchItem)
+	for _, e := range entries {
+		var payload domain.MessagePayload
+		if err := json.Unmarshal(e.Data, &payload); err != nil || payload.ConversationID == uuid.Nil {
+			// Left pending so it is retried on its own and dead-lettered once out of deliveries
+			span.AddEvent("wrong payload", trace.WithAttributes(attribute.String("messaging.message.id", e.ID)))
+			w.log.ErrorContext(ctx, "worker - process batch - wrong payload", slog.String("message_id", e.ID), logger.Err(err))
+			continue
+		}
+		if groups[payload.ConversationID] == nil {
+			convs = append(convs, payload.ConversationID)
+		}
+		groups[payload.ConversationID] = append(groups[payload.ConversationID], batchItem{id: e.ID, payload: &payload})
+	}
+	done := make([]string, 0, len(entries))
+	for _, convID := range convs {
+		items := groups[convID]
+		slices.SortFunc(items, func(a, b batchItem) int {
+			if streamIDBefore(a.id, b.id) {
+				return -1
+			}
+			return 1
+		})
+		// A conversation with an entry left pending by an earlier batch waits
+		// until that entry comes back, so nothing newer overtakes it
+		items, wait, expired := w.holds.admit(convID, items)
+		if expired {
+			w.log.WarnContext(ctx, "worker - process batch - held entry not redelivered, releasing conversation", logger.Conversation(convID.String()))
+		}
+		if len(wait) > 0 {
+			w.log.InfoContext(ctx, "worker - process batch - conversation waiting", logger.Conversation(convID.String()), slog.Int("entries", len(wait)))
+		}
+		if len(items) == 0 {
+			continue
+		}
+		payloads := make([]*domain.MessagePayload, len(items))
+		for i, it := range items {
+			payloads[i] = it.payload
+		}
+		var processed, pending []string
+		for _, it := range wait {
+			pending = append(pending, it.id)
+		}
+		if err := w.messages.SaveAndBroadcastBatch(ctx, payloads); err == nil {
+			for _, it := range items {
+				done = append(done, it.id)
+				processed = append(processed, it.id)
+			}
+			w.holds.settle(convID, processed, pending)
+			continue
+		}
+		// Nothing of the batch was kept; one transaction per entry isolates the bad ones
+		for i, it := range items {
+			err := w.messages.SaveAndBroadcast(ctx, it.payload)
+			if err == nil {
+				done = append(done, it.id)
+				processed = append(processed, it.id)
+				continue
+			}
+			span.AddEvent("save and broadcast failed", trace.WithAttributes(attribute.String("messaging.message.id", it.id)))
+			w.log.ErrorContext(ctx, "worker - process batch - save and broadcast failed", logger.Conversation(convID.String()), slog.String("message_id", it.id), logger.Err(err))
+			if malformed(err) {
+				processed = append(processed, it.id)
+				continue
+			}
+			// Later entries would take seqs ahead of this one; they stay
+			// pending with it, and the entries read after them wait behind it
+			for _, rest := range items[i:] {
+				pending = append(pending, rest.id)
+			}
+			w.log.WarnContext(ctx, "worker - process batch - conversation held back", logger.Conversation(convID.String()), slog.Int("entries", len(items)-i))
+			break
+		}
+		w.holds.settle(convID, processed, pending)
 	}
-	w.log.InfoContext(ctx, "worker - process message - save and broadcast sucess", "message_id", messageID)
-	// Acknowledge the message (XACK)
+	// Acknowledge the persisted entries (XACK)
 	// Now that the DB save is confirmed, tell Redis we are done.
-	// remove it from the Pending Entries List (PEL)
-	convIDStr := payload.ConversationID.String()
-	if err := w.queue.AcknowledgeMessage(ctx, convIDStr, w.conGroup, messageID); err != nil {
-		w.log.ErrorContext(ctx, "worker - process message - acknowledge message failed", "message_id", messageID)
+	// remove them from the Pending Entries List (PEL)
+	if err := w.queue.AcknowledgeMessage(ctx, topic, w.conGroup, done...); err != nil {
+		span.RecordError(err)
+		w.log.ErrorContext(ctx, "worker - process batch - acknowledge messages failed", slog.String("topic", topic), logger.Err(err))
 		return err
 	}
-	// Delete the message from the stream (XDEL)
+	// Delete the messages from the stream (XDEL)
 	// This keeps the stream memory-efficient.
-	if err := w.queue.DeleteMessage(ctx, convIDStr, messageID); err != nil {
-		// the message is already processed and ACKed.
-		w.log.ErrorContext(ctx, "worker - process message - delete message failed", "message_id", messageID)
+	if err := w.queue.DeleteMessage(ctx, topic, done...); err != nil {
+		// the messages are already processed and ACKed.
+		w.log.ErrorContext(ctx, "worker - process batch - delete messages failed", slog.String("topic", topic), logger.Err(err))
+	}
+	if failed := len(entries) - len(done); failed > 0 {
+		span.SetStatus(codes.Error, "entries left pending")
+		return fmt.Errorf("%d of %d entries left pending", failed, len(entries))
 	}
-	w.log.InfoContext(ctx, "worker - process message - acknowledge and delete message sucess", "message_id", messageID)
+	w.log.InfoContext(ctx, "worker - process batch - save and broadcast sucess", slog.String("topic", topic), slog.Int("entries", len(done)))
 	return nil
 }
+
+// malformed reports whether err comes from the entry itself rather than from
+// the database being unavailable: a missing conversation id, or rows the
+// database refused, such as a sender that is not a participant or an oversized
+// payload. Such an entry never persists, so it does not hold back the rest of
+// its conversation. It stays pending until dead-lettered.
+func malformed(err error) bool {
+	return errors.Is(err, domain.ErrInvalidConversationID) ||
+		errors.Is(err, domain.ErrMessageRejected)
+}
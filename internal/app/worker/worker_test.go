@@ -0,0 +1,212 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"livon/internal/core/contracts"
+	"livon/internal/core/domain"
+	"livon/internal/core/services"
+	"livon/internal/core/services/servicestest"
+	"livon/internal/plugins/memory"
+	"livon/internal/plugins/queuetest"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const topic = "worker-test"
+
+// consumeOnce publishes payloads to a fresh memory queue, hands the first
+// batch to a worker over msgs and returns the batch with the error
+// ProcessBatch gave.
+func consumeOnce(t *testing.T, msgs *servicestest.Messages, payloads ...domain.MessagePayload) (contracts.MessageQueue, []contracts.StreamEntry, error) {
+	t.Helper()
+	log := slog.New(slog.DiscardHandler)
+	cfg := queuetest.Config
+	queue := memory.NewMemoryMessageQueue(log, cfg)
+	tx := services.NewTxManager(log, servicestest.NewDB())
+	svc := services.NewMessageService(log, queue, &servicestest.Registry{}, memory.NewMemoryClusterBus(), msgs, tx, cfg)
+	w := NewConversationWorker(log, queue, svc, cfg)
+
+	ctx := context.Background()
+	for _, p := range payloads {
+		raw, _ := json.Marshal(p)
+		if err := queue.PublishToStream(ctx, topic, p.ConversationID.String(), raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var (
+		batch []contracts.StreamEntry
+		err   error
+	)
+	consumeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	queue.ConsumeStreams(consumeCtx, cfg.MessageGroup, cfg.BatchSize, func() []string { return []string{topic} },
+		func(ctx context.Context, topic string, entries []contracts.StreamEntry) error {
+			if batch == nil {
+				batch = entries
+				err = w.ProcessBatch(ctx, topic, entries)
+				cancel()
+			}
+			return nil
+		})
+	if batch == nil {
+		t.Fatal("no batch delivered")
+	}
+	return queue, batch, err
+}
+
+func payload(convID uuid.UUID, text string) domain.MessagePayload {
+	return domain.MessagePayload{
+		ClientMsgID:    uuid.NewString(),
+		ConversationID: convID,
+		SenderID:       uuid.New(),
+		Payload:        text,
+		CreatedAt:      time.Now(),
+	}
+}
+
+func texts(msgs []domain.Message) []string {
+	out := make([]string, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.Payload
+	}
+	return out
+}
+
+func pendingIDs(t *testing.T, queue contracts.MessageQueue) []string {
+	t.Helper()
+	pending, err := queue.PendingEntries(context.Background(), topic, queuetest.Config.MessageGroup, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(pending))
+	for i, p := range pending {
+		ids[i] = p.ID
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestProcessBatchPersistsEveryConversation(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	msgs := &servicestest.Messages{}
+	queue, _, err := consumeOnce(t, msgs, payload(a, "a1"), payload(b, "b1"), payload(a, "a2"))
+	if err != nil {
+		t.Fatalf("ProcessBatch: %v", err)
+	}
+	if got := texts(msgs.Saved(a)); !slices.Equal(got, []string{"a1", "a2"}) {
+		t.Errorf("conversation a saved %v", got)
+	}
+	if got := texts(msgs.Saved(b)); !slices.Equal(got, []string{"b1"}) {
+		t.Errorf("conversation b saved %v", got)
+	}
+	if ids := pendingIDs(t, queue); len(ids) != 0 {
+		t.Errorf("entries %v left pending", ids)
+	}
+}
+
+func TestProcessBatchHoldsBackConversationAfterFailure(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	msgs := &servicestest.Messages{Fail: func(m *domain.Message) error {
+		if m.Payload == "a2" {
+			return errors.New("connection reset")
+		}
+		return nil
+	}}
+	queue, batch, err := consumeOnce(t, msgs,
+		payload(a, "a1"), payload(b, "b1"), payload(a, "a2"), payload(b, "b2"), payload(a, "a3"))
+	if err == nil {
+		t.Fatal("ProcessBatch reported no pending entries")
+	}
+	// a3 must not take a seq ahead of a2
+	if got := texts(msgs.Saved(a)); !slices.Equal(got, []string{"a1"}) {
+		t.Errorf("conversation a saved %v, want [a1]", got)
+	}
+	if got := texts(msgs.Saved(b)); !slices.Equal(got, []string{"b1", "b2"}) {
+		t.Errorf("conversation b saved %v, want [b1 b2]", got)
+	}
+	want := []string{batch[2].ID, batch[4].ID}
+	slices.Sort(want)
+	if got := pendingIDs(t, queue); !slices.Equal(got, want) {
+		t.Errorf("pending %v, want a2 and a3 %v", got, want)
+	}
+}
+
+func TestProcessBatchSkipsMalformedEntry(t *testing.T) {
+	a := uuid.New()
+	msgs := &servicestest.Messages{Fail: func(m *domain.Message) error {
+		if m.Payload == "a2" {
+			return domain.ErrMessageRejected
+		}
+		return nil
+	}}
+	queue, batch, err := consumeOnce(t, msgs, payload(a, "a1"), payload(a, "a2"), payload(a, "a3"))
+	if err == nil {
+		t.Fatal("ProcessBatch reported no pending entries")
+	}
+	saved := msgs.Saved(a)
+	if got := texts(saved); !slices.Equal(got, []string{"a1", "a3"}) {
+		t.Errorf("saved %v, want [a1 a3]", got)
+	}
+	if len(saved) == 2 && (saved[0].Seq != 1 || saved[1].Seq != 2) {
+		t.Errorf("seqs %d and %d, want 1 and 2", saved[0].Seq, saved[1].Seq)
+	}
+	if got := pendingIDs(t, queue); !slices.Equal(got, []string{batch[1].ID}) {
+		t.Errorf("pending %v, want only a2 %s", got, batch[1].ID)
+	}
+}
+
+func TestProcessBatchKeepsConversationHeldAcrossReads(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	msgs := &servicestest.Messages{Fail: func(m *domain.Message) error {
+		if m.Payload == "a2" {
+			return errors.New("connection reset")
+		}
+		return nil
+	}}
+	log := slog.New(slog.DiscardHandler)
+	cfg := queuetest.Config
+	queue := memory.NewMemoryMessageQueue(log, cfg)
+	tx := services.NewTxManager(log, servicestest.NewDB())
+	svc := services.NewMessageService(log, queue, &servicestest.Registry{}, memory.NewMemoryClusterBus(), msgs, tx, cfg)
+	w := NewConversationWorker(log, queue, svc, cfg)
+
+	entry := func(id string, p domain.MessagePayload) contracts.StreamEntry {
+		raw, _ := json.Marshal(p)
+		return contracts.StreamEntry{ID: id, Data: raw}
+	}
+	a1, a2, a3, a4 := entry("1-0", payload(a, "a1")), entry("2-0", payload(a, "a2")), entry("3-0", payload(a, "a3")), entry("5-0", payload(a, "a4"))
+	b1 := entry("4-0", payload(b, "b1"))
+	ctx := context.Background()
+
+	// First read: a2 fails and a3 stays pending behind it
+	if err := w.ProcessBatch(ctx, topic, []contracts.StreamEntry{a1, a2, a3}); err == nil {
+		t.Fatal("first read reported no pending entries")
+	}
+	// Second read brings only newer entries; a4 must wait for a2, b1 must not
+	if err := w.ProcessBatch(ctx, topic, []contracts.StreamEntry{b1, a4}); err == nil {
+		t.Fatal("second read reported no pending entries")
+	}
+	if got := texts(msgs.Saved(a)); !slices.Equal(got, []string{"a1"}) {
+		t.Errorf("conversation a saved %v after the second read, want [a1]", got)
+	}
+	if got := texts(msgs.Saved(b)); !slices.Equal(got, []string{"b1"}) {
+		t.Errorf("conversation b saved %v, want [b1]", got)
+	}
+	// The redelivery of a2 without a3 releases a2 only
+	msgs.Fail = nil
+	if err := w.ProcessBatch(ctx, topic, []contracts.StreamEntry{a2, a4}); err == nil {
+		t.Fatal("redelivery without a3 reported no pending entries")
+	}
+	if err := w.ProcessBatch(ctx, topic, []contracts.StreamEntry{a4, a3}); err != nil {
+		t.Fatalf("redelivery of a3 and a4: %v", err)
+	}
+	if got := texts(msgs.Saved(a)); !slices.Equal(got, []string{"a1", "a2", "a3", "a4"}) {
+		t.Errorf("conversation a saved %v, want [a1 a2 a3 a4]", got)
+	}
+}
@@ -4,19 +4,40 @@ import "time"
 
 type Config struct {
 	Service     *ServiceConfig
+	Backend     *BackendConfig
 	Redis       *RedisConfig
+	NATS        *NATSConfig
 	Postgres    *PostgresConfig
 	Twilio      *TwilioConfig
 	Worker      *WorkerConfig
 	Logger      *LoggerConfig
 	Tracer      *TracerConfig
+	Metrics     *MetricsConfig
+	RateLimit   *RateLimitConfig
+	WebSocket   *WebSocketConfig
+	Admin       *AdminConfig
+	Invite      *InviteConfig
+	Session     *SessionConfig
 	SecretToken string
 }
 
 type ServiceConfig struct {
-	Name string
-	Env  string
-	Add  string
+	Name            string
+	Env             string
+	Add             string
+	ShutdownTimeout time.Duration // upper bound for the whole drain sequence
+	DrainDelay      time.Duration // readiness fails this long before the listener closes
+	ReconnectAfter  time.Duration // hint sent to clients when the node drains
+	ReconnectJitter time.Duration // random spread added to ReconnectAfter per client
+}
+
+// BackendConfig picks the adapters behind the shared state. Redis is only
+// dialled when one of them needs it; memory keeps the state in process and
+// suits a single node; postgres shares it through the database, leaving
+// Postgres as the only dependency.
+type BackendConfig struct {
+	State string // redis | memory | postgres: presence, cluster bus, resume tokens, partition leases
+	Queue string // redis | memory | nats | postgres: ingestion streams
 }
 
 type RedisConfig struct {
@@ -29,6 +50,13 @@ type RedisConfig struct {
 	PingTimeout  time.Duration
 }
 
+type NATSConfig struct {
+	URL            string
+	Stream         string // JetStream stream; dead letters go to <Stream>-deadletter
+	Replicas       int
+	ConnectTimeout time.Duration
+}
+
 type PostgresConfig struct {
 	DSN             string
 	MaxOpenConns    int
@@ -45,14 +73,95 @@ type TwilioConfig struct {
 }
 
 type WorkerConfig struct {
-	MessageGroup string
+	MessageGroup  string
+	ClaimIdle     time.Duration // pending entries idle this long are retried by another delivery
+	MaxDeliveries int64         // deliveries before an entry is moved to the dead-letter stream
+	Partitions    int           // stream topics conversations are hashed onto; fixed for the cluster's lifetime
+	Consumers     int           // stream consumers per node, sharing the partitions the node owns
+	LeaseTTL      time.Duration // a partition whose owner stops renewing is taken over after this
+	BatchSize     int           // stream entries read and persisted together per partition
 }
 
 type LoggerConfig struct {
-	Level  string
-	Format string
+	Level   string
+	Format  string
+	Modules string // per-module levels, "redis=debug,ws=warn"
 }
 
 type TracerConfig struct {
-	Address string
+	Address     string  // OTLP gRPC collector; empty disables the span exporter
+	SampleRatio float64 // fraction of new traces sampled; children follow their parent
+}
+
+type MetricsConfig struct {
+	Address        string // OTLP gRPC collector; empty disables the push exporter
+	ExportInterval time.Duration
+}
+
+type WebSocketConfig struct {
+	InboxSize          int    // inbound frames buffered per connection before the reader blocks
+	OutboxSize         int    // outbound frames buffered per connection before the slow-consumer policy applies
+	SlowConsumerPolicy string // drop_oldest | coalesce_presence | disconnect
+	PingInterval       time.Duration
+	PongTimeout        time.Duration // read deadline, extended on every pong or frame
+	ReorderWait        time.Duration // how long a message ahead of a missing seq is held before a gap is reported
+	// Admission control on upgrades
+	MaxHandshakes       int           // concurrent handshakes per node
+	GlobalMaxHandshakes int           // concurrent handshakes across the cluster, 0 disables the shared limit
+	HandshakeQueue      int           // upgrades allowed to wait for a slot before new ones are turned away
+	HandshakeWait       time.Duration // how long a queued upgrade waits for a slot
+	HandshakeTTL        time.Duration // a cluster slot not released within this is reclaimed
+	RetryBase           time.Duration // try_again_later backoff for a first attempt, doubled per attempt
+	RetryMax            time.Duration // cap on the try_again_later backoff
+}
+
+// clampKeepalive keeps the ping loop able to hold a healthy connection open:
+// a read deadline no longer than the ping interval would expire before the
+// pong to the next ping could arrive. Such a PongTimeout is raised to one
+// and a half intervals; a non-positive PingInterval falls back to 20s.
+func (c *WebSocketConfig) clampKeepalive() {
+	if c.PingInterval <= 0 {
+		c.PingInterval = 20 * time.Second
+	}
+	if c.PongTimeout <= c.PingInterval {
+		c.PongTimeout = c.PingInterval + c.PingInterval/2
+	}
+}
+
+// RateLimitConfig sets the limits each node enforces on its own connections;
+// nothing is shared between replicas.
+type RateLimitConfig struct {
+	Sender          RateLimit                    // per sender_id, whose devices may be on several nodes
+	Conversation    RateLimit                    // per conversation on this node, not across the cluster
+	Overrides       map[string]RateLimitOverride // keyed by conversation type
+	ViolationWindow time.Duration
+	MuteAfter       int
+	MuteDuration    time.Duration
+	DisconnectAfter int
+}
+
+// RateLimit describes a token bucket: Rate tokens per second, up to Burst.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type RateLimitOverride struct {
+	Sender       RateLimit
+	Conversation RateLimit
+}
+
+type AdminConfig struct {
+	Port  string
+	Token string // bearer token for the admin API; empty disables it
+}
+
+type InviteConfig struct {
+	Secret     string        // HMAC key for invite tokens; defaults to the JWT secret
+	DefaultTTL time.Duration // lifetime of an invite created without one
+	MaxTTL     time.Duration
+}
+
+type SessionConfig struct {
+	ResumeWindow time.Duration // how long a returning user gets their sender_id back, unless the conversation sets its own
 }
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadClampsPongTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		ping, pong string
+		wantPing   time.Duration
+		wantPong   time.Duration
+	}{
+		{"defaults", "", "", 20 * time.Second, 30 * time.Second},
+		{"longer pong kept", "10s", "45s", 10 * time.Second, 45 * time.Second},
+		{"equal raised", "20s", "20s", 20 * time.Second, 30 * time.Second},
+		{"shorter raised", "30s", "10s", 30 * time.Second, 45 * time.Second},
+		{"zero ping", "0s", "5s", 20 * time.Second, 30 * time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("WS_PING_INTERVAL", tc.ping)
+			t.Setenv("WS_PONG_TIMEOUT", tc.pong)
+			ws := Load().WebSocket
+			if ws.PingInterval != tc.wantPing || ws.PongTimeout != tc.wantPong {
+				t.Errorf("ping %v pong %v, want %v and %v", ws.PingInterval, ws.PongTimeout, tc.wantPing, tc.wantPong)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -28,3 +29,53 @@ func getEnvDuration(key string, fallback time.Duration) time.Duration {
 	}
 	return fallback
 }
+
+func getEnvFloat(key string, fallback float64) float64 {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// getEnvRateLimitOverrides parses "type=senderRate:senderBurst/convRate:convBurst"
+// entries separated by commas. Malformed entries are skipped.
+func getEnvRateLimitOverrides(key string) map[string]RateLimitOverride {
+	overrides := make(map[string]RateLimitOverride)
+	for _, entry := range strings.Split(getEnv(key, ""), ",") {
+		convType, limits, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || convType == "" {
+			continue
+		}
+		senderStr, convStr, ok := strings.Cut(limits, "/")
+		if !ok {
+			continue
+		}
+		sender, ok := parseRateLimit(senderStr)
+		if !ok {
+			continue
+		}
+		conv, ok := parseRateLimit(convStr)
+		if !ok {
+			continue
+		}
+		overrides[convType] = RateLimitOverride{Sender: sender, Conversation: conv}
+	}
+	return overrides
+}
+
+func parseRateLimit(s string) (RateLimit, bool) {
+	rateStr, burstStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return RateLimit{}, false
+	}
+	rate, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil {
+		return RateLimit{}, false
+	}
+	burst, err := strconv.Atoi(burstStr)
+	if err != nil {
+		return RateLimit{}, false
+	}
+	return RateLimit{Rate: rate, Burst: burst}, true
+}
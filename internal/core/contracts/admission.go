@@ -0,0 +1,12 @@
+package contracts
+
+import "context"
+
+// HandshakeGate bounds WebSocket handshakes in flight across every replica.
+type HandshakeGate interface {
+	// TryAcquire takes a slot for id and reports false when all are taken.
+	// Slots that are never released expire, so a crashed node cannot leak them.
+	TryAcquire(ctx context.Context, id string) (bool, error)
+	// Release frees the slot held by id.
+	Release(ctx context.Context, id string) error
+}
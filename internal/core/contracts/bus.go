@@ -0,0 +1,12 @@
+package contracts
+
+import "context"
+
+// ClusterBus is a fire-and-forget pub/sub channel shared by every replica.
+type ClusterBus interface {
+	// Publish delivers payload to every current subscriber of channel.
+	Publish(ctx context.Context, channel string, payload []byte) error
+	// Subscribe calls handler for each payload published on channel.
+	// It blocks until ctx is cancelled.
+	Subscribe(ctx context.Context, channel string, handler func(ctx context.Context, payload []byte)) error
+}
@@ -7,10 +7,14 @@ import (
 
 // For each converation, use ZSET to store presence info
 type PresenceStore interface {
-	// UpdateStatus sets the TTL-based keys in Redis
-	UpdateOnlineStatus(ctx context.Context, convID string, senderID string, ttl time.Duration) error
-	// GetOnlineParticipants returns a list of sender_ids currently active
+	// UpdateStatus sets the TTL-based keys in Redis for one connection of senderID
+	UpdateOnlineStatus(ctx context.Context, convID string, senderID string, connID string, ttl time.Duration) error
+	// RemoveOnlineStatus drops one connection; the sender stays online while another is fresh
+	RemoveOnlineStatus(ctx context.Context, convID string, senderID string, connID string) error
+	// GetOnlineParticipants returns a list of sender_ids with at least one active connection
 	GetOnlineParticipants(ctx context.Context, convID string) ([]string, error)
 	// Manual clean up
 	ClearConversation(ctx context.Context, convID string) error
+	// ListConversations returns the conversations that have presence entries on any node
+	ListConversations(ctx context.Context) ([]string, error)
 }
@@ -6,14 +6,57 @@ import (
 
 type MessageQueue interface {
 	// Producer side (Ingest Service)
-	PublishToStream(ctx context.Context, topic string, payload []byte) error
+	// PublishToStream appends payload to topic. key names the conversation the
+	// entry belongs to, since many conversations share a topic.
+	PublishToStream(ctx context.Context, topic string, key string, payload []byte) error
 	// Consumer side (Worker Service)
-	// SubscribeToStream handles the reliable reading from the Redis Stream
-	SubscribeToStream(ctx context.Context, topic string, conGroup string, handler func(ctx context.Context, messageID string, data []byte) error) error
-	// AcknowledgeMessage acknowledges redis stream that message is picked for processing
-	AcknowledgeMessage(ctx context.Context, convID, conGroup, mesgID string) error
-	// DeleteStream removes the message stream from redis
-	DeleteStream(ctx context.Context, convID string) error
-	// Deletes Message from redis stream
-	DeleteMessage(ctx context.Context, convID, mesgID string) error
+	// ConsumeStreams reads the topics returned by topics in batches of up to
+	// batchSize entries per topic, handed to handler in stream order. topics is
+	// called again before every read, so topics can be added and dropped while
+	// it runs. A newly added topic first takes over the entries still pending
+	// for conGroup, which its previous reader did not finish, before reading
+	// anything newer. Adapters shared by several nodes leave those entries
+	// until they have been idle for ClaimIdle, since a previous reader that
+	// lost the topic may still be persisting them. Entries stay pending until
+	// acknowledged.
+	// It blocks until ctx is cancelled; an entry already handed to handler is
+	// finished on an uncancelled context so shutdown never abandons it halfway.
+	ConsumeStreams(ctx context.Context, conGroup string, batchSize int, topics func() []string, handler func(ctx context.Context, topic string, entries []StreamEntry) error) error
+	// AcknowledgeMessage acknowledges redis stream that messages are processed
+	AcknowledgeMessage(ctx context.Context, topic, conGroup string, mesgIDs ...string) error
+	// PurgeKey removes every entry published under key from topic, its pending entries and its dead letters
+	PurgeKey(ctx context.Context, topic, conGroup, key string) error
+	// Deletes Messages from redis stream
+	DeleteMessage(ctx context.Context, topic string, mesgIDs ...string) error
+	// Backlog reports the stream length, lag and pending entries for a consumer group
+	Backlog(ctx context.Context, topic, conGroup string) (StreamBacklog, error)
+	// PendingEntries lists up to count entries delivered to conGroup but not acknowledged
+	PendingEntries(ctx context.Context, topic, conGroup string, count int64) ([]PendingEntry, error)
+	// DeadLetters counts the entries published under key that were set aside after exhausting their deliveries
+	DeadLetters(ctx context.Context, topic, key string) (int64, error)
+	// ReplayDeadLetters moves the dead-lettered entries published under key back onto the stream
+	ReplayDeadLetters(ctx context.Context, topic, key string) (int, error)
+}
+
+// StreamEntry is one entry read from a stream topic.
+type StreamEntry struct {
+	ID      string
+	Key     string // conversation the entry was published under
+	Data    []byte
+	Headers map[string]string // W3C trace context of the producer
+}
+
+// StreamBacklog describes a stream topic as seen by one consumer group.
+type StreamBacklog struct {
+	Length  int64 `json:"length"`  // entries currently in the stream
+	Lag     int64 `json:"lag"`     // entries not yet delivered to the group
+	Pending int64 `json:"pending"` // delivered but not acknowledged (PEL)
+}
+
+// PendingEntry is a stream entry delivered to a consumer but not yet acknowledged.
+type PendingEntry struct {
+	ID         string `json:"id"`
+	Consumer   string `json:"consumer"`
+	IdleMs     int64  `json:"idle_ms"`
+	Deliveries int64  `json:"deliveries"`
 }
@@ -9,13 +9,24 @@ import (
 // client connections and bridges Redis events to the local hubs.
 type Registry interface {
 	// Register adds a client to the local node memory and joins them to their room.
+	// A sender may register several clients, one per device.
 	Register(c Client)
 	// Unregister removes the client and cleans up their room participation.
 	Unregister(c Client)
-	// SendAck targets a specific local client to deliver a received or delivery confirmation.
+	// SendAck delivers a received or delivery confirmation to every local device of senderID.
 	SendAck(ctx context.Context, senderID string, ack domain.AckMessage)
-	// Broadcast sends a message to all local clients in a room except the sender.
-	Broadcast(ctx context.Context, convID string, msg domain.ChatMessage)
+	// Broadcast sends a message to all local clients in a room except the
+	// connection it was sent from and those who blocked its author.
+	Broadcast(ctx context.Context, convID string, msg domain.ChatMessage, fromConnID string)
+	// BroadcastPresence sends the room's online snapshot to all local clients in it.
+	BroadcastPresence(ctx context.Context, convID string, ev domain.PresenceEvent)
+	// BroadcastSystem sends a room event to every local client in the room; events
+	// carrying a message skip those who blocked its author.
+	BroadcastSystem(ctx context.Context, convID string, ev domain.SystemEvent)
+	// DisconnectSender closes every local connection of senderID and reports whether there were any.
+	DisconnectSender(senderID string, code int, reason string) bool
+	// DisconnectConversation closes every local connection in a room and reports how many.
+	DisconnectConversation(convID string, code int, reason string) int
 }
 
 // Client represents the minimal interface required for the Registry to
@@ -23,6 +34,20 @@ type Registry interface {
 type Client interface {
 	SenderID() string
 	ConversationID() string
+	// ConnectionID tells apart the devices of one sender
+	ConnectionID() string
+	// Send must not block; a full outbound queue is handled by the client's slow-consumer policy.
 	Send(ctx context.Context, data []byte) error
+	// SendMessage queues a chat message in seq order, stamping its PrevSeq for
+	// this connection; its seq is tracked for resume tokens.
+	SendMessage(ctx context.Context, msg domain.ChatMessage) error
+	// SkipMessage accounts for a seq this connection is not sent, so it is not
+	// reported as a gap. known is set when the client learns the seq another
+	// way, as the author's connection does from its ack.
+	SkipMessage(ctx context.Context, seq int64, known bool)
+	// SendPresence may coalesce with a pending presence frame.
+	SendPresence(ctx context.Context, data []byte) error
+	// Disconnect flushes queued frames and closes with a WebSocket close code.
+	Disconnect(code int, reason string)
 	Close()
 }
@@ -0,0 +1,16 @@
+package contracts
+
+import (
+	"context"
+	"livon/internal/core/domain"
+	"time"
+)
+
+// ResumeStore keeps the state behind resume tokens where every replica can read it.
+type ResumeStore interface {
+	// Save stores or replaces the state behind token for ttl.
+	Save(ctx context.Context, token string, state domain.ResumeState, ttl time.Duration) error
+	// Take returns the state behind token and deletes it, so a token is used at
+	// most once. Unknown or expired tokens give domain.ErrResumeInvalid.
+	Take(ctx context.Context, token string) (*domain.ResumeState, error)
+}
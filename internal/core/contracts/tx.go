@@ -0,0 +1,21 @@
+package contracts
+
+import (
+	"context"
+	"database/sql"
+)
+
+// txKey carries the transaction opened by the service layer down to the
+// repositories; both sides must use the same key for statements to join it.
+type txKey struct{}
+
+// ContextWithTx returns a copy of ctx that carries tx.
+func ContextWithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// TxFromContext returns the transaction carried by ctx, if any.
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
+	return tx, ok
+}
@@ -1,13 +1,27 @@
 package contracts
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type AsyncWorker interface {
-	// Run starts the consumer loop for a specific conversation or partition
-	Run(ctx context.Context, convID string) error
-	// ProcessMessage receives messages from redis stream for conversation topic
-	// Send Ack to redis stream for message.
-	// Executes messages.SaveAndBrodcast method
-	// Delete message from stream
-	ProcessMessage(ctx context.Context, msgID string, rawData []byte) error
+	// ProcessBatch receives a batch of entries from redis stream for a partition topic
+	// Executes messages.SaveAndBroadcastBatch once per conversation in the batch
+	// Send Ack to redis stream for the entries persisted.
+	// Delete them from stream; the others stay pending
+	ProcessBatch(ctx context.Context, topic string, entries []StreamEntry) error
+}
+
+// LeaseStore hands out expiring leases so that at most one node owns a
+// partition at a time.
+type LeaseStore interface {
+	// Acquire takes key for owner for ttl unless another owner holds it.
+	// An owner that already holds key renews it.
+	Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+	// Release gives key up if owner still holds it.
+	Release(ctx context.Context, key, owner string) error
+	// Heartbeat marks member of group alive for ttl and returns how many
+	// members are alive, member included.
+	Heartbeat(ctx context.Context, group, member string, ttl time.Duration) (int, error)
 }
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Visibility decides who may join a conversation.
+type Visibility string
+
+const (
+	// VisibilityPublic lets anyone with the conversation ID join.
+	VisibilityPublic Visibility = "public"
+	// VisibilityPrivate admits members and holders of a valid invite.
+	VisibilityPrivate Visibility = "private"
+)
+
+// Valid reports whether v is a known visibility.
+func (v Visibility) Valid() bool {
+	return v == VisibilityPublic || v == VisibilityPrivate
+}
+
+// Invite admits its bearer to a private conversation. The token handed out is
+// signed and carries the expiry; the row allows revocation and single use.
+type Invite struct {
+	ID             uuid.UUID
+	ConversationID uuid.UUID
+	CreatedBy      uuid.UUID // sender_id of the inviter
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	SingleUse      bool
+	UsedAt         *time.Time
+	RevokedAt      *time.Time
+}
@@ -19,10 +19,19 @@ func NewUser(id string) *User {
 	}
 }
 
+// Conversation types select per-type policies such as rate limits.
+const (
+	ConversationTypeGroup = "group"
+)
+
 // Conversation represents a chat room
 type Conversation struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
+	ID             uuid.UUID
+	Type           string
+	Visibility     Visibility
+	IdentityPolicy IdentityPolicy
+	ResumeWindow   time.Duration // zero uses the server default
+	CreatedAt      time.Time
 }
 
 func NewConversation() (*Conversation, error) {
@@ -32,8 +41,10 @@ func NewConversation() (*Conversation, error) {
 		return &Conversation{}, err
 	}
 	return &Conversation{
-		ID:        id,
-		CreatedAt: time.Now(),
+		ID:             id,
+		Type:           ConversationTypeGroup,
+		IdentityPolicy: IdentityResume,
+		CreatedAt:      time.Now(),
 	}, nil
 }
 
@@ -45,6 +56,9 @@ type Participant struct {
 	JoinedAt       time.Time
 	LastSeenAt     time.Time
 	LeftAt         *time.Time // Nullable
+	Role           Role
+	DisplayName    string // Pseudonym, unique within the conversation
+	AvatarSeed     string
 }
 
 // Message represents a chat entry with its ordering sequence
@@ -55,6 +69,9 @@ type Message struct {
 	Seq            int64     // The strict monotonic counter
 	Payload        string
 	CreatedAt      time.Time
+	EditedAt       *time.Time // Nullable
+	SenderName     string     // Participant.DisplayName, joined in on read
+	SenderAvatar   string     // Participant.AvatarSeed, joined in on read
 }
 
 // Session represents the active connection context for a user in a room.
@@ -65,4 +82,16 @@ type Session struct {
 	SenderID       uuid.UUID // The Participant.ID (anonymous)
 	JoinedAt       time.Time
 	IsNewIdentity  bool // Useful for the frontend to know if identity changed
+	Role           Role
+	DisplayName    string
+	AvatarSeed     string
+	ConnectionID   string // This socket; a sender may be connected from several devices
+	// ConversationType selects the conversation's rate limits
+	ConversationType string
+	// Resume token handed out in the handshake; empty where identities are never resumed
+	ResumeToken  string
+	ResumeWindow time.Duration // lifetime of ResumeToken after the socket closes
+	Resumed      bool          // reconnected with a resume token, skipping identity resolution
+	ResumeSeq    int64         // messages after this seq are replayed on connect
+	ReplaySince  time.Time     // messages created before it are left out of the replay
 }
@@ -1,6 +1,9 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	ErrInvalidConversationID     = errors.New("invalid conversation id")
@@ -11,4 +14,52 @@ var (
 	ErrParticipantNotFound       = errors.New("participant not found")
 	ErrInvalidUserID             = errors.New("invalid user id")
 	ErrUserNotFound              = errors.New("user not found")
+	ErrRateLimited               = errors.New("rate limited")
+	ErrPermissionDenied          = errors.New("permission denied")
+	ErrMessageNotFound           = errors.New("message not found")
+	ErrMessageRejected           = errors.New("message rejected by the database")
+	ErrInvalidRole               = errors.New("invalid role")
+	ErrInvalidFrame              = errors.New("invalid frame")
+	ErrBanned                    = errors.New("banned from conversation")
+	ErrMuted                     = errors.New("muted")
+	ErrRestrictionNotFound       = errors.New("restriction not found")
+	ErrInviteRequired            = errors.New("invite required")
+	ErrInviteInvalid             = errors.New("invalid or expired invite")
+	ErrInviteNotFound            = errors.New("invite not found")
+	ErrInvalidDisplayName        = errors.New("invalid display name")
+	ErrDisplayNameTaken          = errors.New("display name taken")
+	ErrResumeInvalid             = errors.New("invalid or expired resume token")
 )
+
+// RateLimitAction is the escalation applied to a sender that exceeds its limits.
+type RateLimitAction string
+
+const (
+	RateLimitDrop       RateLimitAction = "drop"
+	RateLimitMute       RateLimitAction = "mute"
+	RateLimitDisconnect RateLimitAction = "disconnect"
+)
+
+// RateLimitError carries the retry hint and escalation for a rejected frame.
+type RateLimitError struct {
+	Scope      string // "sender" or "conversation"
+	Action     RateLimitAction
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return "rate limited (" + e.Scope + "): " + string(e.Action)
+}
+
+func (e *RateLimitError) Unwrap() error { return ErrRateLimited }
+
+// MutedError rejects a message.send from a muted participant.
+type MutedError struct {
+	Until time.Time
+}
+
+func (e *MutedError) Error() string {
+	return "muted until " + e.Until.UTC().Format(time.RFC3339)
+}
+
+func (e *MutedError) Unwrap() error { return ErrMuted }
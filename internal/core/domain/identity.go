@@ -0,0 +1,44 @@
+package domain
+
+import "time"
+
+// IdentityPolicy decides whether a returning user gets their sender_id back.
+type IdentityPolicy string
+
+const (
+	// IdentityResume hands the identity back within the resume window, unless
+	// the client asks for a new one.
+	IdentityResume IdentityPolicy = "resume"
+	// IdentitySticky always hands the identity back; clients cannot opt out.
+	IdentitySticky IdentityPolicy = "sticky"
+	// IdentityAlwaysNew gives every connection a new identity.
+	IdentityAlwaysNew IdentityPolicy = "always_new"
+)
+
+// Valid reports whether p is a known identity policy.
+func (p IdentityPolicy) Valid() bool {
+	return p == IdentityResume || p == IdentitySticky || p == IdentityAlwaysNew
+}
+
+// Resumes reports whether p, the user's active identity in c, is handed back
+// on connect. defaultWindow applies when c has no resume window of its own.
+func (c *Conversation) Resumes(p *Participant, forceNew bool, defaultWindow time.Duration) bool {
+	switch c.IdentityPolicy {
+	case IdentitySticky:
+		return true
+	case IdentityAlwaysNew:
+		return false
+	}
+	if forceNew {
+		return false
+	}
+	return time.Since(p.LastSeenAt) <= c.ResumeWindowOr(defaultWindow)
+}
+
+// ResumeWindowOr returns c's resume window, or defaultWindow if it has none.
+func (c *Conversation) ResumeWindowOr(defaultWindow time.Duration) time.Duration {
+	if c.ResumeWindow > 0 {
+		return c.ResumeWindow
+	}
+	return defaultWindow
+}
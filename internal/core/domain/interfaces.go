@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -16,20 +17,70 @@ type UserRepository interface {
 // Conversation repository handles conversation lifecycle.
 type ConversationRepository interface {
 	GetConversationByID(ctx context.Context, convID uuid.UUID) (*Conversation, error)
-	CreateConversation(ctx context.Context, convID uuid.UUID) (*Conversation, error)
+	// CreateConversation ensures the conversation exists; created is false if it already did
+	CreateConversation(ctx context.Context, convID uuid.UUID) (conv *Conversation, created bool, err error)
 	DeleteConversation(ctx context.Context, convID uuid.UUID) error
+	// UpdateType changes the conversation type (room settings)
+	UpdateType(ctx context.Context, convID uuid.UUID, convType string) error
+	// UpdateVisibility switches the conversation between public and private
+	UpdateVisibility(ctx context.Context, convID uuid.UUID, visibility Visibility) error
+	// UpdateIdentityPolicy sets how returning users get their identity back; a zero window uses the server default
+	UpdateIdentityPolicy(ctx context.Context, convID uuid.UUID, policy IdentityPolicy, window time.Duration) error
 }
 
 // ConversationParticipantRepository handles the Privacy Bridge and Presence
 type ConversationParticipantRepository interface {
-	// Rejoin Logic - finds active session within the 5-min window
+	// Rejoin Logic - finds the user's active identity, whether or not it may be resumed
 	FindRecentParticipant(ctx context.Context, userID string, convID uuid.UUID) (*Participant, error)
-	// Identity Creation - Assigns a new sender_id (Participant.ID)
+	// Identity Creation - Assigns a new sender_id (Participant.ID);
+	// ErrDisplayNameTaken if the pseudonym is in use in the conversation
 	CreateParticipant(ctx context.Context, p *Participant) error
 	// Presence - High-durability last_seen_at sync (the 5-min PG sync)
 	UpdatePresence(ctx context.Context, participantID uuid.UUID) error
+	// LockIdentity serialises identity resolution for a user in a conversation
+	// until the surrounding transaction ends
+	LockIdentity(ctx context.Context, userID string, convID uuid.UUID) error
 	// Mark permanent leave left_at
 	MarkLeft(ctx context.Context, participantID uuid.UUID) error
+	// GetParticipant loads a participant by sender_id
+	GetParticipant(ctx context.Context, participantID uuid.UUID) (*Participant, error)
+	// SetRole changes a participant's role
+	SetRole(ctx context.Context, participantID uuid.UUID, role Role) error
+	// ListParticipants loads the given participants of a conversation
+	ListParticipants(ctx context.Context, convID uuid.UUID, participantIDs []uuid.UUID) ([]Participant, error)
+}
+
+// ConversationRestrictionRepository stores bans and mutes against the hidden user_id
+type ConversationRestrictionRepository interface {
+	// Restrict creates or replaces the restriction of its kind
+	Restrict(ctx context.Context, r *Restriction) error
+	// Lift removes a restriction; lifting one that does not exist is not an error
+	Lift(ctx context.Context, convID uuid.UUID, userID string, kind RestrictionKind) error
+	// GetActiveRestriction returns ErrRestrictionNotFound unless an unexpired restriction exists
+	GetActiveRestriction(ctx context.Context, convID uuid.UUID, userID string, kind RestrictionKind) (*Restriction, error)
+}
+
+// ConversationAccessRepository holds private conversation members and invites
+type ConversationAccessRepository interface {
+	AddMember(ctx context.Context, convID uuid.UUID, userID string) error
+	RemoveMember(ctx context.Context, convID uuid.UUID, userID string) error
+	IsMember(ctx context.Context, convID uuid.UUID, userID string) (bool, error)
+	// AddActiveParticipants makes everyone currently in the conversation a member
+	AddActiveParticipants(ctx context.Context, convID uuid.UUID) error
+	CreateInvite(ctx context.Context, inv *Invite) error
+	// RedeemInvite consumes a use; ErrInviteInvalid if it is unknown, expired, revoked or used up
+	RedeemInvite(ctx context.Context, convID, inviteID uuid.UUID) error
+	RevokeInvite(ctx context.Context, convID, inviteID uuid.UUID) error
+}
+
+// BlockRepository relates hidden user_ids; callers only ever hold sender_ids
+type BlockRepository interface {
+	// Block records that blockerID blocks blockedID, placed through the sender_id via
+	Block(ctx context.Context, blockerID, blockedID string, via uuid.UUID) error
+	// Unblock removes the block placed through via, if any
+	Unblock(ctx context.Context, blockerID string, via uuid.UUID) error
+	// BlockedUsers returns the user_ids blockerID has blocked
+	BlockedUsers(ctx context.Context, blockerID string) ([]string, error)
 }
 
 // MessageRepository handles Persistence and Guaranteed Ordering
@@ -37,7 +88,16 @@ type MessageRepository interface {
 	// Atomic Persistence: Increments sequence and inserts message in one TX
 	// This fulfills the "Double Tick" requirement by returning the final Seq
 	SaveWithSequence(ctx context.Context, msg *Message) (seq int64, err error)
+	// Batch Persistence: takes one block of consecutive seqs for msgs of one
+	// conversation and inserts them in slice order; fills in Seq and the sender's pseudonym
+	SaveBatchWithSequence(ctx context.Context, convID uuid.UUID, msgs []*Message) error
 	// Visibility Logic: Join-Onward + Recent 1-min Window
 	// Uses the Participant.JoinedAt and current time to filter history
 	GetVisibleMessages(ctx context.Context, convID uuid.UUID) ([]Message, error)
+	// Resync: messages with seq greater than afterSeq created at or after since, oldest first
+	GetMessagesAfter(ctx context.Context, convID uuid.UUID, afterSeq int64, since time.Time, limit int) ([]Message, error)
+	// GetMessageBySeq loads one message of a conversation
+	GetMessageBySeq(ctx context.Context, convID uuid.UUID, seq int64) (*Message, error)
+	// EditMessage replaces the payload, keeping the seq, and sets edited_at
+	EditMessage(ctx context.Context, convID uuid.UUID, seq int64, payload string) (*Message, error)
 }
@@ -12,6 +12,65 @@ const (
 	TypePresence  = "presence"
 	TypeHandshake = "handshake"
 	TypeError     = "error"
+	TypeReconnect = "reconnect"
+	TypeSystem    = "system"
+	TypeGap       = "gap"
+)
+
+// Inbound frame types (client → server). A frame without a type is a message.send.
+const (
+	FrameMessageSend = "message.send"
+	FrameMessageEdit = "message.edit"
+	FrameRoleSet     = "role.set"
+	FrameRoomUpdate  = "room.update"
+	FrameKick        = "participant.kick"
+	FrameBan         = "participant.ban"
+	FrameUnban       = "participant.unban"
+	FrameMute        = "participant.mute"
+	FrameUnmute      = "participant.unmute"
+)
+
+// System events broadcast to a room. They identify participants only by sender_id.
+const (
+	EventRoleChanged   = "role_changed"
+	EventRoomUpdated   = "room_updated"
+	EventMessageEdited = "message_edited"
+	EventKicked        = "participant_kicked"
+	EventBanned        = "participant_banned"
+	EventUnbanned      = "participant_unbanned"
+	EventMuted         = "participant_muted"
+	EventUnmuted       = "participant_unmuted"
+)
+
+// WebSocket close codes (4000-4999 are reserved for applications)
+const (
+	CloseSlowConsumer        = 4008
+	CloseReasonSlowConsumer  = "slow_consumer"
+	CloseReasonGoingAway     = "going_away"      // sent with 1001 during drains
+	CloseReasonTryAgainLater = "try_again_later" // sent with 1013 when admission control turns an upgrade away
+
+	CloseAdminDisconnect          = 4009
+	CloseReasonAdminDisconnect    = "admin_disconnect"
+	CloseConversationClosed       = 4010
+	CloseReasonConversationClosed = "conversation_closed"
+	CloseKicked                   = 4011
+	CloseReasonKicked             = "kicked"
+	CloseBanned                   = 4012
+	CloseReasonBanned             = "banned"
+	CloseInviteRequired           = 4013
+	CloseReasonInviteRequired     = "invite_required"
+	CloseDisplayNameRejected      = 4014
+	CloseReasonDisplayNameTaken   = "display_name_taken"
+	CloseReasonInvalidDisplayName = "invalid_display_name"
+)
+
+// Error codes sent in ErrorMessage.Code
+const (
+	ErrCodeRateLimited = "rate_limited"
+	ErrCodeForbidden   = "forbidden"
+	ErrCodeNotFound    = "not_found"
+	ErrCodeBadRequest  = "bad_request"
+	ErrCodeMuted       = "muted"
 )
 
 type AckStatus string
@@ -26,6 +85,33 @@ type HandshakeResponse struct {
 	Type          string `json:"type"` // "handshake"
 	SenderID      string `json:"sender_id"`
 	IsNewIdentity bool   `json:"is_new_identity"`
+	Role          Role   `json:"role"`
+	DisplayName   string `json:"display_name"`
+	AvatarSeed    string `json:"avatar_seed"`
+	// ResumeToken reconnects to this identity with ?resume= while it is valid
+	ResumeToken string `json:"resume_token,omitempty"`
+	Resumed     bool   `json:"resumed"`
+}
+
+// InboundFrame is any frame a client sends; which fields apply depends on Type.
+type InboundFrame struct {
+	Type        string        `json:"type,omitempty"`
+	ClientMsgID string        `json:"client_msg_id,omitempty"` // message.send
+	Payload     string        `json:"payload,omitempty"`       // message.send, message.edit
+	Seq         int64         `json:"seq,omitempty"`           // message.edit
+	SenderID    string        `json:"sender_id,omitempty"`     // role.set and participant.* target
+	Role        Role          `json:"role,omitempty"`          // role.set
+	Settings    *RoomSettings `json:"settings,omitempty"`      // room.update
+	DurationSec int64         `json:"duration_sec,omitempty"`  // participant.mute
+}
+
+// RoomSettings are the conversation settings owners may change.
+type RoomSettings struct {
+	Type           string         `json:"type,omitempty"`
+	Visibility     Visibility     `json:"visibility,omitempty"`
+	IdentityPolicy IdentityPolicy `json:"identity_policy,omitempty"`
+	// ResumeWindowSec overrides the server's resume window; 0 restores the default
+	ResumeWindowSec *int64 `json:"resume_window_sec,omitempty"`
 }
 
 // MessagePayload structure received after processing user message.
@@ -35,6 +121,8 @@ type MessagePayload struct {
 	SenderID       uuid.UUID `json:"sender_id"`
 	Payload        string    `json:"payload"`
 	CreatedAt      time.Time `json:"created_at"`
+	// ConnectionID is the device it was sent from; the sender's other devices get it echoed
+	ConnectionID string `json:"connection_id,omitempty"`
 }
 
 // AckMessage is sent ONLY to the sender
@@ -48,23 +136,82 @@ type AckMessage struct {
 
 // ChatMessage is broadcast to room subscribers
 type ChatMessage struct {
-	Type           string    `json:"type"` // "message"
-	ConversationID string    `json:"conversation_id"`
-	SenderID       string    `json:"sender_id"`
-	Seq            int64     `json:"seq"`
-	Payload        string    `json:"payload"`
-	CreatedAt      time.Time `json:"created_at"`
+	Type           string `json:"type"` // "message"
+	ConversationID string `json:"conversation_id"`
+	SenderID       string `json:"sender_id"`
+	Seq            int64  `json:"seq"`
+	// PrevSeq is the seq of the message this connection was sent (or acked)
+	// before this one; a client that does not have it missed something
+	PrevSeq     int64      `json:"prev_seq,omitempty"`
+	Payload     string     `json:"payload"`
+	CreatedAt   time.Time  `json:"created_at"`
+	EditedAt    *time.Time `json:"edited_at,omitempty"`
+	DisplayName string     `json:"display_name,omitempty"`
+	AvatarSeed  string     `json:"avatar_seed,omitempty"`
+}
+
+// GapNotice tells a client that messages FromSeq..ToSeq did not reach it in
+// time; it should resync them with since_seq
+type GapNotice struct {
+	Type    string `json:"type"` // "gap"
+	FromSeq int64  `json:"from_seq"`
+	ToSeq   int64  `json:"to_seq"`
+}
+
+// NewChatMessage builds the broadcast frame for a persisted message
+func NewChatMessage(m *Message) ChatMessage {
+	return ChatMessage{
+		Type:           TypeMessage,
+		ConversationID: m.ConversationID.String(),
+		SenderID:       m.SenderID.String(),
+		Seq:            m.Seq,
+		Payload:        m.Payload,
+		CreatedAt:      m.CreatedAt,
+		EditedAt:       m.EditedAt,
+		DisplayName:    m.SenderName,
+		AvatarSeed:     m.SenderAvatar,
+	}
 }
 
 // PresenceEvent is pushed to room
 type PresenceEvent struct {
-	Type   string   `json:"type"` // "presence"
-	Online []string `json:"online_sender_ids"`
+	Type         string                `json:"type"` // "presence"
+	Online       []string              `json:"online_sender_ids"`
+	Participants []PresenceParticipant `json:"participants"`
+}
+
+// PresenceParticipant describes one online participant by pseudonym.
+type PresenceParticipant struct {
+	SenderID    string `json:"sender_id"`
+	DisplayName string `json:"display_name"`
+	AvatarSeed  string `json:"avatar_seed"`
+}
+
+// SystemEvent reports a change in the room. SenderID is the participant the
+// event is about and ActorID the one who caused it; user IDs never appear.
+type SystemEvent struct {
+	Type       string        `json:"type"` // "system"
+	Event      string        `json:"event"`
+	SenderID   string        `json:"sender_id,omitempty"`
+	ActorID    string        `json:"actor_id,omitempty"`
+	Role       Role          `json:"role,omitempty"`
+	Settings   *RoomSettings `json:"settings,omitempty"`
+	Message    *ChatMessage  `json:"message,omitempty"`
+	MutedUntil *time.Time    `json:"muted_until,omitempty"`
+}
+
+// ReconnectHint is sent before the server closes a connection it wants the client to re-establish
+type ReconnectHint struct {
+	Type         string `json:"type"` // "reconnect"
+	Reason       string `json:"reason"`
+	RetryAfterMs int64  `json:"retry_after_ms"`
 }
 
 // ErrorMessage is WS-safe error
 type ErrorMessage struct {
-	Type    string `json:"type"` // "error"
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Type         string `json:"type"` // "error"
+	Code         string `json:"code"`
+	Message      string `json:"message"`
+	Action       string `json:"action,omitempty"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
 }
@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	minDisplayName = 2
+	maxDisplayName = 32
+)
+
+var (
+	pseudonymAdjectives = []string{
+		"amber", "brave", "calm", "clever", "cosmic", "crimson", "curious", "dapper",
+		"eager", "electric", "fuzzy", "gentle", "golden", "happy", "hidden", "icy",
+		"jolly", "kind", "lucky", "mellow", "misty", "nimble", "noble", "quiet",
+		"rapid", "rosy", "rustic", "silent", "silver", "sleepy", "sunny", "swift",
+		"tidy", "velvet", "witty", "zesty",
+	}
+	pseudonymAnimals = []string{
+		"badger", "beaver", "bison", "crane", "dingo", "dolphin", "falcon", "ferret",
+		"fox", "gecko", "heron", "ibis", "jackal", "koala", "lemur", "lynx",
+		"marmot", "meerkat", "moose", "newt", "ocelot", "otter", "owl", "panda",
+		"puffin", "quokka", "raven", "seal", "sparrow", "tapir", "tiger", "walrus",
+		"weasel", "wombat", "yak", "zebra",
+	}
+)
+
+// NewPseudonym returns a random adjective-animal name. With suffix set a number
+// is appended, for when the plain names keep colliding.
+func NewPseudonym(suffix bool) string {
+	name := pick(pseudonymAdjectives) + "-" + pick(pseudonymAnimals)
+	if suffix {
+		n, _ := rand.Int(rand.Reader, big.NewInt(10000))
+		name += "-" + strconv.FormatInt(n.Int64(), 10)
+	}
+	return name
+}
+
+// NewAvatarSeed returns an opaque seed clients feed to their avatar generator.
+func NewAvatarSeed() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NormalizeDisplayName trims and collapses whitespace and checks length and
+// characters: letters, digits, spaces, '-', '_' and '.'.
+func NormalizeDisplayName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if n := utf8.RuneCountInString(name); n < minDisplayName || n > maxDisplayName {
+		return "", ErrInvalidDisplayName
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(" -_.", r) {
+			return "", ErrInvalidDisplayName
+		}
+	}
+	return name, nil
+}
+
+func pick(words []string) string {
+	n, _ := rand.Int(rand.Reader, big.NewInt(int64(len(words))))
+	return words[n.Int64()]
+}
@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RestrictionKind is a moderation action that outlives the socket it was issued against.
+type RestrictionKind string
+
+const (
+	RestrictionBan  RestrictionKind = "ban"
+	RestrictionMute RestrictionKind = "mute"
+)
+
+// MutedForever stands in for the end of a mute that never expires.
+var MutedForever = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// Restriction applies to a user within one conversation, whatever sender_id they join as.
+type Restriction struct {
+	ConversationID uuid.UUID
+	UserID         string
+	Kind           RestrictionKind
+	CreatedBy      uuid.UUID // sender_id of the moderator
+	CreatedAt      time.Time
+	ExpiresAt      *time.Time // nil never expires
+}
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// ResumeState is what a resume token stands for: an identity a user may
+// reconnect to without resolving it again, and where their last delivery stopped.
+type ResumeState struct {
+	UserID           string        `json:"user_id"`
+	ConversationID   string        `json:"conversation_id"`
+	ConversationType string        `json:"conversation_type"`
+	SenderID         string        `json:"sender_id"`
+	LastDeliveredSeq int64         `json:"last_delivered_seq"`
+	Window           time.Duration `json:"window"` // lifetime of the token
+}
@@ -0,0 +1,68 @@
+package domain
+
+// Role is a participant's standing within one conversation.
+type Role string
+
+const (
+	RoleOwner     Role = "owner"
+	RoleModerator Role = "moderator"
+	RoleMember    Role = "member"
+	RoleReadOnly  Role = "read_only"
+)
+
+// Permission is an action gated by role.
+type Permission string
+
+const (
+	PermSendMessage Permission = "message.send"
+	PermEditOwn     Permission = "message.edit_own"
+	PermEditAny     Permission = "message.edit_any"
+	PermKick        Permission = "participant.kick"
+	PermBan         Permission = "participant.ban"
+	PermMute        Permission = "participant.mute"
+	PermSetRole     Permission = "role.set"
+	PermUpdateRoom  Permission = "room.update"
+	PermInvite      Permission = "invite.manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleOwner:     {PermSendMessage, PermEditOwn, PermEditAny, PermKick, PermBan, PermMute, PermSetRole, PermUpdateRoom, PermInvite},
+	RoleModerator: {PermSendMessage, PermEditOwn, PermEditAny, PermKick, PermBan, PermMute, PermSetRole, PermInvite},
+	RoleMember:    {PermSendMessage, PermEditOwn},
+	RoleReadOnly:  {},
+}
+
+var roleRank = map[Role]int{
+	RoleReadOnly:  0,
+	RoleMember:    1,
+	RoleModerator: 2,
+	RoleOwner:     3,
+}
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// Can reports whether r grants p.
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Outranks reports whether r is strictly above other.
+func (r Role) Outranks(other Role) bool {
+	return roleRank[r] > roleRank[other]
+}
+
+// CanAssign reports whether actor may give target the role to. Participants
+// only manage those ranked below them and only hand out lower roles, so
+// ownership cannot be granted or taken away.
+func CanAssign(actor, target, to Role) bool {
+	return actor.Can(PermSetRole) && to.Valid() && actor.Outranks(target) && actor.Outranks(to)
+}
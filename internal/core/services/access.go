@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"livon/internal/config"
+	"livon/internal/core/domain"
+	"livon/internal/platform/logger"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type IAccessService interface {
+	// Admit lets userID into conv. Public rooms and members pass; anyone else
+	// needs a valid invite token, which makes them a member.
+	Admit(ctx context.Context, userID string, conv *domain.Conversation, token string) error
+	// CreateInvite issues an invite on behalf of userID's participant in convID
+	// and returns it with its token. A zero ttl uses the configured default.
+	CreateInvite(ctx context.Context, userID, convID string, ttl time.Duration, singleUse bool) (*domain.Invite, string, error)
+	// RevokeInvite stops an invite from admitting anyone else
+	RevokeInvite(ctx context.Context, userID, convID, inviteID string) error
+	// SetVisibility switches a room between public and private; going private
+	// keeps everyone currently in the room as a member
+	SetVisibility(ctx context.Context, convID string, visibility domain.Visibility) error
+	// Expel drops the membership of the user behind senderID
+	Expel(ctx context.Context, senderID string) error
+}
+
+type AccessService struct {
+	repo      domain.ConversationAccessRepository
+	convRepo  domain.ConversationRepository
+	memRepo   domain.ConversationParticipantRepository
+	txManager *TxManager
+	cfg       config.InviteConfig
+	log       *slog.Logger
+}
+
+func NewAccessService(
+	log *slog.Logger,
+	repo domain.ConversationAccessRepository,
+	convRepo domain.ConversationRepository,
+	memRepo domain.ConversationParticipantRepository,
+	txManager *TxManager,
+	cfg config.InviteConfig,
+) *AccessService {
+	return &AccessService{
+		log:       log,
+		repo:      repo,
+		convRepo:  convRepo,
+		memRepo:   memRepo,
+		txManager: txManager,
+		cfg:       cfg,
+	}
+}
+
+func (a *AccessService) Admit(ctx context.Context, userID string, conv *domain.Conversation, token string) error {
+	if conv.Visibility != domain.VisibilityPrivate {
+		return nil
+	}
+	member, err := a.repo.IsMember(ctx, conv.ID, userID)
+	if err != nil {
+		a.log.ErrorContext(ctx, "access - admit - membership lookup failed", logger.Conversation(conv.ID.String()), logger.User(userID), logger.Err(err))
+		return err
+	}
+	if member {
+		return nil
+	}
+	if token == "" {
+		return domain.ErrInviteRequired
+	}
+	// The signature and expiry are checked before touching Postgres
+	inviteID, err := a.verify(conv.ID, token)
+	if err != nil {
+		a.log.WarnContext(ctx, "access - admit - invite rejected", logger.Conversation(conv.ID.String()), logger.User(userID), logger.Err(err))
+		return err
+	}
+	if err := a.txManager.WithTx(ctx, func(txCtx context.Context) error {
+		if err := a.repo.RedeemInvite(txCtx, conv.ID, inviteID); err != nil {
+			return err
+		}
+		return a.repo.AddMember(txCtx, conv.ID, userID)
+	}); err != nil {
+		a.log.WarnContext(ctx, "access - admit - redeem invite failed", logger.Conversation(conv.ID.String()), logger.User(userID), slog.String("invite_id", inviteID.String()), logger.Err(err))
+		return err
+	}
+	a.log.InfoContext(ctx, "access - admit - invite redeemed", logger.Conversation(conv.ID.String()), logger.User(userID), slog.String("invite_id", inviteID.String()))
+	return nil
+}
+
+func (a *AccessService) CreateInvite(
+	ctx context.Context,
+	userID, convID string,
+	ttl time.Duration,
+	singleUse bool,
+) (*domain.Invite, string, error) {
+	cid, err := uuid.Parse(convID)
+	if err != nil {
+		return nil, "", domain.ErrInvalidConversationID
+	}
+	inviter, err := a.authorise(ctx, userID, cid)
+	if err != nil {
+		return nil, "", err
+	}
+	if ttl <= 0 {
+		ttl = a.cfg.DefaultTTL
+	}
+	if ttl > a.cfg.MaxTTL {
+		ttl = a.cfg.MaxTTL
+	}
+	inv := &domain.Invite{
+		ID:             uuid.New(),
+		ConversationID: cid,
+		CreatedBy:      inviter.ID,
+		// Postgres keeps microseconds; truncate so the token and the row agree
+		ExpiresAt: time.Now().Add(ttl).Truncate(time.Second),
+		SingleUse: singleUse,
+	}
+	if err := a.repo.CreateInvite(ctx, inv); err != nil {
+		a.log.ErrorContext(ctx, "access - create invite - insert failed", logger.Conversation(convID), logger.Sender(inviter.ID.String()), logger.Err(err))
+		return nil, "", err
+	}
+	a.log.InfoContext(ctx, "access - create invite - insert success", logger.Conversation(convID), logger.Sender(inviter.ID.String()), slog.String("invite_id", inv.ID.String()))
+	return inv, a.sign(inv), nil
+}
+
+func (a *AccessService) RevokeInvite(ctx context.Context, userID, convID, inviteID string) error {
+	cid, err := uuid.Parse(convID)
+	if err != nil {
+		return domain.ErrInvalidConversationID
+	}
+	iid, err := uuid.Parse(inviteID)
+	if err != nil {
+		return domain.ErrInviteNotFound
+	}
+	revoker, err := a.authorise(ctx, userID, cid)
+	if err != nil {
+		return err
+	}
+	if err := a.repo.RevokeInvite(ctx, cid, iid); err != nil {
+		a.log.ErrorContext(ctx, "access - revoke invite - update failed", logger.Conversation(convID), slog.String("invite_id", inviteID), logger.Err(err))
+		return err
+	}
+	a.log.InfoContext(ctx, "access - revoke invite - update success", logger.Conversation(convID), logger.Sender(revoker.ID.String()), slog.String("invite_id", inviteID))
+	return nil
+}
+
+func (a *AccessService) SetVisibility(ctx context.Context, convID string, visibility domain.Visibility) error {
+	if !visibility.Valid() {
+		return domain.ErrInvalidFrame
+	}
+	cid := uuid.MustParse(convID)
+	if err := a.txManager.WithTx(ctx, func(txCtx context.Context) error {
+		if err := a.convRepo.UpdateVisibility(txCtx, cid, visibility); err != nil {
+			return err
+		}
+		if visibility == domain.VisibilityPrivate {
+			return a.repo.AddActiveParticipants(txCtx, cid)
+		}
+		return nil
+	}); err != nil {
+		a.log.ErrorContext(ctx, "access - set visibility - update failed", logger.Conversation(convID), slog.String("visibility", string(visibility)), logger.Err(err))
+		return err
+	}
+	a.log.InfoContext(ctx, "access - set visibility - update success", logger.Conversation(convID), slog.String("visibility", string(visibility)))
+	return nil
+}
+
+func (a *AccessService) Expel(ctx context.Context, senderID string) error {
+	p, err := a.memRepo.GetParticipant(ctx, uuid.MustParse(senderID))
+	if err != nil {
+		return err
+	}
+	if err := a.repo.RemoveMember(ctx, p.ConversationID, p.UserID); err != nil {
+		a.log.ErrorContext(ctx, "access - expel - delete failed", logger.Conversation(p.ConversationID.String()), logger.Sender(senderID), logger.Err(err))
+		return err
+	}
+	return nil
+}
+
+// authorise returns userID's active participant in the conversation if its
+// role may manage invites.
+func (a *AccessService) authorise(ctx context.Context, userID string, convID uuid.UUID) (*domain.Participant, error) {
+	p, err := a.memRepo.FindRecentParticipant(ctx, userID, convID)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil || !p.Role.Can(domain.PermInvite) {
+		return nil, domain.ErrPermissionDenied
+	}
+	return p, nil
+}
+
+// sign encodes the invite ID and expiry and appends an HMAC that also covers
+// the conversation, so a token only works for the room it was issued for.
+func (a *AccessService) sign(inv *domain.Invite) string {
+	body := make([]byte, 24)
+	copy(body, inv.ID[:])
+	binary.BigEndian.PutUint64(body[16:], uint64(inv.ExpiresAt.Unix()))
+	return base64.RawURLEncoding.EncodeToString(body) + "." +
+		base64.RawURLEncoding.EncodeToString(a.mac(inv.ConversationID, body))
+}
+
+// verify checks a token's signature and expiry and returns the invite ID.
+func (a *AccessService) verify(convID uuid.UUID, token string) (uuid.UUID, error) {
+	encBody, encSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return uuid.Nil, domain.ErrInviteInvalid
+	}
+	body, err := base64.RawURLEncoding.DecodeString(encBody)
+	if err != nil || len(body) != 24 {
+		return uuid.Nil, domain.ErrInviteInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encSig)
+	if err != nil || !hmac.Equal(sig, a.mac(convID, body)) {
+		return uuid.Nil, domain.ErrInviteInvalid
+	}
+	if time.Now().Unix() >= int64(binary.BigEndian.Uint64(body[16:])) {
+		return uuid.Nil, domain.ErrInviteInvalid
+	}
+	id, _ := uuid.FromBytes(body[:16])
+	return id, nil
+}
+
+func (a *AccessService) mac(convID uuid.UUID, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(a.cfg.Secret))
+	h.Write(convID[:])
+	h.Write(body)
+	return h.Sum(nil)
+}
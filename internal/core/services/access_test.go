@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"livon/internal/config"
+	"livon/internal/core/domain"
+	"livon/internal/core/services/servicestest"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestAccess(secret string) (*AccessService, *servicestest.Access) {
+	log := slog.New(slog.DiscardHandler)
+	repo := &servicestest.Access{}
+	return NewAccessService(log, repo, &servicestest.Conversations{}, &servicestest.Participants{},
+		NewTxManager(log, servicestest.NewDB()),
+		config.InviteConfig{Secret: secret, DefaultTTL: time.Hour, MaxTTL: time.Hour}), repo
+}
+
+// tamper flips one bit of the decoded part i of a token (0 body, 1 signature).
+func tamper(token string, i int) string {
+	parts := strings.SplitN(token, ".", 2)
+	raw, _ := base64.RawURLEncoding.DecodeString(parts[i])
+	raw[0] ^= 1
+	parts[i] = base64.RawURLEncoding.EncodeToString(raw)
+	return strings.Join(parts, ".")
+}
+
+func TestVerifyInviteToken(t *testing.T) {
+	access, _ := newTestAccess("secret")
+	other, _ := newTestAccess("other")
+	convID := uuid.New()
+	inv := &domain.Invite{ID: uuid.New(), ConversationID: convID, ExpiresAt: time.Now().Add(time.Hour)}
+	token := access.sign(inv)
+	expired := access.sign(&domain.Invite{ID: uuid.New(), ConversationID: convID, ExpiresAt: time.Now().Add(-time.Second)})
+
+	for _, tc := range []struct {
+		name    string
+		service *AccessService
+		convID  uuid.UUID
+		token   string
+		wantErr bool
+	}{
+		{"valid", access, convID, token, false},
+		{"tampered body", access, convID, tamper(token, 0), true},
+		{"tampered signature", access, convID, tamper(token, 1), true},
+		{"expired", access, convID, expired, true},
+		{"wrong room", access, uuid.New(), token, true},
+		{"other secret", other, convID, token, true},
+		{"no signature", access, convID, strings.Split(token, ".")[0], true},
+		{"not base64", access, convID, "!!.!!", true},
+		{"short body", access, convID, "AAAA." + strings.Split(token, ".")[1], true},
+		{"empty", access, convID, "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := tc.service.verify(tc.convID, tc.token)
+			if tc.wantErr {
+				if !errors.Is(err, domain.ErrInviteInvalid) {
+					t.Errorf("verify: %v, want %v", err, domain.ErrInviteInvalid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if id != inv.ID {
+				t.Errorf("invite id %s, want %s", id, inv.ID)
+			}
+		})
+	}
+}
+
+func TestAdmitRedeemsInvite(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name       string
+		singleUse  bool
+		revoke     bool
+		wantSecond error
+	}{
+		{"single use", true, false, domain.ErrInviteInvalid},
+		{"reusable", false, false, nil},
+		{"revoked", false, true, domain.ErrInviteInvalid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			access, repo := newTestAccess("secret")
+			conv := &domain.Conversation{ID: uuid.New(), Visibility: domain.VisibilityPrivate}
+			inv := &domain.Invite{ID: uuid.New(), ConversationID: conv.ID, ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second), SingleUse: tc.singleUse}
+			if err := repo.CreateInvite(ctx, inv); err != nil {
+				t.Fatal(err)
+			}
+			token := access.sign(inv)
+			if err := access.Admit(ctx, "alice", conv, ""); !errors.Is(err, domain.ErrInviteRequired) {
+				t.Errorf("admit without invite: %v, want %v", err, domain.ErrInviteRequired)
+			}
+			if err := access.Admit(ctx, "alice", conv, token); err != nil {
+				t.Fatalf("first redeem: %v", err)
+			}
+			// Members come back without the token
+			if err := access.Admit(ctx, "alice", conv, ""); err != nil {
+				t.Errorf("member readmitted: %v", err)
+			}
+			if tc.revoke {
+				if err := repo.RevokeInvite(ctx, conv.ID, inv.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := access.Admit(ctx, "bob", conv, token); !errors.Is(err, tc.wantSecond) {
+				t.Errorf("second redeem: %v, want %v", err, tc.wantSecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
+	"livon/internal/core/domain"
+	"livon/internal/platform/logger"
+	"log/slog"
+
+	"github.com/google/uuid"
+)
+
+// adminChannel carries admin commands to every replica.
+const adminChannel = "livon:admin"
+
+// pendingInspectLimit caps the pending entries returned by StreamInfo.
+const pendingInspectLimit = 100
+
+type IAdminService interface {
+	// ListConversations returns every conversation with online participants on any replica
+	ListConversations(ctx context.Context) ([]ConversationSummary, error)
+	// StreamInfo reports the backlog and pending entries of the partition stream
+	// carrying a conversation, and the conversation's dead letters
+	StreamInfo(ctx context.Context, convID string) (*StreamInfo, error)
+	// DisconnectSender closes the sender's connection on whichever replica holds it
+	DisconnectSender(ctx context.Context, senderID string) error
+	// CloseConversation disconnects every participant of a conversation on all replicas
+	CloseConversation(ctx context.Context, convID string) error
+	// PurgeConversation closes the conversation and deletes its stream entries, presence and history
+	PurgeConversation(ctx context.Context, convID string) error
+	// ReplayDeadLetters puts the conversation's dead-lettered entries back on its partition stream
+	ReplayDeadLetters(ctx context.Context, convID string) (int, error)
+	// Run applies admin commands published by any replica to the local registry until ctx is cancelled
+	Run(ctx context.Context) error
+}
+
+type ConversationSummary struct {
+	ConversationID string   `json:"conversation_id"`
+	Online         []string `json:"online"` // sender_ids
+}
+
+type StreamInfo struct {
+	Topic string `json:"topic"` // partition stream shared with other conversations
+	contracts.StreamBacklog
+	PendingEntries []contracts.PendingEntry `json:"pending_entries"`
+	DeadLetters    int64                    `json:"dead_letters"`
+}
+
+// adminCommand is the message exchanged on adminChannel.
+type adminCommand struct {
+	Op             string `json:"op"` // "disconnect" | "close"
+	SenderID       string `json:"sender_id,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+}
+
+type AdminService struct {
+	convRepo  domain.ConversationRepository
+	presStore contracts.PresenceStore
+	queue     contracts.MessageQueue
+	bus       contracts.ClusterBus
+	registry  contracts.Registry
+	cfg       config.WorkerConfig
+	log       *slog.Logger
+}
+
+func NewAdminService(
+	log *slog.Logger,
+	convRepo domain.ConversationRepository,
+	presStore contracts.PresenceStore,
+	queue contracts.MessageQueue,
+	bus contracts.ClusterBus,
+	registry contracts.Registry,
+	cfg config.WorkerConfig,
+) *AdminService {
+	return &AdminService{
+		log:       log,
+		convRepo:  convRepo,
+		presStore: presStore,
+		queue:     queue,
+		bus:       bus,
+		registry:  registry,
+		cfg:       cfg,
+	}
+}
+
+// topic is the partition stream carrying convID.
+func (a *AdminService) topic(convID string) string {
+	return PartitionTopic(Partition(convID, a.cfg.Partitions))
+}
+
+func (a *AdminService) ListConversations(ctx context.Context) ([]ConversationSummary, error) {
+	convIDs, err := a.presStore.ListConversations(ctx)
+	if err != nil {
+		a.log.ErrorContext(ctx, "admin - list conversations - scan failed", logger.Err(err))
+		return nil, err
+	}
+	out := make([]ConversationSummary, 0, len(convIDs))
+	for _, convID := range convIDs {
+		online, err := a.presStore.GetOnlineParticipants(ctx, convID)
+		if err != nil {
+			a.log.ErrorContext(ctx, "admin - list conversations - get online participants failed", logger.Conversation(convID), logger.Err(err))
+			return nil, err
+		}
+		if len(online) == 0 {
+			continue
+		}
+		out = append(out, ConversationSummary{ConversationID: convID, Online: online})
+	}
+	return out, nil
+}
+
+func (a *AdminService) StreamInfo(ctx context.Context, convID string) (*StreamInfo, error) {
+	if _, err := uuid.Parse(convID); err != nil {
+		return nil, domain.ErrInvalidConversationID
+	}
+	topic := a.topic(convID)
+	backlog, err := a.queue.Backlog(ctx, topic, a.cfg.MessageGroup)
+	if err != nil {
+		a.log.ErrorContext(ctx, "admin - stream info - backlog failed", logger.Conversation(convID), logger.Err(err))
+		return nil, err
+	}
+	pending, err := a.queue.PendingEntries(ctx, topic, a.cfg.MessageGroup, pendingInspectLimit)
+	if err != nil {
+		a.log.ErrorContext(ctx, "admin - stream info - pending entries failed", logger.Conversation(convID), logger.Err(err))
+		return nil, err
+	}
+	dead, err := a.queue.DeadLetters(ctx, topic, convID)
+	if err != nil {
+		a.log.ErrorContext(ctx, "admin - stream info - dead letters failed", logger.Conversation(convID), logger.Err(err))
+		return nil, err
+	}
+	return &StreamInfo{Topic: topic, StreamBacklog: backlog, PendingEntries: pending, DeadLetters: dead}, nil
+}
+
+func (a *AdminService) DisconnectSender(ctx context.Context, senderID string) error {
+	if _, err := uuid.Parse(senderID); err != nil {
+		return domain.ErrInvalidParticipantID
+	}
+	a.log.InfoContext(ctx, "admin - disconnect sender", logger.Sender(senderID))
+	return a.publish(ctx, adminCommand{Op: "disconnect", SenderID: senderID})
+}
+
+func (a *AdminService) CloseConversation(ctx context.Context, convID string) error {
+	if _, err := uuid.Parse(convID); err != nil {
+		return domain.ErrInvalidConversationID
+	}
+	a.log.InfoContext(ctx, "admin - close conversation", logger.Conversation(convID))
+	return a.publish(ctx, adminCommand{Op: "close", ConversationID: convID})
+}
+
+func (a *AdminService) PurgeConversation(ctx context.Context, convID string) error {
+	if err := a.CloseConversation(ctx, convID); err != nil {
+		return err
+	}
+	if err := a.queue.PurgeKey(ctx, a.topic(convID), a.cfg.MessageGroup, convID); err != nil {
+		a.log.ErrorContext(ctx, "admin - purge conversation - purge stream entries failed", logger.Conversation(convID), logger.Err(err))
+		return err
+	}
+	if err := a.presStore.ClearConversation(ctx, convID); err != nil {
+		a.log.ErrorContext(ctx, "admin - purge conversation - clear presence failed", logger.Conversation(convID), logger.Err(err))
+		return err
+	}
+	// Participants, sequences and messages cascade
+	if err := a.convRepo.DeleteConversation(ctx, uuid.MustParse(convID)); err != nil {
+		a.log.ErrorContext(ctx, "admin - purge conversation - delete conversation failed", logger.Conversation(convID), logger.Err(err))
+		return err
+	}
+	a.log.InfoContext(ctx, "admin - purge conversation - purged", logger.Conversation(convID))
+	return nil
+}
+
+func (a *AdminService) ReplayDeadLetters(ctx context.Context, convID string) (int, error) {
+	if _, err := uuid.Parse(convID); err != nil {
+		return 0, domain.ErrInvalidConversationID
+	}
+	n, err := a.queue.ReplayDeadLetters(ctx, a.topic(convID), convID)
+	if err != nil {
+		a.log.ErrorContext(ctx, "admin - replay dead letters - replay failed", logger.Conversation(convID), slog.Int("replayed", n), logger.Err(err))
+		return n, err
+	}
+	a.log.InfoContext(ctx, "admin - replay dead letters - replayed", logger.Conversation(convID), slog.Int("replayed", n))
+	return n, nil
+}
+
+func (a *AdminService) publish(ctx context.Context, cmd adminCommand) error {
+	raw, _ := json.Marshal(cmd)
+	if err := a.bus.Publish(ctx, adminChannel, raw); err != nil {
+		a.log.ErrorContext(ctx, "admin - publish - bus publish failed", slog.String("op", cmd.Op), logger.Err(err))
+		return err
+	}
+	return nil
+}
+
+func (a *AdminService) Run(ctx context.Context) error {
+	return a.bus.Subscribe(ctx, adminChannel, func(ctx context.Context, raw []byte) {
+		var cmd adminCommand
+		if err := json.Unmarshal(raw, &cmd); err != nil {
+			a.log.ErrorContext(ctx, "admin - run - wrong command", logger.Err(err))
+			return
+		}
+		switch cmd.Op {
+		case "disconnect":
+			if a.registry.DisconnectSender(cmd.SenderID, domain.CloseAdminDisconnect, domain.CloseReasonAdminDisconnect) {
+				a.log.InfoContext(ctx, "admin - run - sender disconnected", logger.Sender(cmd.SenderID))
+			}
+		case "close":
+			if n := a.registry.DisconnectConversation(cmd.ConversationID, domain.CloseConversationClosed, domain.CloseReasonConversationClosed); n > 0 {
+				a.log.InfoContext(ctx, "admin - run - conversation closed", logger.Conversation(cmd.ConversationID), slog.Int("clients", n))
+			}
+		default:
+			a.log.WarnContext(ctx, "admin - run - unknown command", slog.String("op", cmd.Op))
+		}
+	})
+}
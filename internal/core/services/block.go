@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"livon/internal/core/contracts"
+	"livon/internal/core/domain"
+	"livon/internal/platform/logger"
+	"log/slog"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// blocksChannel tells every replica to reload one user's blocks.
+const blocksChannel = "livon:blocks"
+
+// authorCacheLimit bounds the sender_id → user_id cache; it is reset when full.
+const authorCacheLimit = 100_000
+
+type IBlockService interface {
+	// Block hides the user behind senderID from userID, in every conversation
+	// and under every future identity. Blocking one of your own identities
+	// succeeds without effect so the response never tells the two apart.
+	Block(ctx context.Context, userID, senderID string) error
+	// Unblock removes the block placed through senderID
+	Unblock(ctx context.Context, userID, senderID string) error
+	// Track loads the blocks of the user behind a local connection
+	Track(ctx context.Context, senderID, userID string) error
+	// Untrack forgets a local connection
+	Untrack(senderID string)
+	// Hides reports whether recipientID must not see what authorID sends
+	Hides(ctx context.Context, recipientID, authorID string) bool
+	// FilterMessages drops the messages viewerID has blocked
+	FilterMessages(ctx context.Context, viewerID string, msgs []domain.Message) []domain.Message
+	// Run reloads local viewers when any replica changes their blocks, until ctx is cancelled
+	Run(ctx context.Context) error
+}
+
+// viewer is a locally connected participant and the user_ids it has blocked.
+type viewer struct {
+	userID  string
+	userKey string
+	blocked map[string]struct{}
+}
+
+type BlockService struct {
+	repo    domain.BlockRepository
+	memRepo domain.ConversationParticipantRepository
+	bus     contracts.ClusterBus
+	log     *slog.Logger
+	mu      sync.RWMutex
+	viewers map[string]*viewer // sender_id → viewer
+	authors map[string]string  // sender_id → user_id
+}
+
+func NewBlockService(
+	log *slog.Logger,
+	repo domain.BlockRepository,
+	memRepo domain.ConversationParticipantRepository,
+	bus contracts.ClusterBus,
+) *BlockService {
+	return &BlockService{
+		log:     log,
+		repo:    repo,
+		memRepo: memRepo,
+		bus:     bus,
+		viewers: make(map[string]*viewer),
+		authors: make(map[string]string),
+	}
+}
+
+func (b *BlockService) Block(ctx context.Context, userID, senderID string) error {
+	pid, err := uuid.Parse(senderID)
+	if err != nil {
+		return domain.ErrInvalidParticipantID
+	}
+	p, err := b.memRepo.GetParticipant(ctx, pid)
+	if err != nil {
+		return err
+	}
+	if p.UserID == userID {
+		return nil
+	}
+	if err := b.repo.Block(ctx, userID, p.UserID, pid); err != nil {
+		b.log.ErrorContext(ctx, "block - block - insert failed", logger.User(userID), logger.Sender(senderID), logger.Err(err))
+		return err
+	}
+	b.log.InfoContext(ctx, "block - block - insert success", logger.User(userID), logger.Sender(senderID))
+	return b.changed(ctx, userID)
+}
+
+func (b *BlockService) Unblock(ctx context.Context, userID, senderID string) error {
+	pid, err := uuid.Parse(senderID)
+	if err != nil {
+		return domain.ErrInvalidParticipantID
+	}
+	if err := b.repo.Unblock(ctx, userID, pid); err != nil {
+		b.log.ErrorContext(ctx, "block - unblock - delete failed", logger.User(userID), logger.Sender(senderID), logger.Err(err))
+		return err
+	}
+	b.log.InfoContext(ctx, "block - unblock - delete success", logger.User(userID), logger.Sender(senderID))
+	return b.changed(ctx, userID)
+}
+
+// changed asks every replica to reload userID's blocks. The user_id itself is
+// hashed so it never travels over the bus.
+func (b *BlockService) changed(ctx context.Context, userID string) error {
+	data, _ := json.Marshal(map[string]string{"user": userKey(userID)})
+	if err := b.bus.Publish(ctx, blocksChannel, data); err != nil {
+		b.log.ErrorContext(ctx, "block - changed - bus publish failed", logger.User(userID), logger.Err(err))
+		return err
+	}
+	return nil
+}
+
+func (b *BlockService) Run(ctx context.Context) error {
+	return b.bus.Subscribe(ctx, blocksChannel, func(ctx context.Context, data []byte) {
+		var msg struct {
+			User string `json:"user"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			b.log.ErrorContext(ctx, "block - run - wrong format", logger.Err(err))
+			return
+		}
+		b.mu.RLock()
+		var senders []string
+		var userID string
+		for sid, v := range b.viewers {
+			if v.userKey == msg.User {
+				senders = append(senders, sid)
+				userID = v.userID
+			}
+		}
+		b.mu.RUnlock()
+		for _, sid := range senders {
+			if err := b.Track(ctx, sid, userID); err != nil {
+				b.log.ErrorContext(ctx, "block - run - reload failed", logger.Sender(sid), logger.Err(err))
+			}
+		}
+	})
+}
+
+func (b *BlockService) Track(ctx context.Context, senderID, userID string) error {
+	ids, err := b.repo.BlockedUsers(ctx, userID)
+	if err != nil {
+		b.log.ErrorContext(ctx, "block - track - load blocks failed", logger.Sender(senderID), logger.Err(err))
+		return err
+	}
+	v := &viewer{userID: userID, userKey: userKey(userID), blocked: make(map[string]struct{}, len(ids))}
+	for _, id := range ids {
+		v.blocked[id] = struct{}{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.viewers[senderID] = v
+	return nil
+}
+
+func (b *BlockService) Untrack(senderID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.viewers, senderID)
+}
+
+func (b *BlockService) Hides(ctx context.Context, recipientID, authorID string) bool {
+	b.mu.RLock()
+	v := b.viewers[recipientID]
+	b.mu.RUnlock()
+	// Most viewers block nobody; only then is the author resolved
+	if v == nil || len(v.blocked) == 0 {
+		return false
+	}
+	author, ok := b.authorOf(ctx, authorID)
+	if !ok {
+		return false
+	}
+	_, hidden := v.blocked[author]
+	return hidden
+}
+
+func (b *BlockService) FilterMessages(ctx context.Context, viewerID string, msgs []domain.Message) []domain.Message {
+	kept := msgs[:0]
+	for _, m := range msgs {
+		if !b.Hides(ctx, viewerID, m.SenderID.String()) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// authorOf resolves the user behind a sender_id; the mapping never changes, so it is cached.
+func (b *BlockService) authorOf(ctx context.Context, senderID string) (string, bool) {
+	b.mu.RLock()
+	userID, ok := b.authors[senderID]
+	b.mu.RUnlock()
+	if ok {
+		return userID, true
+	}
+	pid, err := uuid.Parse(senderID)
+	if err != nil {
+		return "", false
+	}
+	p, err := b.memRepo.GetParticipant(ctx, pid)
+	if err != nil {
+		b.log.ErrorContext(ctx, "block - author of - lookup failed", logger.Sender(senderID), logger.Err(err))
+		return "", false
+	}
+	b.mu.Lock()
+	if len(b.authors) >= authorCacheLimit {
+		b.authors = make(map[string]string)
+	}
+	b.authors[senderID] = p.UserID
+	b.mu.Unlock()
+	return p.UserID, true
+}
+
+func userKey(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return hex.EncodeToString(sum[:])
+}
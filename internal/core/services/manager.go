@@ -6,7 +6,10 @@ import (
 	"errors"
 	"livon/internal/core/contracts"
 	"livon/internal/core/domain"
+	"livon/internal/platform/logger"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,14 +21,64 @@ import (
 
 type IManagerService interface {
 	// HandleConnect HandleDisconnect HandleMessage HandleHeartbeat
-	// HandleConnect manages the 5-min rejoin logic and initial PG update
-	// Returns the assigned sender_id and previous message history metadata
-	HandleConnect(ctx context.Context, userID, convID string, forceNew bool) (string, bool, error)
+	// HandleConnect manages the rejoin logic and initial PG update
+	// Returns the session with the assigned sender_id, role and pseudonym, and
+	// a connection ID that tells this device apart from the sender's others
+	HandleConnect(ctx context.Context, userID, convID string, opts ConnectOptions) (*domain.Session, error)
+	// SaveResumePoint records how far the session's socket got, for its resume token
+	SaveResumePoint(ctx context.Context, session *domain.Session, deliveredSeq int64)
 	// HandleDisconnect performs the final PG last_seen_at update
-	HandleDisconnect(ctx context.Context, senderID string, convID string) error
-	// HandleHeartbeat coordinates the 30s Redis update and the 5-min PG sync
-	HandleHeartbeat(ctx context.Context, senderID string, convID string) error
-	HandleHistory(ctx context.Context, convID string) []domain.Message
+	HandleDisconnect(ctx context.Context, senderID string, convID string, connID string) error
+	// HandleHeartbeat turns client liveness signals (pongs, frames) into Redis
+	// presence updates and the periodic PG last_seen_at sync
+	HandleHeartbeat(ctx context.Context, senderID string, convID string, connID string, alive <-chan struct{}) error
+	// HandleMessage dispatches one inbound frame by type after rate limiting and
+	// checking the sender's role
+	HandleMessage(ctx context.Context, senderID string, convID string, connID string, raw []byte) error
+	// HandleHistory returns the conversation's messages as senderID may see them
+	HandleHistory(ctx context.Context, senderID string, convID string) []domain.Message
+	// HandleResync returns messages after afterSeq, created at or after since,
+	// so a reconnecting client can catch up, leaving out authors senderID has blocked
+	HandleResync(ctx context.Context, senderID string, convID string, afterSeq int64, since time.Time) []domain.Message
+	// BroadcastPresence pushes the online snapshot to the room
+	BroadcastPresence(ctx context.Context, convID string)
+	// Run applies room events published by any replica to local clients until ctx is cancelled
+	Run(ctx context.Context) error
+	// Drain keeps rooms emptied by this node's shutdown; their clients are
+	// reconnecting to other nodes
+	Drain()
+}
+
+const (
+	// resyncLimit caps how many missed messages are replayed on reconnect.
+	resyncLimit = 500
+	// historyWindow is how far back history reaches, as in GetVisibleMessages.
+	historyWindow = time.Minute
+	// presenceTTL is passed to the presence store on every liveness signal.
+	presenceTTL = 45 * time.Second
+	// presenceRefresh throttles Redis writes when a client is chatty.
+	presenceRefresh = 5 * time.Second
+	// sessionSyncInterval throttles the durable last_seen_at update.
+	sessionSyncInterval = 120 * time.Second
+	// roomEventsChannel carries system events to every replica.
+	roomEventsChannel = "livon:room-events"
+)
+
+// roomEvent is the message exchanged on roomEventsChannel.
+type roomEvent struct {
+	ConversationID string             `json:"conversation_id"`
+	Event          domain.SystemEvent `json:"event"`
+	// Disconnect lists other identities of a banned user to close with Event.SenderID
+	Disconnect []string `json:"disconnect,omitempty"`
+}
+
+// ConnectOptions are the client's choices when joining a conversation.
+type ConnectOptions struct {
+	ForceNew    bool   // start a new identity instead of resuming
+	Invite      string // invite token for a private conversation
+	DisplayName string // requested pseudonym for a new identity; generated when empty
+	ResumeToken string // token from an earlier handshake; skips identity resolution while valid
+	SinceSeq    int64  // last seq the client saw; replay starts after it
 }
 
 var tracer = otel.Tracer("manager-service")
@@ -35,8 +88,23 @@ type ManagerService struct {
 	presStore contracts.PresenceStore
 	session   ISessionService
 	message   IMessageService
+	access    IAccessService
+	blocks    IBlockService
+	registry  contracts.Registry
+	bus       contracts.ClusterBus
+	limiter   *RateLimiter
 	txManager *TxManager
 	log       *slog.Logger
+	mu        sync.RWMutex
+	members   map[string]member // sender_id → standing of locally connected participants
+	draining  atomic.Bool
+}
+
+// member is the cached standing of a locally connected participant.
+type member struct {
+	role       domain.Role
+	mutedUntil time.Time
+	conns      int // local devices of this sender
 }
 
 func NewManagerService(
@@ -45,6 +113,11 @@ func NewManagerService(
 	presStore contracts.PresenceStore,
 	session *SessionService,
 	message *MessageService,
+	access *AccessService,
+	blocks *BlockService,
+	registry contracts.Registry,
+	bus contracts.ClusterBus,
+	limiter *RateLimiter,
 	txManager *TxManager,
 ) *ManagerService {
 	return &ManagerService{
@@ -53,15 +126,21 @@ func NewManagerService(
 		presStore: presStore,
 		session:   session,
 		message:   message,
+		access:    access,
+		blocks:    blocks,
+		registry:  registry,
+		bus:       bus,
+		limiter:   limiter,
 		txManager: txManager,
+		members:   make(map[string]member),
 	}
 }
 
 func (c *ManagerService) HandleConnect(
 	ctx context.Context,
 	userID, convID string,
-	forceNew bool,
-) (string, bool, error) {
+	opts ConnectOptions,
+) (*domain.Session, error) {
 	ctx, span := tracer.Start(ctx, "ManagerService.HandleConnect", trace.WithAttributes(
 		attribute.String("user_id", userID),
 		attribute.String("conv_id", convID),
@@ -70,93 +149,202 @@ func (c *ManagerService) HandleConnect(
 	if userID == "" || convID == "" {
 		err := errors.New("invalid heartbeat parameters")
 		span.RecordError(err)
-		return "", false, err
+		return nil, err
 	}
-	var cid uuid.UUID
 	if err := uuid.Validate(convID); err != nil {
 		span.RecordError(err)
-		c.log.ErrorContext(ctx, "manager - handle connect - wrong conv_id", "conv_id", convID, "user_id", userID, "err", err)
-		return "", false, domain.ErrInvalidConversationID
+		c.log.ErrorContext(ctx, "manager - handle connect - wrong conv_id", logger.Conversation(convID), logger.User(userID), logger.Err(err))
+		return nil, domain.ErrInvalidConversationID
+	}
+	var session *domain.Session
+	var err error
+	// A resume token skips conversation setup and identity resolution
+	if opts.ResumeToken != "" && !opts.ForceNew {
+		if session, err = c.resume(ctx, userID, convID, opts); err != nil {
+			span.AddEvent("resume rejected")
+			c.log.WarnContext(ctx, "manager - handle connect - resume rejected", logger.Conversation(convID), logger.User(userID), logger.Err(err))
+		}
+	}
+	if session == nil {
+		if session, err = c.resolveSession(ctx, userID, convID, opts); err != nil {
+			return nil, err
+		}
+	} else {
+		c.limiter.SetConversationType(convID, session.ConversationType)
+	}
+	// A resume token vouches for its seq; a since_seq the client names reaches
+	// back no further than history does: max(joined_at, now - 1min)
+	if opts.SinceSeq > session.ResumeSeq {
+		if !session.Resumed {
+			session.ReplaySince = historySince(session.JoinedAt)
+		}
+		session.ResumeSeq = opts.SinceSeq
+	}
+	senderID := session.SenderID.String()
+	mutedUntil, err := c.session.MutedUntil(ctx, senderID)
+	if err != nil {
+		span.RecordError(err)
+		c.log.ErrorContext(ctx, "manager - handle connect - load mute failed", logger.Conversation(convID), logger.Sender(senderID), logger.Err(err))
+		return nil, err
+	}
+	session.ConnectionID = uuid.NewString()
+	c.remember(senderID, member{role: session.Role, mutedUntil: mutedUntil})
+	if err := c.blocks.Track(ctx, senderID, userID); err != nil {
+		span.RecordError(err)
+		c.log.ErrorContext(ctx, "manager - handle connect - load blocks failed", logger.Conversation(convID), logger.Sender(senderID), logger.Err(err))
+		return nil, err
+	}
+	// Immediate presence signal (Postgres cold path)
+	if !session.Resumed {
+		if err := c.session.SessionSync(ctx, senderID, convID); err != nil {
+			span.RecordError(err)
+			c.log.ErrorContext(ctx, "manager - handle connect - send heartbeat failed", logger.Conversation(convID), logger.User(userID), logger.Err(err))
+			return nil, err
+		}
+	}
+	// Immediate presence signal (Redis hot path) so the first snapshot includes this sender
+	if err := c.presStore.UpdateOnlineStatus(ctx, convID, senderID, session.ConnectionID, presenceTTL); err != nil {
+		span.RecordError(err)
+		c.log.ErrorContext(ctx, "manager - handle connect - update online status failed", logger.Conversation(convID), logger.User(userID), logger.Err(err))
+	}
+	// Without a token the client simply reconnects the slow way
+	if err := c.session.IssueResumeToken(ctx, session); err != nil {
+		span.RecordError(err)
+		c.log.ErrorContext(ctx, "manager - handle connect - issue resume token failed", logger.Conversation(convID), logger.Sender(senderID), logger.Err(err))
+	}
+	span.SetAttributes(attribute.Bool("resumed", session.Resumed))
+	span.SetStatus(codes.Ok, "connected")
+	return session, nil
+}
+
+// resume hands back the session behind opts.ResumeToken. A private room admits
+// the user again, so a membership revoked since the token was issued is not skipped.
+func (c *ManagerService) resume(ctx context.Context, userID, convID string, opts ConnectOptions) (*domain.Session, error) {
+	session, err := c.session.Resume(ctx, userID, convID, opts.ResumeToken)
+	if err != nil {
+		return nil, err
 	}
-	cid = uuid.MustParse(convID)
+	conv, err := c.convRepo.GetConversationByID(ctx, session.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.access.Admit(ctx, userID, conv, opts.Invite); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// resolveSession ensures the conversation exists, admits the user and resolves
+// their identity in Postgres.
+func (c *ManagerService) resolveSession(
+	ctx context.Context,
+	userID, convID string,
+	opts ConnectOptions,
+) (*domain.Session, error) {
+	span := trace.SpanFromContext(ctx)
+	cid := uuid.MustParse(convID)
+	var conv *domain.Conversation
+	// Whoever creates the conversation owns it
+	role := domain.RoleMember
 	if participants, err := c.presStore.GetOnlineParticipants(ctx, convID); len(participants) == 0 || err != nil {
 		if err := c.txManager.WithTx(ctx, func(txCtx context.Context) error {
 			_, tSpan := tracer.Start(txCtx, "DB.CreateConversation")
 			defer tSpan.End()
-			if _, err := c.convRepo.CreateConversation(ctx, cid); err != nil {
+			var err error
+			var created bool
+			if conv, created, err = c.convRepo.CreateConversation(txCtx, cid); err != nil {
 				tSpan.RecordError(err)
 				return err
 			}
+			if created {
+				role = domain.RoleOwner
+			}
 			return nil
 		}); err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, "transaction failed")
-			c.log.ErrorContext(ctx, "manager - handle connect - ensure conversation failed", "conv_id", cid.String(), "user_id", userID, "err", err)
-			return "", false, err
+			c.log.ErrorContext(ctx, "manager - handle connect - ensure conversation failed", logger.Conversation(cid.String()), logger.User(userID), logger.Err(err))
+			return nil, err
+		}
+		c.log.InfoContext(ctx, "manager - handle connect - ensure conversation success", logger.Conversation(convID), logger.User(userID))
+	}
+	var err error
+	if conv == nil {
+		if conv, err = c.convRepo.GetConversationByID(ctx, cid); err != nil {
+			span.RecordError(err)
+			c.log.ErrorContext(ctx, "manager - handle connect - get conversation failed", logger.Conversation(convID), logger.User(userID), logger.Err(err))
+			return nil, err
 		}
-		c.log.InfoContext(ctx, "manager - handle connect - ensure conversation success", "conv_id", convID, "user_id", userID)
+	}
+	c.limiter.SetConversationType(convID, conv.Type)
+	if err := c.access.Admit(ctx, userID, conv, opts.Invite); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "not admitted")
+		return nil, err
 	}
 	// Identity resolution (PG boundary)
-	session, err := c.session.StartSession(ctx, userID, convID, forceNew)
+	session, err := c.session.StartSession(ctx, userID, conv, opts.ForceNew, role, opts.DisplayName)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "start session failed")
-		c.log.ErrorContext(ctx, "manager - handle connect - start session failed", "conv_id", convID, "user_id", userID, "err", err)
-		return "", false, err
-	}
-	senderID := session.SenderID.String()
-	isNewIdentity := session.IsNewIdentity
-	// Immediate presence signal (Postgres cold path)
-	if err := c.session.SessionSync(ctx, senderID, convID); err != nil {
-		span.RecordError(err)
-		c.log.ErrorContext(ctx, "manager - handle connect - send heartbeat failed", "conv_id", convID, "user_id", userID, "err", err)
-		return "", false, err
+		c.log.ErrorContext(ctx, "manager - handle connect - start session failed", logger.Conversation(convID), logger.User(userID), logger.Err(err))
+		return nil, err
 	}
-	span.SetStatus(codes.Ok, "connected")
-	return senderID, isNewIdentity, nil
+	return session, nil
 }
 
 func (c *ManagerService) HandleHeartbeat(
 	ctx context.Context,
 	senderID string,
 	convID string,
+	connID string,
+	alive <-chan struct{},
 ) error {
 	if senderID == "" || convID == "" {
 		return errors.New("invalid heartbeat parameters")
 	}
-	ticker1 := time.NewTicker(30 * time.Second)
-	defer ticker1.Stop()
-	ticker2 := time.NewTicker(120 * time.Second)
-	defer ticker2.Stop()
+	// Connect already wrote both; only refresh once the client proves it is alive
+	lastPresence := time.Now()
+	lastSync := time.Now()
 	for {
 		select {
 		case <-ctx.Done():
-			c.log.Info("manager - handle heartbeat - stopped", "conv_id", convID, "sender_id", senderID)
+			c.log.Info("manager - handle heartbeat - stopped", logger.Conversation(convID), logger.Sender(senderID))
 			return nil
-		case <-ticker1.C:
-			_, span := tracer.Start(ctx, "Heartbeat.UpdateOnlineStatus")
-			if err := c.presStore.UpdateOnlineStatus(ctx, convID, senderID, 45*time.Second); err != nil {
-				span.RecordError(err)
-				span.SetStatus(codes.Error, "redis update failed")
-				c.log.ErrorContext(ctx, "manager - handle heartbeat - update online status failed", "conv_id", convID, "sender_id", senderID, "err", err)
+		case <-alive:
+			now := time.Now()
+			if now.Sub(lastPresence) >= presenceRefresh {
+				lastPresence = now
+				_, span := tracer.Start(ctx, "Heartbeat.UpdateOnlineStatus")
+				if err := c.presStore.UpdateOnlineStatus(ctx, convID, senderID, connID, presenceTTL); err != nil {
+					span.RecordError(err)
+					span.SetStatus(codes.Error, "redis update failed")
+					c.log.ErrorContext(ctx, "manager - handle heartbeat - update online status failed", logger.Conversation(convID), logger.Sender(senderID), logger.Err(err))
+				}
+				span.End()
 			}
-			span.End()
-		case <-ticker2.C:
-			_, span := tracer.Start(ctx, "Heartbeat.SessionSync")
-			if err := c.session.SessionSync(ctx, senderID, convID); err != nil {
-				span.RecordError(err)
-				span.SetStatus(codes.Error, "session sync failed")
-				c.log.ErrorContext(ctx, "manager - handle heartbeat - send heartbeat failed", "conv_id", convID, "sender_id", senderID, "err", err)
+			if now.Sub(lastSync) >= sessionSyncInterval {
+				lastSync = now
+				_, span := tracer.Start(ctx, "Heartbeat.SessionSync")
+				if err := c.session.SessionSync(ctx, senderID, convID); err != nil {
+					span.RecordError(err)
+					span.SetStatus(codes.Error, "session sync failed")
+					c.log.ErrorContext(ctx, "manager - handle heartbeat - send heartbeat failed", logger.Conversation(convID), logger.Sender(senderID), logger.Err(err))
+				}
+				span.End()
 			}
-			span.End()
 		}
-
 	}
 }
 
+func (c *ManagerService) SaveResumePoint(ctx context.Context, session *domain.Session, deliveredSeq int64) {
+	// Failures are logged by the session service; the client then reconnects the slow way
+	_ = c.session.SaveResumePoint(ctx, session, deliveredSeq)
+}
+
 func (c *ManagerService) HandleDisconnect(
 	ctx context.Context,
-	senderID, convID string,
+	senderID, convID, connID string,
 ) error {
 	ctx, span := tracer.Start(ctx, "ManagerService.HandleDisconnect", trace.WithAttributes(
 		attribute.String("sender_id", senderID),
@@ -168,63 +356,500 @@ func (c *ManagerService) HandleDisconnect(
 		span.RecordError(err)
 		return err
 	}
-	// Explicit leave boundary (optional but correct)
-	if err := c.session.StopSession(ctx, senderID, convID); err != nil {
+	// Local state is shared by the sender's devices on this node
+	if c.forget(senderID) {
+		c.limiter.Forget(senderID)
+		c.blocks.Untrack(senderID)
+	}
+	// The identity stays active so the user can resume it; the resume window counts from here
+	if err := c.session.SessionSync(ctx, senderID, convID); err != nil && !errors.Is(err, domain.ErrParticipantNotFound) {
 		span.RecordError(err)
-		c.log.ErrorContext(ctx, "manager - handle disconnect - stop session failed", "conv_id", convID, "sender_id", senderID, "err", err)
+		c.log.ErrorContext(ctx, "manager - handle disconnect - session sync failed", logger.Conversation(convID), logger.Sender(senderID), logger.Err(err))
 		return err
 	}
-	if participants, _ := c.presStore.GetOnlineParticipants(ctx, convID); len(participants) == 0 {
-		if err := c.convRepo.DeleteConversation(ctx, uuid.MustParse(convID)); err != nil {
-			span.RecordError(err)
-			c.log.ErrorContext(ctx, "manager - handle disconnect - delete conversation failed", "conv_id", convID, "sender_id", senderID, "err", err)
+	// The sender stays online while another device is connected, on any node
+	if err := c.presStore.RemoveOnlineStatus(ctx, convID, senderID, connID); err != nil {
+		span.RecordError(err)
+		c.log.ErrorContext(ctx, "manager - handle disconnect - remove online status failed", logger.Conversation(convID), logger.Sender(senderID), logger.Err(err))
+	}
+	participants, err := c.presStore.GetOnlineParticipants(ctx, convID)
+	if err != nil {
+		// An unknown room is left alone rather than taken for an empty one
+		span.RecordError(err)
+		c.log.ErrorContext(ctx, "manager - handle disconnect - get online participants failed", logger.Conversation(convID), logger.Sender(senderID), logger.Err(err))
+		return nil
+	}
+	if len(participants) == 0 {
+		// Private rooms outlive their last connection; their members and invites must survive
+		conv, err := c.convRepo.GetConversationByID(ctx, uuid.MustParse(convID))
+		if err == nil && conv.Visibility != domain.VisibilityPrivate && !c.draining.Load() {
+			if err := c.convRepo.DeleteConversation(ctx, conv.ID); err != nil {
+				span.RecordError(err)
+				c.log.ErrorContext(ctx, "manager - handle disconnect - delete conversation failed", logger.Conversation(convID), logger.Sender(senderID), logger.Err(err))
+			}
 		}
 		if err := c.presStore.ClearConversation(ctx, convID); err != nil {
 			span.RecordError(err)
-			c.log.ErrorContext(ctx, "manager - handle disconnect - clear conversation failed", "conv_id", convID, "sender_id", senderID, "err", err)
+			c.log.ErrorContext(ctx, "manager - handle disconnect - clear conversation failed", logger.Conversation(convID), logger.Sender(senderID), logger.Err(err))
 		}
+		c.limiter.ForgetConversation(convID)
+		return nil
 	}
+	c.BroadcastPresence(ctx, convID)
 	return nil
 }
 
+func (c *ManagerService) Drain() {
+	c.draining.Store(true)
+}
+
 func (c *ManagerService) HandleMessage(
 	ctx context.Context,
 	senderID string,
 	convID string,
+	connID string,
 	raw []byte,
 ) error {
-	ctx, span := tracer.Start(ctx, "ManagerService.HandleMessage", trace.WithAttributes(
-		attribute.String("sender_id", senderID),
-		attribute.String("conv_id", convID),
-		attribute.Int("payload_size", len(raw)),
-	))
+	// Each frame starts its own trace (linked to the connection's) so a message
+	// is followed from the socket through the stream to persistence and fan-out.
+	ctx, span := tracer.Start(ctx, "ManagerService.HandleMessage",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("sender_id", senderID),
+			attribute.String("conv_id", convID),
+			attribute.Int("payload_size", len(raw)),
+		),
+	)
 	defer span.End()
-	var err error
-	var in struct {
-		ClientMsgID string `json:"client_msg_id"`
-		Payload     string `json:"payload"`
+	var in domain.InboundFrame
+	if err := json.Unmarshal(raw, &in); err != nil {
+		span.RecordError(err)
+		c.log.ErrorContext(ctx, "manager - handle message - wrong format", logger.Sender(senderID), logger.Conversation(convID))
+		return domain.ErrInvalidFrame
 	}
-	if err = json.Unmarshal(raw, &in); err != nil {
+	span.SetAttributes(attribute.String("frame_type", in.Type))
+	// Enforce token buckets before anything reaches the stream
+	if err := c.limiter.Allow(senderID, convID); err != nil {
 		span.RecordError(err)
-		c.log.Error("manager - handle message - wrong format", "sender_id", senderID, "conv_id", convID)
+		span.SetStatus(codes.Error, "rate limited")
+		c.log.WarnContext(ctx, "manager - handle message - rate limited", logger.Conversation(convID), logger.Sender(senderID), logger.Err(err))
 		return err
 	}
-	// var payload *domain.MessagePayload
-	// returns payload and publishes to redis stream store until messages are persisted.
-	if _, err = c.message.AcceptMessage(ctx, senderID, convID, in.Payload, in.ClientMsgID); err != nil {
+	m, err := c.memberOf(ctx, senderID)
+	if err != nil {
 		span.RecordError(err)
-		span.SetStatus(codes.Error, "accept message failed")
-		c.log.ErrorContext(ctx, "manager - handle message - accept message failed", "conv_id", convID, "sender_id", senderID, "err", err)
 		return err
 	}
-	// Unnecessary to instantly persist and send acknowledgment.
-	// if err = c.message.SaveAndBroadcast(ctx, payload); err != nil {
-	// 	return err
-	// }
+	role := m.role
+	switch in.Type {
+	case "", domain.FrameMessageSend:
+		err = c.handleSend(ctx, senderID, convID, connID, m, in)
+	case domain.FrameMessageEdit:
+		err = c.handleEdit(ctx, senderID, convID, role, in)
+	case domain.FrameRoleSet:
+		err = c.handleRoleSet(ctx, senderID, convID, role, in)
+	case domain.FrameRoomUpdate:
+		err = c.handleRoomUpdate(ctx, senderID, convID, role, in)
+	case domain.FrameKick:
+		err = c.handleKick(ctx, senderID, convID, role, in)
+	case domain.FrameBan:
+		err = c.handleBan(ctx, senderID, convID, role, in)
+	case domain.FrameUnban:
+		err = c.handleUnban(ctx, senderID, convID, role, in)
+	case domain.FrameMute:
+		err = c.handleMute(ctx, senderID, convID, role, in)
+	case domain.FrameUnmute:
+		err = c.handleUnmute(ctx, senderID, convID, role, in)
+	default:
+		err = domain.ErrInvalidFrame
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, in.Type+" failed")
+		c.log.WarnContext(ctx, "manager - handle message - frame rejected", logger.Conversation(convID), logger.Sender(senderID), slog.String("frame_type", in.Type), logger.Err(err))
+		return err
+	}
 	return nil
 }
 
-func (m *ManagerService) HandleHistory(ctx context.Context, convID string) []domain.Message {
+func (c *ManagerService) handleSend(ctx context.Context, senderID, convID, connID string, m member, in domain.InboundFrame) error {
+	if !m.role.Can(domain.PermSendMessage) {
+		return domain.ErrPermissionDenied
+	}
+	if time.Now().Before(m.mutedUntil) {
+		return &domain.MutedError{Until: m.mutedUntil}
+	}
+	// returns payload and publishes to redis stream store until messages are persisted.
+	_, err := c.message.AcceptMessage(ctx, senderID, convID, connID, in.Payload, in.ClientMsgID)
+	return err
+}
+
+func (c *ManagerService) handleEdit(ctx context.Context, senderID, convID string, role domain.Role, in domain.InboundFrame) error {
+	if !role.Can(domain.PermEditOwn) {
+		return domain.ErrPermissionDenied
+	}
+	if in.Seq <= 0 {
+		return domain.ErrInvalidFrame
+	}
+	msg, err := c.message.EditMessage(ctx, uuid.MustParse(convID), in.Seq, uuid.MustParse(senderID), in.Payload, role.Can(domain.PermEditAny))
+	if err != nil {
+		return err
+	}
+	chat := domain.NewChatMessage(msg)
+	return c.publish(ctx, convID, domain.SystemEvent{
+		Event:    domain.EventMessageEdited,
+		SenderID: chat.SenderID,
+		ActorID:  senderID,
+		Message:  &chat,
+	})
+}
+
+func (c *ManagerService) handleRoleSet(ctx context.Context, senderID, convID string, role domain.Role, in domain.InboundFrame) error {
+	if !role.Can(domain.PermSetRole) {
+		return domain.ErrPermissionDenied
+	}
+	if !in.Role.Valid() {
+		return domain.ErrInvalidRole
+	}
+	target, err := c.target(ctx, convID, in.SenderID, true)
+	if err != nil {
+		return err
+	}
+	if !domain.CanAssign(role, target.Role, in.Role) {
+		return domain.ErrPermissionDenied
+	}
+	if err := c.session.SetRole(ctx, in.SenderID, in.Role); err != nil {
+		return err
+	}
+	return c.publish(ctx, convID, domain.SystemEvent{
+		Event:    domain.EventRoleChanged,
+		SenderID: in.SenderID,
+		ActorID:  senderID,
+		Role:     in.Role,
+	})
+}
+
+func (c *ManagerService) handleRoomUpdate(ctx context.Context, senderID, convID string, role domain.Role, in domain.InboundFrame) error {
+	if !role.Can(domain.PermUpdateRoom) {
+		return domain.ErrPermissionDenied
+	}
+	settings := in.Settings
+	if settings == nil || (settings.Type == "" && settings.Visibility == "" &&
+		settings.IdentityPolicy == "" && settings.ResumeWindowSec == nil) {
+		return domain.ErrInvalidFrame
+	}
+	if settings.Visibility != "" && !settings.Visibility.Valid() {
+		return domain.ErrInvalidFrame
+	}
+	if settings.IdentityPolicy != "" && !settings.IdentityPolicy.Valid() {
+		return domain.ErrInvalidFrame
+	}
+	if settings.ResumeWindowSec != nil && *settings.ResumeWindowSec < 0 {
+		return domain.ErrInvalidFrame
+	}
+	if settings.Type != "" {
+		if err := c.txManager.WithTx(ctx, func(txCtx context.Context) error {
+			return c.convRepo.UpdateType(txCtx, uuid.MustParse(convID), settings.Type)
+		}); err != nil {
+			return err
+		}
+	}
+	if settings.Visibility != "" {
+		if err := c.access.SetVisibility(ctx, convID, settings.Visibility); err != nil {
+			return err
+		}
+	}
+	if settings.IdentityPolicy != "" || settings.ResumeWindowSec != nil {
+		if err := c.txManager.WithTx(ctx, func(txCtx context.Context) error {
+			// Whichever of the two is left out keeps its current value
+			conv, err := c.convRepo.GetConversationByID(txCtx, uuid.MustParse(convID))
+			if err != nil {
+				return err
+			}
+			policy, window := conv.IdentityPolicy, conv.ResumeWindow
+			if settings.IdentityPolicy != "" {
+				policy = settings.IdentityPolicy
+			}
+			if settings.ResumeWindowSec != nil {
+				window = time.Duration(*settings.ResumeWindowSec) * time.Second
+			}
+			return c.convRepo.UpdateIdentityPolicy(txCtx, conv.ID, policy, window)
+		}); err != nil {
+			return err
+		}
+	}
+	return c.publish(ctx, convID, domain.SystemEvent{
+		Event:    domain.EventRoomUpdated,
+		ActorID:  senderID,
+		Settings: settings,
+	})
+}
+
+func (c *ManagerService) handleKick(ctx context.Context, senderID, convID string, role domain.Role, in domain.InboundFrame) error {
+	if !role.Can(domain.PermKick) {
+		return domain.ErrPermissionDenied
+	}
+	target, err := c.target(ctx, convID, in.SenderID, true)
+	if err != nil {
+		return err
+	}
+	if !role.Outranks(target.Role) {
+		return domain.ErrPermissionDenied
+	}
+	if err := c.session.StopSession(ctx, in.SenderID, convID); err != nil {
+		return err
+	}
+	// Kicked users need a new invite to come back to a private room
+	if err := c.access.Expel(ctx, in.SenderID); err != nil {
+		return err
+	}
+	return c.publish(ctx, convID, domain.SystemEvent{
+		Event:    domain.EventKicked,
+		SenderID: in.SenderID,
+		ActorID:  senderID,
+	})
+}
+
+func (c *ManagerService) handleBan(ctx context.Context, senderID, convID string, role domain.Role, in domain.InboundFrame) error {
+	if !role.Can(domain.PermBan) {
+		return domain.ErrPermissionDenied
+	}
+	// Identities that already left can still be banned
+	target, err := c.target(ctx, convID, in.SenderID, false)
+	if err != nil {
+		return err
+	}
+	if !role.Outranks(target.Role) {
+		return domain.ErrPermissionDenied
+	}
+	if err := c.session.Restrict(ctx, in.SenderID, domain.RestrictionBan, nil, senderID); err != nil {
+		return err
+	}
+	if err := c.session.StopSession(ctx, in.SenderID, convID); err != nil && !errors.Is(err, domain.ErrParticipantNotFound) {
+		return err
+	}
+	// The ban is on the user; the identity they are in the room with now may be a newer one
+	var others []string
+	active, err := c.session.ActiveParticipant(ctx, target.UserID, convID)
+	if err != nil {
+		return err
+	}
+	if active != nil && active.ID.String() != in.SenderID {
+		if err := c.session.StopSession(ctx, active.ID.String(), convID); err != nil {
+			return err
+		}
+		others = append(others, active.ID.String())
+	}
+	if err := c.access.Expel(ctx, in.SenderID); err != nil {
+		return err
+	}
+	return c.publishEvent(ctx, roomEvent{
+		ConversationID: convID,
+		Event: domain.SystemEvent{
+			Event:    domain.EventBanned,
+			SenderID: in.SenderID,
+			ActorID:  senderID,
+		},
+		Disconnect: others,
+	})
+}
+
+func (c *ManagerService) handleUnban(ctx context.Context, senderID, convID string, role domain.Role, in domain.InboundFrame) error {
+	if !role.Can(domain.PermBan) {
+		return domain.ErrPermissionDenied
+	}
+	target, err := c.target(ctx, convID, in.SenderID, false)
+	if err != nil {
+		return err
+	}
+	if !role.Outranks(target.Role) {
+		return domain.ErrPermissionDenied
+	}
+	if err := c.session.Lift(ctx, in.SenderID, domain.RestrictionBan); err != nil {
+		return err
+	}
+	return c.publish(ctx, convID, domain.SystemEvent{
+		Event:    domain.EventUnbanned,
+		SenderID: in.SenderID,
+		ActorID:  senderID,
+	})
+}
+
+func (c *ManagerService) handleMute(ctx context.Context, senderID, convID string, role domain.Role, in domain.InboundFrame) error {
+	if !role.Can(domain.PermMute) {
+		return domain.ErrPermissionDenied
+	}
+	if in.DurationSec <= 0 {
+		return domain.ErrInvalidFrame
+	}
+	target, err := c.target(ctx, convID, in.SenderID, false)
+	if err != nil {
+		return err
+	}
+	if !role.Outranks(target.Role) {
+		return domain.ErrPermissionDenied
+	}
+	until := time.Now().Add(time.Duration(in.DurationSec) * time.Second).UTC()
+	if err := c.session.Restrict(ctx, in.SenderID, domain.RestrictionMute, &until, senderID); err != nil {
+		return err
+	}
+	return c.publish(ctx, convID, domain.SystemEvent{
+		Event:      domain.EventMuted,
+		SenderID:   in.SenderID,
+		ActorID:    senderID,
+		MutedUntil: &until,
+	})
+}
+
+func (c *ManagerService) handleUnmute(ctx context.Context, senderID, convID string, role domain.Role, in domain.InboundFrame) error {
+	if !role.Can(domain.PermMute) {
+		return domain.ErrPermissionDenied
+	}
+	target, err := c.target(ctx, convID, in.SenderID, false)
+	if err != nil {
+		return err
+	}
+	if !role.Outranks(target.Role) {
+		return domain.ErrPermissionDenied
+	}
+	if err := c.session.Lift(ctx, in.SenderID, domain.RestrictionMute); err != nil {
+		return err
+	}
+	return c.publish(ctx, convID, domain.SystemEvent{
+		Event:    domain.EventUnmuted,
+		SenderID: in.SenderID,
+		ActorID:  senderID,
+	})
+}
+
+// target loads the participant a frame acts on. Participants of other rooms are
+// reported as missing rather than forbidden; so are ones that left, if active is set.
+func (c *ManagerService) target(ctx context.Context, convID, senderID string, active bool) (*domain.Participant, error) {
+	p, err := c.session.GetParticipant(ctx, senderID)
+	if err != nil {
+		return nil, err
+	}
+	if p.ConversationID.String() != convID || (active && p.LeftAt != nil) {
+		return nil, domain.ErrParticipantNotFound
+	}
+	return p, nil
+}
+
+// publish sends a system event to every replica, this one included.
+func (c *ManagerService) publish(ctx context.Context, convID string, ev domain.SystemEvent) error {
+	return c.publishEvent(ctx, roomEvent{ConversationID: convID, Event: ev})
+}
+
+func (c *ManagerService) publishEvent(ctx context.Context, re roomEvent) error {
+	re.Event.Type = domain.TypeSystem
+	data, err := json.Marshal(re)
+	if err != nil {
+		return err
+	}
+	if err := c.bus.Publish(ctx, roomEventsChannel, data); err != nil {
+		c.log.ErrorContext(ctx, "manager - publish - bus publish failed", logger.Conversation(re.ConversationID), slog.String("event", re.Event.Event), logger.Err(err))
+		return err
+	}
+	return nil
+}
+
+func (c *ManagerService) Run(ctx context.Context) error {
+	return c.bus.Subscribe(ctx, roomEventsChannel, c.applyRoomEvent)
+}
+
+// applyRoomEvent updates local state for a room event and forwards it to the room's clients.
+func (c *ManagerService) applyRoomEvent(ctx context.Context, data []byte) {
+	var re roomEvent
+	if err := json.Unmarshal(data, &re); err != nil {
+		c.log.ErrorContext(ctx, "manager - apply room event - wrong format", logger.Err(err))
+		return
+	}
+	switch re.Event.Event {
+	case domain.EventRoleChanged:
+		c.update(re.Event.SenderID, func(m *member) { m.role = re.Event.Role })
+	case domain.EventMuted:
+		until := domain.MutedForever
+		if re.Event.MutedUntil != nil {
+			until = *re.Event.MutedUntil
+		}
+		c.update(re.Event.SenderID, func(m *member) { m.mutedUntil = until })
+	case domain.EventUnmuted:
+		c.update(re.Event.SenderID, func(m *member) { m.mutedUntil = time.Time{} })
+	case domain.EventRoomUpdated:
+		if re.Event.Settings != nil {
+			c.limiter.SetConversationType(re.ConversationID, re.Event.Settings.Type)
+		}
+	}
+	c.registry.BroadcastSystem(ctx, re.ConversationID, re.Event)
+	// The removed participant sees the event before its socket closes
+	switch re.Event.Event {
+	case domain.EventKicked:
+		c.registry.DisconnectSender(re.Event.SenderID, domain.CloseKicked, domain.CloseReasonKicked)
+	case domain.EventBanned:
+		c.registry.DisconnectSender(re.Event.SenderID, domain.CloseBanned, domain.CloseReasonBanned)
+		for _, id := range re.Disconnect {
+			c.registry.DisconnectSender(id, domain.CloseBanned, domain.CloseReasonBanned)
+		}
+	}
+}
+
+// remember caches the standing of a participant that connected another device to this node.
+func (c *ManagerService) remember(senderID string, m member) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m.conns = c.members[senderID].conns + 1
+	c.members[senderID] = m
+}
+
+// update changes the cached standing of a participant connected to this node.
+func (c *ManagerService) update(senderID string, fn func(*member)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m, ok := c.members[senderID]; ok {
+		fn(&m)
+		c.members[senderID] = m
+	}
+}
+
+// forget drops one device of senderID and reports whether it was the last on this node.
+func (c *ManagerService) forget(senderID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.members[senderID]
+	if !ok {
+		return true
+	}
+	if m.conns > 1 {
+		m.conns--
+		c.members[senderID] = m
+		return false
+	}
+	delete(c.members, senderID)
+	return true
+}
+
+// memberOf returns the cached standing of a connected participant, falling back to Postgres.
+func (c *ManagerService) memberOf(ctx context.Context, senderID string) (member, error) {
+	c.mu.RLock()
+	m, ok := c.members[senderID]
+	c.mu.RUnlock()
+	if ok {
+		return m, nil
+	}
+	p, err := c.session.GetParticipant(ctx, senderID)
+	if err != nil {
+		return member{}, err
+	}
+	mutedUntil, err := c.session.MutedUntil(ctx, senderID)
+	if err != nil {
+		return member{}, err
+	}
+	return member{role: p.Role, mutedUntil: mutedUntil}, nil
+}
+
+func (m *ManagerService) HandleHistory(ctx context.Context, senderID string, convID string) []domain.Message {
 	ctx, span := tracer.Start(ctx, "ManagerService.HandleHistory", trace.WithAttributes(
 		attribute.String("conv_id", convID),
 	))
@@ -232,17 +857,71 @@ func (m *ManagerService) HandleHistory(ctx context.Context, convID string) []dom
 	var messages []domain.Message
 	if err := uuid.Validate(convID); err != nil {
 		span.RecordError(err)
-		m.log.Error("manager - handle history - wrong conversation id", "conv_id", convID, "err", err)
+		m.log.Error("manager - handle history - wrong conversation id", logger.Conversation(convID), logger.Err(err))
 		return messages
 	}
 	if msgs, err := m.message.GetMessages(ctx, uuid.MustParse(convID)); err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "db read failed")
-		m.log.ErrorContext(ctx, "manager - handle history - get messages failed", "conv_id", convID, "err", err)
+		m.log.ErrorContext(ctx, "manager - handle history - get messages failed", logger.Conversation(convID), logger.Err(err))
 		return messages
 	} else {
+		msgs = m.blocks.FilterMessages(ctx, senderID, msgs)
 		span.SetAttributes(attribute.Int("message_count", len(msgs)))
-		m.log.InfoContext(ctx, "manager - handle history - get messages success", "conv_id", convID, "len_messages", len(msgs))
+		m.log.InfoContext(ctx, "manager - handle history - get messages success", logger.Conversation(convID), "len_messages", len(msgs))
 		return msgs
 	}
 }
+
+// historySince is where a participant's history starts: max(joined_at, now - 1min).
+func historySince(joinedAt time.Time) time.Time {
+	if since := time.Now().Add(-historyWindow); since.After(joinedAt) {
+		return since
+	}
+	return joinedAt
+}
+
+func (m *ManagerService) HandleResync(ctx context.Context, senderID string, convID string, afterSeq int64, since time.Time) []domain.Message {
+	ctx, span := tracer.Start(ctx, "ManagerService.HandleResync", trace.WithAttributes(
+		attribute.String("conv_id", convID),
+		attribute.Int64("after_seq", afterSeq),
+	))
+	defer span.End()
+	if err := uuid.Validate(convID); err != nil {
+		span.RecordError(err)
+		return nil
+	}
+	msgs, err := m.message.GetMessagesAfter(ctx, uuid.MustParse(convID), afterSeq, since, resyncLimit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "db read failed")
+		m.log.ErrorContext(ctx, "manager - handle resync - get messages after failed", logger.Conversation(convID), "after_seq", afterSeq, logger.Err(err))
+		return nil
+	}
+	msgs = m.blocks.FilterMessages(ctx, senderID, msgs)
+	span.SetAttributes(attribute.Int("message_count", len(msgs)))
+	return msgs
+}
+
+func (m *ManagerService) BroadcastPresence(ctx context.Context, convID string) {
+	online, err := m.presStore.GetOnlineParticipants(ctx, convID)
+	if err != nil {
+		m.log.ErrorContext(ctx, "manager - broadcast presence - get online participants failed", logger.Conversation(convID), logger.Err(err))
+		return
+	}
+	ev := domain.PresenceEvent{Type: domain.TypePresence, Online: online}
+	ps, err := m.session.ListParticipants(ctx, convID, ev.Online)
+	if err != nil {
+		// The sender_ids alone are still worth sending
+		m.log.ErrorContext(ctx, "manager - broadcast presence - list participants failed", logger.Conversation(convID), logger.Err(err))
+	}
+	ev.Participants = make([]domain.PresenceParticipant, 0, len(ps))
+	for _, p := range ps {
+		ev.Participants = append(ev.Participants, domain.PresenceParticipant{
+			SenderID:    p.ID.String(),
+			DisplayName: p.DisplayName,
+			AvatarSeed:  p.AvatarSeed,
+		})
+	}
+	m.registry.BroadcastPresence(ctx, convID, ev)
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
+	"livon/internal/core/domain"
+	"livon/internal/core/services/servicestest"
+	"livon/internal/plugins/memory"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testManager is a ManagerService over the memory adapters and fake repositories.
+type testManager struct {
+	*ManagerService
+	convs    *servicestest.Conversations
+	presence *memory.MemoryPresenceStore
+	registry *servicestest.Registry
+	bus      *recordingBus
+}
+
+// recordingBus keeps what is published so a test can apply it to the manager
+// itself instead of racing a subscription.
+type recordingBus struct {
+	contracts.ClusterBus
+	mu        sync.Mutex
+	published [][]byte
+}
+
+func (b *recordingBus) Publish(ctx context.Context, channel string, payload []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.published = append(b.published, payload)
+	return b.ClusterBus.Publish(ctx, channel, payload)
+}
+
+// deliver applies the room events published so far.
+func (m *testManager) deliver(t *testing.T) {
+	t.Helper()
+	m.bus.mu.Lock()
+	published := m.bus.published
+	m.bus.published = nil
+	m.bus.mu.Unlock()
+	for _, data := range published {
+		m.applyRoomEvent(context.Background(), data)
+	}
+}
+
+func newTestManager(t *testing.T) *testManager {
+	t.Helper()
+	log := slog.New(slog.DiscardHandler)
+	tx := NewTxManager(log, servicestest.NewDB())
+	bus := &recordingBus{ClusterBus: memory.NewMemoryClusterBus()}
+	convs := &servicestest.Conversations{}
+	parts := &servicestest.Participants{}
+	presence := memory.NewMemoryPresenceStore()
+	registry := &servicestest.Registry{}
+	cfg := config.WorkerConfig{Partitions: 1}
+	session := NewSessionService(log, parts, &servicestest.Restrictions{}, memory.NewMemoryResumeStore(), tx,
+		config.SessionConfig{ResumeWindow: time.Minute})
+	message := NewMessageService(log, memory.NewMemoryMessageQueue(log, cfg), registry, bus, &servicestest.Messages{}, tx, cfg)
+	access := NewAccessService(log, &servicestest.Access{}, convs, parts, tx,
+		config.InviteConfig{Secret: "test", DefaultTTL: time.Hour, MaxTTL: time.Hour})
+	blocks := NewBlockService(log, &servicestest.Blocks{}, parts, bus)
+	limiter := NewRateLimiter(log, config.RateLimitConfig{
+		Sender:       config.RateLimit{Rate: 10, Burst: 10},
+		Conversation: config.RateLimit{Rate: 100, Burst: 100},
+	})
+	m := NewManagerService(log, convs, presence, session, message, access, blocks, registry, bus, limiter, tx)
+	return &testManager{ManagerService: m, convs: convs, presence: presence, registry: registry, bus: bus}
+}
+
+func (m *testManager) connect(t *testing.T, userID, convID string, opts ConnectOptions) *domain.Session {
+	t.Helper()
+	session, err := m.HandleConnect(context.Background(), userID, convID, opts)
+	if err != nil {
+		t.Fatalf("HandleConnect(%s): %v", userID, err)
+	}
+	return session
+}
+
+func (m *testManager) disconnect(t *testing.T, session *domain.Session) {
+	t.Helper()
+	err := m.HandleDisconnect(context.Background(), session.SenderID.String(), session.ConversationID.String(), session.ConnectionID)
+	if err != nil {
+		t.Fatalf("HandleDisconnect: %v", err)
+	}
+}
+
+func (m *testManager) conversationExists(t *testing.T, convID string) bool {
+	t.Helper()
+	_, err := m.convs.GetConversationByID(context.Background(), uuid.MustParse(convID))
+	if err != nil && !errors.Is(err, domain.ErrConversationNotFound) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func (m *testManager) online(t *testing.T, convID string) []string {
+	t.Helper()
+	online, err := m.presence.GetOnlineParticipants(context.Background(), convID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return online
+}
+
+func TestConnectCreatesConversationForOwner(t *testing.T) {
+	m := newTestManager(t)
+	convID := uuid.NewString()
+	owner := m.connect(t, "alice", convID, ConnectOptions{})
+	if owner.Role != domain.RoleOwner {
+		t.Errorf("creator has role %q, want %q", owner.Role, domain.RoleOwner)
+	}
+	if !m.conversationExists(t, convID) {
+		t.Fatal("conversation was not created")
+	}
+	member := m.connect(t, "bob", convID, ConnectOptions{})
+	if member.Role != domain.RoleMember {
+		t.Errorf("second participant has role %q, want %q", member.Role, domain.RoleMember)
+	}
+	online := m.online(t, convID)
+	slices.Sort(online)
+	want := []string{owner.SenderID.String(), member.SenderID.String()}
+	slices.Sort(want)
+	if !slices.Equal(online, want) {
+		t.Errorf("online %v, want %v", online, want)
+	}
+}
+
+func TestLastDisconnectDeletesConversation(t *testing.T) {
+	m := newTestManager(t)
+	convID := uuid.NewString()
+	session := m.connect(t, "alice", convID, ConnectOptions{})
+	m.disconnect(t, session)
+	if m.conversationExists(t, convID) {
+		t.Error("conversation kept after its last connection left")
+	}
+	if online := m.online(t, convID); len(online) != 0 {
+		t.Errorf("online %v after the last connection left", online)
+	}
+	m.limiter.mu.Lock()
+	_, typed := m.limiter.convTypes[convID]
+	m.limiter.mu.Unlock()
+	if typed {
+		t.Error("rate limiter still holds the conversation")
+	}
+}
+
+func TestDisconnectKeepsRoomWithOthersOnline(t *testing.T) {
+	m := newTestManager(t)
+	convID := uuid.NewString()
+	alice := m.connect(t, "alice", convID, ConnectOptions{})
+	bob := m.connect(t, "bob", convID, ConnectOptions{})
+	m.disconnect(t, alice)
+	if !m.conversationExists(t, convID) {
+		t.Fatal("conversation deleted while a participant is online")
+	}
+	presences := m.registry.Presences(convID)
+	if len(presences) == 0 {
+		t.Fatal("no presence broadcast after a participant left")
+	}
+	if got, want := presences[len(presences)-1].Online, []string{bob.SenderID.String()}; !slices.Equal(got, want) {
+		t.Errorf("presence online %v, want %v", got, want)
+	}
+}
+
+func TestDisconnectKeepsOtherDeviceOnline(t *testing.T) {
+	m := newTestManager(t)
+	convID := uuid.NewString()
+	phone := m.connect(t, "alice", convID, ConnectOptions{})
+	laptop := m.connect(t, "alice", convID, ConnectOptions{})
+	if laptop.SenderID != phone.SenderID {
+		t.Fatalf("second device got identity %s, want %s", laptop.SenderID, phone.SenderID)
+	}
+	m.disconnect(t, phone)
+	if !m.conversationExists(t, convID) {
+		t.Fatal("conversation deleted while another device is connected")
+	}
+	if got, want := m.online(t, convID), []string{laptop.SenderID.String()}; !slices.Equal(got, want) {
+		t.Errorf("online %v, want %v", got, want)
+	}
+}
+
+func TestDrainKeepsEmptyConversation(t *testing.T) {
+	m := newTestManager(t)
+	convID := uuid.NewString()
+	session := m.connect(t, "alice", convID, ConnectOptions{})
+	m.Drain()
+	m.disconnect(t, session)
+	if !m.conversationExists(t, convID) {
+		t.Error("conversation deleted while draining; its session could not resume elsewhere")
+	}
+}
+
+func TestSinceSeqLimitedToHistoryWindow(t *testing.T) {
+	m := newTestManager(t)
+	convID := uuid.NewString()
+	session := m.connect(t, "alice", convID, ConnectOptions{SinceSeq: 5})
+	if session.ResumeSeq != 5 {
+		t.Errorf("resume seq %d, want 5", session.ResumeSeq)
+	}
+	if session.ReplaySince.IsZero() {
+		t.Fatal("since_seq replay is not bounded")
+	}
+	if session.ReplaySince.Before(session.JoinedAt) {
+		t.Errorf("replay reaches back to %v, before joining at %v", session.ReplaySince, session.JoinedAt)
+	}
+}
+
+func TestBanRemovesUsersNewerIdentity(t *testing.T) {
+	m := newTestManager(t)
+	convID := uuid.NewString()
+	owner := m.connect(t, "alice", convID, ConnectOptions{})
+	old := m.connect(t, "bob", convID, ConnectOptions{})
+	current := m.connect(t, "bob", convID, ConnectOptions{ForceNew: true})
+	if current.SenderID == old.SenderID {
+		t.Fatal("ForceNew resumed the old identity")
+	}
+	frame, _ := json.Marshal(domain.InboundFrame{Type: domain.FrameBan, SenderID: old.SenderID.String()})
+	if err := m.HandleMessage(context.Background(), owner.SenderID.String(), convID, owner.ConnectionID, frame); err != nil {
+		t.Fatalf("ban: %v", err)
+	}
+	p, err := m.session.GetParticipant(context.Background(), current.SenderID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.LeftAt == nil {
+		t.Error("the banned user's current identity is still active")
+	}
+	m.deliver(t)
+	if got := m.registry.Disconnected(); !slices.Contains(got, current.SenderID.String()) {
+		t.Errorf("disconnected %v, want the current identity %s", got, current.SenderID)
+	}
+	if _, err := m.HandleConnect(context.Background(), "bob", convID, ConnectOptions{}); !errors.Is(err, domain.ErrBanned) {
+		t.Errorf("reconnect after ban: %v, want %v", err, domain.ErrBanned)
+	}
+}
+
+func TestResumeRejectsBannedUser(t *testing.T) {
+	m := newTestManager(t)
+	convID := uuid.NewString()
+	owner := m.connect(t, "alice", convID, ConnectOptions{})
+	bob := m.connect(t, "bob", convID, ConnectOptions{})
+	if bob.ResumeToken == "" {
+		t.Fatal("no resume token issued")
+	}
+	// A ban that left the identity in place, e.g. one set on an older identity
+	if err := m.session.Restrict(context.Background(), bob.SenderID.String(), domain.RestrictionBan, nil, owner.SenderID.String()); err != nil {
+		t.Fatal(err)
+	}
+	_, err := m.HandleConnect(context.Background(), "bob", convID, ConnectOptions{ResumeToken: bob.ResumeToken})
+	if !errors.Is(err, domain.ErrBanned) {
+		t.Errorf("resume after ban: %v, want %v", err, domain.ErrBanned)
+	}
+}
+
+func TestResumeReadmitsPrivateRoom(t *testing.T) {
+	m := newTestManager(t)
+	convID := uuid.NewString()
+	m.connect(t, "alice", convID, ConnectOptions{})
+	bob := m.connect(t, "bob", convID, ConnectOptions{})
+	ctx := context.Background()
+	if err := m.convs.UpdateVisibility(ctx, uuid.MustParse(convID), domain.VisibilityPrivate); err != nil {
+		t.Fatal(err)
+	}
+	// bob joined while the room was public and was never made a member
+	_, err := m.HandleConnect(ctx, "bob", convID, ConnectOptions{ResumeToken: bob.ResumeToken})
+	if !errors.Is(err, domain.ErrInviteRequired) {
+		t.Errorf("resume into private room: %v, want %v", err, domain.ErrInviteRequired)
+	}
+}
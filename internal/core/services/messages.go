@@ -3,31 +3,64 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"livon/internal/config"
 	"livon/internal/core/contracts"
 	"livon/internal/core/domain"
+	"livon/internal/platform/logger"
+	"livon/internal/platform/metrics"
 	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type IMessageService interface {
 	// ProcessMessage validates the message and optionally sends to redis stream
-	// Sends a Domain AckMessage to trigger the UI "Single Tick"
-	AcceptMessage(ctx context.Context, senderID string, convID string, payload string, clientMsgID string) (domain.MessagePayload, error)
+	// Sends a Domain AckMessage to trigger the UI "Single Tick"; connID is the device it came from
+	AcceptMessage(ctx context.Context, senderID string, convID string, connID string, payload string, clientMsgID string) (domain.MessagePayload, error)
 	// SaveAndBroadcast runs the atomic DB sequence logic and optionally sends to redis pubsub
 	// After DB commit, it triggers the "Double Tick"
 	SaveAndBroadcast(ctx context.Context, payload *domain.MessagePayload) error
+	// SaveAndBroadcastBatch persists payloads of one conversation in one transaction
+	// with consecutive seqs, then broadcasts them in order
+	SaveAndBroadcastBatch(ctx context.Context, payloads []*domain.MessagePayload) error
 	// GetMessages calculates the visibility window: max(joined_at, now - 1min)
 	// and returns filtered messages.
 	GetMessages(ctx context.Context, convID uuid.UUID) ([]domain.Message, error)
+	// GetMessagesAfter returns up to limit messages with seq > afterSeq, created
+	// at or after since, for resync.
+	GetMessagesAfter(ctx context.Context, convID uuid.UUID, afterSeq int64, since time.Time, limit int) ([]domain.Message, error)
+	// EditMessage replaces a persisted message's payload. Editors other than
+	// the author need anyAuthor.
+	EditMessage(ctx context.Context, convID uuid.UUID, seq int64, editorID uuid.UUID, payload string, anyAuthor bool) (*domain.Message, error)
+	// Run delivers messages persisted by any replica to the local registry until ctx is cancelled
+	Run(ctx context.Context) error
+}
+
+// messagesChannel carries persisted messages to every replica, since the node
+// that persists a message is not necessarily the one hosting its recipients.
+const messagesChannel = "livon:messages"
+
+// delivery is the message exchanged on messagesChannel.
+type delivery struct {
+	Message      domain.ChatMessage `json:"message"`
+	Ack          domain.AckMessage  `json:"ack"`
+	ConnectionID string             `json:"connection_id,omitempty"`
+	Trace        map[string]string  `json:"trace,omitempty"` // W3C trace context of the persisting span
 }
 
 type MessageService struct {
-	queue     contracts.MessageQueue // For now no use of redis message queue in message delivery
+	queue     contracts.MessageQueue
 	registry  contracts.Registry
+	bus       contracts.ClusterBus
 	Repo      domain.MessageRepository
 	txManager *TxManager
+	cfg       config.WorkerConfig
 	log       *slog.Logger
 }
 
@@ -35,15 +68,19 @@ func NewMessageService(
 	log *slog.Logger,
 	queue contracts.MessageQueue,
 	registry contracts.Registry,
+	bus contracts.ClusterBus,
 	repo domain.MessageRepository,
 	txManager *TxManager,
+	cfg config.WorkerConfig,
 ) *MessageService {
 	return &MessageService{
 		log:       log,
 		queue:     queue,
 		registry:  registry,
+		bus:       bus,
 		Repo:      repo,
 		txManager: txManager,
+		cfg:       cfg,
 	}
 }
 
@@ -51,15 +88,28 @@ func (w *MessageService) AcceptMessage(
 	ctx context.Context,
 	senderID string,
 	convID string,
+	connID string,
 	payload string,
 	clientMsgID string,
 ) (domain.MessagePayload, error) {
+	topic := PartitionTopic(Partition(convID, w.cfg.Partitions))
+	// Producer span: its context travels with the stream entry to the worker
+	ctx, span := tracer.Start(ctx, "MessageService.AcceptMessage",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "redis"),
+			attribute.String("messaging.destination.name", topic),
+			attribute.String("conv_id", convID),
+		),
+	)
+	defer span.End()
 	message_payload := domain.MessagePayload{
 		ClientMsgID:    clientMsgID,
 		ConversationID: uuid.MustParse(convID),
 		SenderID:       uuid.MustParse(senderID),
 		Payload:        payload,
 		CreatedAt:      time.Now(),
+		ConnectionID:   connID,
 	}
 	// Single tick (only to sender)
 	ack := domain.AckMessage{
@@ -69,11 +119,13 @@ func (w *MessageService) AcceptMessage(
 		Timestamp:   time.Now(),
 	}
 	raw, _ := json.Marshal(message_payload)
-	if err := w.queue.PublishToStream(ctx, convID, raw); err != nil {
-		w.log.ErrorContext(ctx, "messages - accept message - publish to stream failed", "stream", convID, "error", err)
+	if err := w.queue.PublishToStream(ctx, topic, convID, raw); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "publish to stream failed")
+		w.log.ErrorContext(ctx, "messages - accept message - publish to stream failed", logger.Conversation(convID), logger.Err(err))
 		return domain.MessagePayload{}, err
 	}
-	w.log.InfoContext(ctx, "messages - accept message - publish to stream success", "stream", convID)
+	w.log.InfoContext(ctx, "messages - accept message - publish to stream success", logger.Conversation(convID))
 	w.registry.SendAck(ctx, senderID, ack)
 	return message_payload, nil
 }
@@ -93,24 +145,75 @@ func (w *MessageService) SaveAndBroadcast(
 	}
 	var seq int64
 	if err := w.txManager.WithTx(ctx, func(txCtx context.Context) error {
+		txCtx, tSpan := tracer.Start(txCtx, "DB.SaveWithSequence")
+		defer tSpan.End()
 		var txErr error
 		seq, txErr = w.Repo.SaveWithSequence(txCtx, msg)
+		if txErr != nil {
+			tSpan.RecordError(txErr)
+		}
 		return txErr
 	}); err != nil {
-		w.log.ErrorContext(ctx, "messages - save and broadcast - save with sequence failed", "err", err)
+		w.log.ErrorContext(ctx, "messages - save and broadcast - save with sequence failed", logger.Err(err))
 		return err
 	}
-	w.log.InfoContext(ctx, "messages - save and broadcast - save with sequence success", "seq", seq, "conv_id", msg.ConversationID, "sender_id", msg.SenderID)
+	w.log.InfoContext(ctx, "messages - save and broadcast - save with sequence success", logger.Sequence(seq), logger.Conversation(msg.ConversationID.String()), logger.Sender(msg.SenderID.String()))
+	metrics.EnqueueToPersist.Record(ctx, time.Since(payload.CreatedAt).Seconds())
 	msg.Seq = seq
-	// Broadcast message
-	out := domain.ChatMessage{
-		Type:           domain.TypeMessage,
-		ConversationID: msg.ConversationID.String(),
-		SenderID:       msg.SenderID.String(),
-		Seq:            msg.Seq,
-		Payload:        msg.Payload,
-		CreatedAt:      msg.CreatedAt,
+	w.publish(ctx, msg, payload)
+	return nil
+}
+
+// SaveAndBroadcastBatch is SaveAndBroadcast for several payloads of one
+// conversation: a single transaction takes a block of consecutive seqs and
+// inserts every message, then they are fanned out in order. If it fails
+// nothing is persisted.
+func (w *MessageService) SaveAndBroadcastBatch(
+	ctx context.Context,
+	payloads []*domain.MessagePayload,
+) error {
+	if len(payloads) == 0 {
+		return nil
+	}
+	convID := payloads[0].ConversationID
+	msgs := make([]*domain.Message, len(payloads))
+	for i, payload := range payloads {
+		msgs[i] = &domain.Message{
+			ID:             uuid.New(),
+			ConversationID: convID,
+			SenderID:       payload.SenderID,
+			Payload:        payload.Payload,
+			CreatedAt:      payload.CreatedAt,
+		}
 	}
+	if err := w.txManager.WithTx(ctx, func(txCtx context.Context) error {
+		txCtx, tSpan := tracer.Start(txCtx, "DB.SaveBatchWithSequence", trace.WithAttributes(
+			attribute.String("conv_id", convID.String()),
+			attribute.Int("batch.size", len(msgs)),
+		))
+		defer tSpan.End()
+		txErr := w.Repo.SaveBatchWithSequence(txCtx, convID, msgs)
+		if txErr != nil {
+			tSpan.RecordError(txErr)
+		}
+		return txErr
+	}); err != nil {
+		w.log.ErrorContext(ctx, "messages - save and broadcast batch - save batch failed", logger.Conversation(convID.String()), slog.Int("batch", len(msgs)), logger.Err(err))
+		return err
+	}
+	w.log.InfoContext(ctx, "messages - save and broadcast batch - save batch success", logger.Conversation(convID.String()),
+		slog.Int64("first_seq", msgs[0].Seq), slog.Int64("last_seq", msgs[len(msgs)-1].Seq))
+	for i, msg := range msgs {
+		metrics.EnqueueToPersist.Record(ctx, time.Since(payloads[i].CreatedAt).Seconds())
+		w.publish(ctx, msg, payloads[i])
+	}
+	return nil
+}
+
+// publish sends a persisted message and its double tick to every replica.
+func (w *MessageService) publish(ctx context.Context, msg *domain.Message, payload *domain.MessagePayload) {
+	// Broadcast message
+	out := domain.NewChatMessage(msg)
 	// Double tick (only to sender)
 	ack := domain.AckMessage{
 		Type:        domain.TypeAck,
@@ -119,9 +222,44 @@ func (w *MessageService) SaveAndBroadcast(
 		Seq:         msg.Seq,
 		Timestamp:   time.Now(),
 	}
-	w.registry.Broadcast(ctx, msg.ConversationID.String(), out)
-	w.registry.SendAck(ctx, msg.SenderID.String(), ack)
-	return nil
+	bCtx, bSpan := tracer.Start(ctx, "ClusterBus.Publish", trace.WithAttributes(
+		attribute.String("conv_id", msg.ConversationID.String()),
+		attribute.Int64("seq", msg.Seq),
+	))
+	defer bSpan.End()
+	d := delivery{Message: out, Ack: ack, ConnectionID: payload.ConnectionID, Trace: propagation.MapCarrier{}}
+	otel.GetTextMapPropagator().Inject(bCtx, propagation.MapCarrier(d.Trace))
+	data, _ := json.Marshal(d)
+	if err := w.bus.Publish(bCtx, messagesChannel, data); err != nil {
+		// The message is persisted; local recipients still get it and the rest resync
+		bSpan.RecordError(err)
+		w.log.ErrorContext(ctx, "messages - publish - bus publish failed", logger.Conversation(out.ConversationID), logger.Sequence(msg.Seq), logger.Err(err))
+		w.deliver(bCtx, d)
+	}
+}
+
+func (w *MessageService) Run(ctx context.Context) error {
+	return w.bus.Subscribe(ctx, messagesChannel, func(ctx context.Context, data []byte) {
+		var d delivery
+		if err := json.Unmarshal(data, &d); err != nil {
+			w.log.ErrorContext(ctx, "messages - run - wrong delivery", logger.Err(err))
+			return
+		}
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(d.Trace))
+		w.deliver(ctx, d)
+	})
+}
+
+// deliver fans a persisted message out to the local clients of its room and
+// sends the double tick to the author's local devices.
+func (w *MessageService) deliver(ctx context.Context, d delivery) {
+	ctx, span := tracer.Start(ctx, "Registry.Broadcast", trace.WithAttributes(
+		attribute.String("conv_id", d.Message.ConversationID),
+		attribute.Int64("seq", d.Message.Seq),
+	))
+	defer span.End()
+	w.registry.Broadcast(ctx, d.Message.ConversationID, d.Message, d.ConnectionID)
+	w.registry.SendAck(ctx, d.Message.SenderID, d.Ack)
 }
 
 func (m *MessageService) GetMessages(ctx context.Context, cid uuid.UUID) ([]domain.Message, error) {
@@ -135,10 +273,46 @@ func (m *MessageService) GetMessages(ctx context.Context, cid uuid.UUID) ([]doma
 			return nil
 		}
 	}); er != nil {
-		m.log.ErrorContext(ctx, "messages - get messages - get visible messages failed", "conv_id", cid.String())
+		m.log.ErrorContext(ctx, "messages - get messages - get visible messages failed", logger.Conversation(cid.String()))
 		return no_msg, er
 	} else {
-		m.log.InfoContext(ctx, "messages - get messages - get visible messages sucesss", "conv_id", cid.String())
+		m.log.InfoContext(ctx, "messages - get messages - get visible messages sucesss", logger.Conversation(cid.String()))
 		return msgs, nil
 	}
 }
+
+func (m *MessageService) GetMessagesAfter(ctx context.Context, cid uuid.UUID, afterSeq int64, since time.Time, limit int) ([]domain.Message, error) {
+	msgs, err := m.Repo.GetMessagesAfter(ctx, cid, afterSeq, since, limit)
+	if err != nil {
+		m.log.ErrorContext(ctx, "messages - get messages after - query failed", logger.Conversation(cid.String()), "after_seq", afterSeq, logger.Err(err))
+		return nil, err
+	}
+	return msgs, nil
+}
+
+func (m *MessageService) EditMessage(
+	ctx context.Context,
+	cid uuid.UUID,
+	seq int64,
+	editorID uuid.UUID,
+	payload string,
+	anyAuthor bool,
+) (*domain.Message, error) {
+	var edited *domain.Message
+	if err := m.txManager.WithTx(ctx, func(txCtx context.Context) error {
+		msg, err := m.Repo.GetMessageBySeq(txCtx, cid, seq)
+		if err != nil {
+			return err
+		}
+		if msg.SenderID != editorID && !anyAuthor {
+			return domain.ErrPermissionDenied
+		}
+		edited, err = m.Repo.EditMessage(txCtx, cid, seq, payload)
+		return err
+	}); err != nil {
+		m.log.ErrorContext(ctx, "messages - edit message - edit failed", logger.Conversation(cid.String()), logger.Sequence(seq), logger.Sender(editorID.String()), logger.Err(err))
+		return nil, err
+	}
+	m.log.InfoContext(ctx, "messages - edit message - edit success", logger.Conversation(cid.String()), logger.Sequence(seq), logger.Sender(editorID.String()))
+	return edited, nil
+}
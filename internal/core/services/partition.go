@@ -0,0 +1,22 @@
+package services
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// Partition maps a conversation onto one of n stream topics. All messages of
+// a conversation land on the same topic, which keeps them in order.
+func Partition(convID string, n int) int {
+	if n <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(convID))
+	return int(h.Sum32() % uint32(n))
+}
+
+// PartitionTopic names the stream topic of partition p.
+func PartitionTopic(p int) string {
+	return "p" + strconv.Itoa(p)
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"livon/internal/config"
+	"livon/internal/core/domain"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// tokenBucket refills at rate tokens/sec up to burst.
+type tokenBucket struct {
+	tokens float64
+	rate   float64
+	burst  float64
+	last   time.Time
+}
+
+func newTokenBucket(limit config.RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		tokens: float64(limit.Burst),
+		rate:   limit.Rate,
+		burst:  float64(limit.Burst),
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// wait returns how long until one token is available (zero if available now).
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	if b.rate <= 0 {
+		return time.Minute
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+type senderLimitState struct {
+	bucket     *tokenBucket
+	violations []time.Time
+	mutedUntil time.Time
+}
+
+// RateLimiter enforces per-sender and per-conversation token buckets on
+// inbound frames and escalates sustained abuse from drop to mute to disconnect.
+// The buckets live in this node's memory: a conversation whose participants are
+// spread over N replicas may send up to N times its limit.
+type RateLimiter struct {
+	mu        sync.Mutex
+	cfg       config.RateLimitConfig
+	senders   map[string]*senderLimitState
+	convs     map[string]*tokenBucket
+	convTypes map[string]string
+	now       func() time.Time
+	log       *slog.Logger
+}
+
+func NewRateLimiter(log *slog.Logger, cfg config.RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		log:       log,
+		cfg:       cfg,
+		senders:   make(map[string]*senderLimitState),
+		convs:     make(map[string]*tokenBucket),
+		convTypes: make(map[string]string),
+		now:       time.Now,
+	}
+}
+
+// SetConversationType selects the per-type overrides used for a conversation.
+func (r *RateLimiter) SetConversationType(convID, convType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.convTypes[convID] = convType
+}
+
+func (r *RateLimiter) limitsFor(convID string) config.RateLimitOverride {
+	if o, ok := r.cfg.Overrides[r.convTypes[convID]]; ok {
+		return o
+	}
+	return config.RateLimitOverride{Sender: r.cfg.Sender, Conversation: r.cfg.Conversation}
+}
+
+// Allow consumes one token from both the sender and conversation buckets.
+// It returns a *domain.RateLimitError when the frame must be rejected.
+func (r *RateLimiter) Allow(senderID, convID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	limits := r.limitsFor(convID)
+	s := r.senders[senderID]
+	if s == nil {
+		s = &senderLimitState{bucket: newTokenBucket(limits.Sender, now)}
+		r.senders[senderID] = s
+	}
+	if now.Before(s.mutedUntil) {
+		return r.violation(s, now, s.mutedUntil.Sub(now))
+	}
+	cb := r.convs[convID]
+	if cb == nil {
+		cb = newTokenBucket(limits.Conversation, now)
+		r.convs[convID] = cb
+	}
+	s.bucket.refill(now)
+	cb.refill(now)
+	if wait := s.bucket.wait(); wait > 0 {
+		return r.violation(s, now, wait)
+	}
+	if wait := cb.wait(); wait > 0 {
+		// The room is saturated; not the sender's fault, so no escalation.
+		return &domain.RateLimitError{Scope: "conversation", Action: domain.RateLimitDrop, RetryAfter: wait}
+	}
+	s.bucket.tokens--
+	cb.tokens--
+	return nil
+}
+
+// violation records a sender-side rejection and decides the escalation.
+func (r *RateLimiter) violation(s *senderLimitState, now time.Time, wait time.Duration) error {
+	cutoff := now.Add(-r.cfg.ViolationWindow)
+	kept := s.violations[:0]
+	for _, t := range s.violations {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	s.violations = append(kept, now)
+	count := len(s.violations)
+	switch {
+	case r.cfg.DisconnectAfter > 0 && count >= r.cfg.DisconnectAfter:
+		return &domain.RateLimitError{Scope: "sender", Action: domain.RateLimitDisconnect, RetryAfter: r.cfg.MuteDuration}
+	case r.cfg.MuteAfter > 0 && count >= r.cfg.MuteAfter:
+		if now.After(s.mutedUntil) {
+			s.mutedUntil = now.Add(r.cfg.MuteDuration)
+		}
+		return &domain.RateLimitError{Scope: "sender", Action: domain.RateLimitMute, RetryAfter: s.mutedUntil.Sub(now)}
+	default:
+		return &domain.RateLimitError{Scope: "sender", Action: domain.RateLimitDrop, RetryAfter: wait}
+	}
+}
+
+// Forget drops a sender's limiter state unless it is still muted,
+// so reconnecting does not lift a mute.
+func (r *RateLimiter) Forget(senderID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.senders[senderID]; ok && !r.now().Before(s.mutedUntil) {
+		delete(r.senders, senderID)
+	}
+}
+
+// ForgetConversation drops the conversation bucket and its type.
+func (r *RateLimiter) ForgetConversation(convID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.convs, convID)
+	delete(r.convTypes, convID)
+}
@@ -0,0 +1,550 @@
+// Package servicestest provides in-memory stand-ins for the repositories and
+// the registry the services depend on, so service and worker logic can be
+// tested without Postgres. Combined with the memory plugin they cover every
+// port:
+//
+//	tx := services.NewTxManager(log, servicestest.NewDB())
+//	msgs := &servicestest.Messages{}
+//	svc := services.NewMessageService(log, queue, &servicestest.Registry{}, bus, msgs, tx, cfg)
+package servicestest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"livon/internal/core/contracts"
+	"livon/internal/core/domain"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NewDB returns a *sql.DB whose transactions begin and commit without doing
+// anything, for a TxManager over fake repositories. It runs no statements.
+func NewDB() *sql.DB {
+	return sql.OpenDB(nopConnector{})
+}
+
+type nopConnector struct{}
+
+func (nopConnector) Connect(context.Context) (driver.Conn, error) { return nopConn{}, nil }
+func (nopConnector) Driver() driver.Driver                        { return nopDriver{} }
+
+type nopDriver struct{}
+
+func (nopDriver) Open(string) (driver.Conn, error) { return nopConn{}, nil }
+
+type nopConn struct{}
+
+func (nopConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("servicestest: the database runs no statements")
+}
+func (nopConn) Close() error              { return nil }
+func (nopConn) Begin() (driver.Tx, error) { return nopTx{}, nil }
+
+type nopTx struct{}
+
+func (nopTx) Commit() error   { return nil }
+func (nopTx) Rollback() error { return nil }
+
+// Conversations implements domain.ConversationRepository.
+type Conversations struct {
+	mu    sync.Mutex
+	convs map[uuid.UUID]domain.Conversation
+}
+
+func (r *Conversations) GetConversationByID(ctx context.Context, convID uuid.UUID) (*domain.Conversation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.convs[convID]
+	if !ok {
+		return nil, domain.ErrConversationNotFound
+	}
+	return &c, nil
+}
+
+func (r *Conversations) CreateConversation(ctx context.Context, convID uuid.UUID) (*domain.Conversation, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.convs[convID]; ok {
+		return &c, false, nil
+	}
+	if r.convs == nil {
+		r.convs = make(map[uuid.UUID]domain.Conversation)
+	}
+	c := domain.Conversation{
+		ID:             convID,
+		Type:           domain.ConversationTypeGroup,
+		Visibility:     domain.VisibilityPublic,
+		IdentityPolicy: domain.IdentityResume,
+		CreatedAt:      time.Now(),
+	}
+	r.convs[convID] = c
+	return &c, true, nil
+}
+
+func (r *Conversations) DeleteConversation(ctx context.Context, convID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.convs[convID]; !ok {
+		return domain.ErrConversationNotFound
+	}
+	delete(r.convs, convID)
+	return nil
+}
+
+func (r *Conversations) UpdateType(ctx context.Context, convID uuid.UUID, convType string) error {
+	return r.update(convID, func(c *domain.Conversation) { c.Type = convType })
+}
+
+func (r *Conversations) UpdateVisibility(ctx context.Context, convID uuid.UUID, visibility domain.Visibility) error {
+	return r.update(convID, func(c *domain.Conversation) { c.Visibility = visibility })
+}
+
+func (r *Conversations) UpdateIdentityPolicy(ctx context.Context, convID uuid.UUID, policy domain.IdentityPolicy, window time.Duration) error {
+	return r.update(convID, func(c *domain.Conversation) { c.IdentityPolicy, c.ResumeWindow = policy, window })
+}
+
+func (r *Conversations) update(convID uuid.UUID, fn func(c *domain.Conversation)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.convs[convID]
+	if !ok {
+		return domain.ErrConversationNotFound
+	}
+	fn(&c)
+	r.convs[convID] = c
+	return nil
+}
+
+// Participants implements domain.ConversationParticipantRepository.
+type Participants struct {
+	mu    sync.Mutex
+	parts map[uuid.UUID]domain.Participant
+}
+
+func (r *Participants) FindRecentParticipant(ctx context.Context, userID string, convID uuid.UUID) (*domain.Participant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.parts {
+		if p.UserID == userID && p.ConversationID == convID && p.LeftAt == nil {
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *Participants) CreateParticipant(ctx context.Context, p *domain.Participant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, other := range r.parts {
+		if other.ConversationID == p.ConversationID && strings.EqualFold(other.DisplayName, p.DisplayName) {
+			return domain.ErrDisplayNameTaken
+		}
+	}
+	if r.parts == nil {
+		r.parts = make(map[uuid.UUID]domain.Participant)
+	}
+	r.parts[p.ID] = *p
+	return nil
+}
+
+func (r *Participants) UpdatePresence(ctx context.Context, participantID uuid.UUID) error {
+	return r.update(participantID, func(p *domain.Participant) { p.LastSeenAt = time.Now() })
+}
+
+func (r *Participants) LockIdentity(ctx context.Context, userID string, convID uuid.UUID) error {
+	return nil
+}
+
+func (r *Participants) MarkLeft(ctx context.Context, participantID uuid.UUID) error {
+	now := time.Now()
+	return r.update(participantID, func(p *domain.Participant) { p.LeftAt = &now })
+}
+
+func (r *Participants) GetParticipant(ctx context.Context, participantID uuid.UUID) (*domain.Participant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.parts[participantID]
+	if !ok {
+		return nil, domain.ErrParticipantNotFound
+	}
+	return &p, nil
+}
+
+func (r *Participants) SetRole(ctx context.Context, participantID uuid.UUID, role domain.Role) error {
+	return r.update(participantID, func(p *domain.Participant) { p.Role = role })
+}
+
+func (r *Participants) ListParticipants(ctx context.Context, convID uuid.UUID, participantIDs []uuid.UUID) ([]domain.Participant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []domain.Participant
+	for _, id := range participantIDs {
+		if p, ok := r.parts[id]; ok && p.ConversationID == convID {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (r *Participants) update(participantID uuid.UUID, fn func(p *domain.Participant)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.parts[participantID]
+	if !ok {
+		return domain.ErrParticipantNotFound
+	}
+	fn(&p)
+	r.parts[participantID] = p
+	return nil
+}
+
+// Restrictions implements domain.ConversationRestrictionRepository.
+type Restrictions struct {
+	mu    sync.Mutex
+	rests map[restrictionKey]domain.Restriction
+}
+
+type restrictionKey struct {
+	convID uuid.UUID
+	userID string
+	kind   domain.RestrictionKind
+}
+
+func (r *Restrictions) Restrict(ctx context.Context, rest *domain.Restriction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rests == nil {
+		r.rests = make(map[restrictionKey]domain.Restriction)
+	}
+	r.rests[restrictionKey{rest.ConversationID, rest.UserID, rest.Kind}] = *rest
+	return nil
+}
+
+func (r *Restrictions) Lift(ctx context.Context, convID uuid.UUID, userID string, kind domain.RestrictionKind) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.rests, restrictionKey{convID, userID, kind})
+	return nil
+}
+
+func (r *Restrictions) GetActiveRestriction(ctx context.Context, convID uuid.UUID, userID string, kind domain.RestrictionKind) (*domain.Restriction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rest, ok := r.rests[restrictionKey{convID, userID, kind}]
+	if !ok || (rest.ExpiresAt != nil && time.Now().After(*rest.ExpiresAt)) {
+		return nil, domain.ErrRestrictionNotFound
+	}
+	return &rest, nil
+}
+
+// Access implements domain.ConversationAccessRepository. Invites are redeemed
+// under the same conditions as in Postgres.
+type Access struct {
+	mu      sync.Mutex
+	members map[uuid.UUID]map[string]bool
+	invites map[uuid.UUID]domain.Invite
+}
+
+func (r *Access) AddMember(ctx context.Context, convID uuid.UUID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.members == nil {
+		r.members = make(map[uuid.UUID]map[string]bool)
+	}
+	if r.members[convID] == nil {
+		r.members[convID] = make(map[string]bool)
+	}
+	r.members[convID][userID] = true
+	return nil
+}
+
+func (r *Access) RemoveMember(ctx context.Context, convID uuid.UUID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.members[convID], userID)
+	return nil
+}
+
+func (r *Access) IsMember(ctx context.Context, convID uuid.UUID, userID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.members[convID][userID], nil
+}
+
+func (r *Access) AddActiveParticipants(ctx context.Context, convID uuid.UUID) error {
+	return nil
+}
+
+func (r *Access) CreateInvite(ctx context.Context, inv *domain.Invite) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.invites == nil {
+		r.invites = make(map[uuid.UUID]domain.Invite)
+	}
+	r.invites[inv.ID] = *inv
+	return nil
+}
+
+func (r *Access) RedeemInvite(ctx context.Context, convID, inviteID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	inv, ok := r.invites[inviteID]
+	if !ok || inv.ConversationID != convID || inv.RevokedAt != nil ||
+		!time.Now().Before(inv.ExpiresAt) || (inv.SingleUse && inv.UsedAt != nil) {
+		return domain.ErrInviteInvalid
+	}
+	now := time.Now()
+	inv.UsedAt = &now
+	r.invites[inviteID] = inv
+	return nil
+}
+
+func (r *Access) RevokeInvite(ctx context.Context, convID, inviteID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	inv, ok := r.invites[inviteID]
+	if !ok || inv.ConversationID != convID {
+		return domain.ErrInviteNotFound
+	}
+	now := time.Now()
+	inv.RevokedAt = &now
+	r.invites[inviteID] = inv
+	return nil
+}
+
+// Blocks implements domain.BlockRepository.
+type Blocks struct {
+	mu     sync.Mutex
+	blocks map[string]map[uuid.UUID]string // blocker → via → blocked
+}
+
+func (r *Blocks) Block(ctx context.Context, blockerID, blockedID string, via uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.blocks == nil {
+		r.blocks = make(map[string]map[uuid.UUID]string)
+	}
+	if r.blocks[blockerID] == nil {
+		r.blocks[blockerID] = make(map[uuid.UUID]string)
+	}
+	r.blocks[blockerID][via] = blockedID
+	return nil
+}
+
+func (r *Blocks) Unblock(ctx context.Context, blockerID string, via uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.blocks[blockerID], via)
+	return nil
+}
+
+func (r *Blocks) BlockedUsers(ctx context.Context, blockerID string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []string
+	for _, blocked := range r.blocks[blockerID] {
+		ids = append(ids, blocked)
+	}
+	return ids, nil
+}
+
+// Messages implements domain.MessageRepository. Fail, when set, is consulted
+// for every message about to be saved; an error it returns fails the save,
+// and for a batch nothing of it is kept.
+type Messages struct {
+	Fail func(msg *domain.Message) error
+
+	mu   sync.Mutex
+	seqs map[uuid.UUID]int64
+	msgs []domain.Message
+}
+
+// Saved returns the messages of convID in seq order.
+func (r *Messages) Saved(convID uuid.UUID) []domain.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []domain.Message
+	for _, m := range r.msgs {
+		if m.ConversationID == convID {
+			out = append(out, m)
+		}
+	}
+	slices.SortFunc(out, func(a, b domain.Message) int { return int(a.Seq - b.Seq) })
+	return out
+}
+
+func (r *Messages) SaveWithSequence(ctx context.Context, msg *domain.Message) (int64, error) {
+	if err := r.SaveBatchWithSequence(ctx, msg.ConversationID, []*domain.Message{msg}); err != nil {
+		return 0, err
+	}
+	return msg.Seq, nil
+}
+
+func (r *Messages) SaveBatchWithSequence(ctx context.Context, convID uuid.UUID, msgs []*domain.Message) error {
+	if convID == uuid.Nil {
+		return domain.ErrInvalidConversationID
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Fail != nil {
+		for _, m := range msgs {
+			if err := r.Fail(m); err != nil {
+				return err
+			}
+		}
+	}
+	if r.seqs == nil {
+		r.seqs = make(map[uuid.UUID]int64)
+	}
+	for _, m := range msgs {
+		r.seqs[convID]++
+		m.Seq = r.seqs[convID]
+		r.msgs = append(r.msgs, *m)
+	}
+	return nil
+}
+
+func (r *Messages) GetVisibleMessages(ctx context.Context, convID uuid.UUID) ([]domain.Message, error) {
+	since := time.Now().Add(-time.Minute)
+	var out []domain.Message
+	for _, m := range r.Saved(convID) {
+		if !m.CreatedAt.Before(since) {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (r *Messages) GetMessagesAfter(ctx context.Context, convID uuid.UUID, afterSeq int64, since time.Time, limit int) ([]domain.Message, error) {
+	var out []domain.Message
+	for _, m := range r.Saved(convID) {
+		if len(out) == limit {
+			break
+		}
+		if m.Seq > afterSeq && !m.CreatedAt.Before(since) {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (r *Messages) GetMessageBySeq(ctx context.Context, convID uuid.UUID, seq int64) (*domain.Message, error) {
+	for _, m := range r.Saved(convID) {
+		if m.Seq == seq {
+			return &m, nil
+		}
+	}
+	return nil, domain.ErrMessageNotFound
+}
+
+func (r *Messages) EditMessage(ctx context.Context, convID uuid.UUID, seq int64, payload string) (*domain.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, m := range r.msgs {
+		if m.ConversationID == convID && m.Seq == seq {
+			now := time.Now()
+			r.msgs[i].Payload, r.msgs[i].EditedAt = payload, &now
+			out := r.msgs[i]
+			return &out, nil
+		}
+	}
+	return nil, domain.ErrMessageNotFound
+}
+
+// Registry implements contracts.Registry with no local clients. It records
+// what was sent to each room.
+type Registry struct {
+	mu           sync.Mutex
+	messages     map[string][]domain.ChatMessage
+	presences    map[string][]domain.PresenceEvent
+	systems      map[string][]domain.SystemEvent
+	disconnected []string
+}
+
+var _ contracts.Registry = (*Registry)(nil)
+
+// Messages returns the chat messages broadcast to convID so far.
+func (r *Registry) Messages(convID string) []domain.ChatMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.messages[convID])
+}
+
+// Presences returns the presence snapshots broadcast to convID so far.
+func (r *Registry) Presences(convID string) []domain.PresenceEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.presences[convID])
+}
+
+// Systems returns the room events broadcast to convID so far.
+func (r *Registry) Systems(convID string) []domain.SystemEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.systems[convID])
+}
+
+func (r *Registry) Register(c contracts.Client)   {}
+func (r *Registry) Unregister(c contracts.Client) {}
+
+func (r *Registry) SendAck(ctx context.Context, senderID string, ack domain.AckMessage) {}
+
+func (r *Registry) Broadcast(ctx context.Context, convID string, msg domain.ChatMessage, fromConnID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.messages == nil {
+		r.messages = make(map[string][]domain.ChatMessage)
+	}
+	r.messages[convID] = append(r.messages[convID], msg)
+}
+
+func (r *Registry) BroadcastPresence(ctx context.Context, convID string, ev domain.PresenceEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.presences == nil {
+		r.presences = make(map[string][]domain.PresenceEvent)
+	}
+	r.presences[convID] = append(r.presences[convID], ev)
+}
+
+func (r *Registry) BroadcastSystem(ctx context.Context, convID string, ev domain.SystemEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.systems == nil {
+		r.systems = make(map[string][]domain.SystemEvent)
+	}
+	r.systems[convID] = append(r.systems[convID], ev)
+}
+
+func (r *Registry) DisconnectSender(senderID string, code int, reason string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.disconnected = append(r.disconnected, senderID)
+	return false
+}
+
+// Disconnected returns the sender ids disconnected so far.
+func (r *Registry) Disconnected() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.disconnected)
+}
+
+func (r *Registry) DisconnectConversation(convID string, code int, reason string) int {
+	return 0
+}
+
+var (
+	_ domain.ConversationRepository            = (*Conversations)(nil)
+	_ domain.ConversationParticipantRepository = (*Participants)(nil)
+	_ domain.ConversationRestrictionRepository = (*Restrictions)(nil)
+	_ domain.ConversationAccessRepository      = (*Access)(nil)
+	_ domain.BlockRepository                   = (*Blocks)(nil)
+	_ domain.MessageRepository                 = (*Messages)(nil)
+)
@@ -2,7 +2,13 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
 	"livon/internal/core/domain"
+	"livon/internal/platform/logger"
 	"log/slog"
 	"time"
 
@@ -10,56 +16,120 @@ import (
 )
 
 type ISessionService interface {
-	// StartSession determines if a user gets their old sender_id back
-	// or a brand new one based on the 5-minute window or opt-out flag.
-	StartSession(ctx context.Context, userID string, convID string, forceNew bool) (*domain.Session, error)
-	// StopSession marks a participant as having left, breaking the 5-min link.
+	// StartSession determines if a user gets their old sender_id back or a
+	// brand new one, following the conversation's identity policy and the opt-out flag.
+	// A new identity is given role and displayName (generated when empty) and
+	// retires the previous one; a resumed one keeps its own.
+	// Concurrent calls for one user resolve to the same identity.
+	// Users banned from the conversation get ErrBanned.
+	StartSession(ctx context.Context, userID string, conv *domain.Conversation, forceNew bool, role domain.Role, displayName string) (*domain.Session, error)
+	// Resume hands back the identity behind a resume token issued to userID in
+	// convID. It skips identity resolution; the token is used up either way.
+	// Users banned since the token was issued get ErrBanned.
+	Resume(ctx context.Context, userID, convID, token string) (*domain.Session, error)
+	// IssueResumeToken gives the session a new resume token, unless the
+	// conversation never resumes identities
+	IssueResumeToken(ctx context.Context, session *domain.Session) error
+	// SaveResumePoint records the last seq delivered to the session's socket so
+	// a resume replays only what came after; the token lives for the resume window from now
+	SaveResumePoint(ctx context.Context, session *domain.Session, deliveredSeq int64) error
+	// StopSession marks a participant as having left, so it can never be resumed.
 	StopSession(ctx context.Context, senderID, convID string) error
 	// SendHeartbeat updates Redis every 30s and decides when
 	// to flush 'last_seen_at' to Postgres (every 5 mins).
 	SessionSync(ctx context.Context, senderID string, convID string) error
+	// GetParticipant loads the participant behind a sender_id
+	GetParticipant(ctx context.Context, senderID string) (*domain.Participant, error)
+	// ActiveParticipant loads the identity userID has not left in convID, or nil
+	ActiveParticipant(ctx context.Context, userID, convID string) (*domain.Participant, error)
+	// SetRole changes a participant's role
+	SetRole(ctx context.Context, senderID string, role domain.Role) error
+	// ListParticipants loads the given participants of a conversation, e.g. for their pseudonyms
+	ListParticipants(ctx context.Context, convID string, senderIDs []string) ([]domain.Participant, error)
+	// Restrict bans or mutes the user behind senderID; a nil until never expires
+	Restrict(ctx context.Context, senderID string, kind domain.RestrictionKind, until *time.Time, actorID string) error
+	// Lift removes a ban or mute from the user behind senderID
+	Lift(ctx context.Context, senderID string, kind domain.RestrictionKind) error
+	// MutedUntil returns when the user behind senderID may send again (zero if not muted)
+	MutedUntil(ctx context.Context, senderID string) (time.Time, error)
 }
 
 type SessionService struct {
 	memRepo   domain.ConversationParticipantRepository
+	restRepo  domain.ConversationRestrictionRepository
+	resume    contracts.ResumeStore
 	txManager *TxManager
+	cfg       config.SessionConfig
 	log       *slog.Logger
 }
 
 func NewSessionService(
 	log *slog.Logger,
 	memRepo domain.ConversationParticipantRepository,
+	restRepo domain.ConversationRestrictionRepository,
+	resume contracts.ResumeStore,
 	txManager *TxManager,
+	cfg config.SessionConfig,
 ) *SessionService {
 	return &SessionService{
 		log:       log,
 		memRepo:   memRepo,
+		restRepo:  restRepo,
+		resume:    resume,
 		txManager: txManager,
+		cfg:       cfg,
 	}
 }
 
 func (s *SessionService) StartSession(
 	ctx context.Context,
 	userID string,
-	convID string,
+	conv *domain.Conversation,
 	forceNew bool,
+	role domain.Role,
+	displayName string,
 ) (*domain.Session, error) {
-	cid := uuid.MustParse(convID)
+	cid := conv.ID
+	convID := cid.String()
+	if displayName != "" {
+		var err error
+		if displayName, err = domain.NormalizeDisplayName(displayName); err != nil {
+			return nil, err
+		}
+	}
 	var session *domain.Session
 	err := s.txManager.WithTx(ctx, func(txCtx context.Context) error {
-		if !forceNew {
-			p, err := s.memRepo.FindRecentParticipant(txCtx, userID, cid)
-			if err == nil && p != nil {
-				if time.Since(p.LastSeenAt) <= 3*time.Minute && p.LeftAt == nil {
-					session = &domain.Session{
-						UserID:         userID,
-						ConversationID: cid,
-						SenderID:       p.ID,
-						JoinedAt:       p.JoinedAt,
-						IsNewIdentity:  false,
-					}
-					return nil // transaction commits
+		// Bans follow the user, so neither resuming nor a new identity gets past them
+		if _, err := s.restRepo.GetActiveRestriction(txCtx, cid, userID, domain.RestrictionBan); err == nil {
+			return domain.ErrBanned
+		} else if !errors.Is(err, domain.ErrRestrictionNotFound) {
+			return err
+		}
+		// A second connect for the same user waits here and then sees the first one's identity
+		if err := s.memRepo.LockIdentity(txCtx, userID, cid); err != nil {
+			return err
+		}
+		active, err := s.memRepo.FindRecentParticipant(txCtx, userID, cid)
+		if err != nil {
+			return err
+		}
+		if active != nil {
+			if conv.Resumes(active, forceNew, s.cfg.ResumeWindow) {
+				session = &domain.Session{
+					UserID:         userID,
+					ConversationID: cid,
+					SenderID:       active.ID,
+					JoinedAt:       active.JoinedAt,
+					IsNewIdentity:  false,
+					Role:           active.Role,
+					DisplayName:    active.DisplayName,
+					AvatarSeed:     active.AvatarSeed,
 				}
+				return nil // transaction commits
+			}
+			// Only one identity per user stays active
+			if err := s.memRepo.MarkLeft(txCtx, active.ID); err != nil {
+				return err
 			}
 		}
 		// New identity logic
@@ -70,8 +140,10 @@ func (s *SessionService) StartSession(
 			ConversationID: cid,
 			JoinedAt:       now,
 			LastSeenAt:     now,
+			Role:           role,
+			AvatarSeed:     domain.NewAvatarSeed(),
 		}
-		if err := s.memRepo.CreateParticipant(txCtx, p); err != nil {
+		if err := s.createWithPseudonym(txCtx, p, displayName); err != nil {
 			return err
 		}
 		session = &domain.Session{
@@ -80,25 +152,126 @@ func (s *SessionService) StartSession(
 			SenderID:       p.ID,
 			JoinedAt:       p.JoinedAt,
 			IsNewIdentity:  true,
+			Role:           p.Role,
+			DisplayName:    p.DisplayName,
+			AvatarSeed:     p.AvatarSeed,
 		}
 		return nil
 	})
 	if err != nil {
-		s.log.ErrorContext(ctx, "session - start session - create participant failed", "conv_id", convID, "user_id", userID, "error", err)
+		s.log.ErrorContext(ctx, "session - start session - create participant failed", logger.Conversation(convID), logger.User(userID), logger.Err(err))
 		return nil, err
 	}
-	s.log.InfoContext(ctx, "session - start session - create participant success", "conv_id", convID, "user_id", userID, "sender_id", session.SenderID)
+	session.ConversationType = conv.Type
+	if conv.IdentityPolicy != domain.IdentityAlwaysNew {
+		session.ResumeWindow = conv.ResumeWindowOr(s.cfg.ResumeWindow)
+	}
+	s.log.InfoContext(ctx, "session - start session - create participant success", logger.Conversation(convID), logger.User(userID), logger.Sender(session.SenderID.String()))
 	return session, nil
 }
 
+func (s *SessionService) Resume(ctx context.Context, userID, convID, token string) (*domain.Session, error) {
+	state, err := s.resume.Take(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if state.UserID != userID || state.ConversationID != convID {
+		s.log.WarnContext(ctx, "session - resume - token bound elsewhere", logger.Conversation(convID), logger.User(userID))
+		return nil, domain.ErrResumeInvalid
+	}
+	// One primary-key read catches kicks, retired identities and deleted rooms
+	p, err := s.GetParticipant(ctx, state.SenderID)
+	if errors.Is(err, domain.ErrParticipantNotFound) {
+		return nil, domain.ErrResumeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.LeftAt != nil || p.ConversationID.String() != convID {
+		return nil, domain.ErrResumeInvalid
+	}
+	// Bans are held against the user, not the identity, so they need a read of their own
+	if _, err := s.restRepo.GetActiveRestriction(ctx, p.ConversationID, userID, domain.RestrictionBan); err == nil {
+		s.log.WarnContext(ctx, "session - resume - banned", logger.Conversation(convID), logger.User(userID))
+		return nil, domain.ErrBanned
+	} else if !errors.Is(err, domain.ErrRestrictionNotFound) {
+		return nil, err
+	}
+	s.log.InfoContext(ctx, "session - resume - success", logger.Conversation(convID), logger.User(userID), logger.Sender(state.SenderID), logger.Sequence(state.LastDeliveredSeq))
+	return &domain.Session{
+		UserID:           userID,
+		ConversationID:   p.ConversationID,
+		SenderID:         p.ID,
+		JoinedAt:         p.JoinedAt,
+		Role:             p.Role,
+		DisplayName:      p.DisplayName,
+		AvatarSeed:       p.AvatarSeed,
+		ConversationType: state.ConversationType,
+		ResumeWindow:     state.Window,
+		Resumed:          true,
+		ResumeSeq:        state.LastDeliveredSeq,
+	}, nil
+}
+
+func (s *SessionService) IssueResumeToken(ctx context.Context, session *domain.Session) error {
+	if session.ResumeWindow <= 0 {
+		return nil
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	session.ResumeToken = base64.RawURLEncoding.EncodeToString(raw)
+	return s.SaveResumePoint(ctx, session, session.ResumeSeq)
+}
+
+func (s *SessionService) SaveResumePoint(ctx context.Context, session *domain.Session, deliveredSeq int64) error {
+	if session.ResumeToken == "" {
+		return nil
+	}
+	state := domain.ResumeState{
+		UserID:           session.UserID,
+		ConversationID:   session.ConversationID.String(),
+		ConversationType: session.ConversationType,
+		SenderID:         session.SenderID.String(),
+		LastDeliveredSeq: deliveredSeq,
+		Window:           session.ResumeWindow,
+	}
+	if err := s.resume.Save(ctx, session.ResumeToken, state, session.ResumeWindow); err != nil {
+		s.log.ErrorContext(ctx, "session - save resume point - redis save failed", logger.Conversation(state.ConversationID), logger.Sender(state.SenderID), logger.Err(err))
+		return err
+	}
+	return nil
+}
+
+// pseudonymAttempts is how many generated names are tried before giving up.
+const pseudonymAttempts = 8
+
+// createWithPseudonym inserts p under the requested name, or under a generated
+// one that is free in the conversation. Later attempts add a numeric suffix.
+func (s *SessionService) createWithPseudonym(ctx context.Context, p *domain.Participant, requested string) error {
+	if requested != "" {
+		p.DisplayName = requested
+		return s.memRepo.CreateParticipant(ctx, p)
+	}
+	var err error
+	for i := range pseudonymAttempts {
+		p.DisplayName = domain.NewPseudonym(i >= pseudonymAttempts/2)
+		if err = s.memRepo.CreateParticipant(ctx, p); !errors.Is(err, domain.ErrDisplayNameTaken) {
+			return err
+		}
+	}
+	return err
+}
+
 func (s *SessionService) StopSession(ctx context.Context, senderID, convID string) error {
 	if err := s.txManager.WithTx(ctx, func(txCtx context.Context) error {
 		return s.memRepo.MarkLeft(txCtx, uuid.MustParse(senderID))
 	}); err != nil {
-		s.log.ErrorContext(ctx, "session - stop session - mark left failed", "conv_id", convID, "sender_id", senderID, "error", err)
+		s.log.ErrorContext(ctx, "session - stop session - mark left failed", logger.Conversation(convID), logger.Sender(senderID), logger.Err(err))
 		return err
 	}
-	s.log.InfoContext(ctx, "session - stop session - mark left success", "conv_id", convID, "sender_id", senderID)
+	s.log.InfoContext(ctx, "session - stop session - mark left success", logger.Conversation(convID), logger.Sender(senderID))
 	return nil
 }
 
@@ -110,9 +283,121 @@ func (s *SessionService) SessionSync(
 	if err := s.txManager.WithTx(ctx, func(txCtx context.Context) error {
 		return s.memRepo.UpdatePresence(txCtx, uuid.MustParse(senderID))
 	}); err != nil {
-		s.log.ErrorContext(ctx, "session - session sync - postgres update presence failed", "conv_id", convID, "sender_id", senderID, "err", err)
+		s.log.ErrorContext(ctx, "session - session sync - postgres update presence failed", logger.Conversation(convID), logger.Sender(senderID), logger.Err(err))
 		return err
 	}
-	s.log.InfoContext(ctx, "session - session sync - postgres update presence success", "conv_id", convID, "sender_id", senderID)
+	s.log.InfoContext(ctx, "session - session sync - postgres update presence success", logger.Conversation(convID), logger.Sender(senderID))
 	return nil
 }
+
+func (s *SessionService) GetParticipant(ctx context.Context, senderID string) (*domain.Participant, error) {
+	pid, err := uuid.Parse(senderID)
+	if err != nil {
+		return nil, domain.ErrInvalidParticipantID
+	}
+	p, err := s.memRepo.GetParticipant(ctx, pid)
+	if err != nil {
+		s.log.ErrorContext(ctx, "session - get participant - query failed", logger.Sender(senderID), logger.Err(err))
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *SessionService) ActiveParticipant(ctx context.Context, userID, convID string) (*domain.Participant, error) {
+	cid, err := uuid.Parse(convID)
+	if err != nil {
+		return nil, domain.ErrInvalidConversationID
+	}
+	return s.memRepo.FindRecentParticipant(ctx, userID, cid)
+}
+
+func (s *SessionService) SetRole(ctx context.Context, senderID string, role domain.Role) error {
+	if err := s.txManager.WithTx(ctx, func(txCtx context.Context) error {
+		return s.memRepo.SetRole(txCtx, uuid.MustParse(senderID), role)
+	}); err != nil {
+		s.log.ErrorContext(ctx, "session - set role - update failed", logger.Sender(senderID), slog.String("role", string(role)), logger.Err(err))
+		return err
+	}
+	s.log.InfoContext(ctx, "session - set role - update success", logger.Sender(senderID), slog.String("role", string(role)))
+	return nil
+}
+
+func (s *SessionService) Restrict(
+	ctx context.Context,
+	senderID string,
+	kind domain.RestrictionKind,
+	until *time.Time,
+	actorID string,
+) error {
+	if err := s.txManager.WithTx(ctx, func(txCtx context.Context) error {
+		p, err := s.memRepo.GetParticipant(txCtx, uuid.MustParse(senderID))
+		if err != nil {
+			return err
+		}
+		return s.restRepo.Restrict(txCtx, &domain.Restriction{
+			ConversationID: p.ConversationID,
+			UserID:         p.UserID,
+			Kind:           kind,
+			CreatedBy:      uuid.MustParse(actorID),
+			ExpiresAt:      until,
+		})
+	}); err != nil {
+		s.log.ErrorContext(ctx, "session - restrict - insert failed", logger.Sender(senderID), slog.String("kind", string(kind)), logger.Err(err))
+		return err
+	}
+	s.log.InfoContext(ctx, "session - restrict - insert success", logger.Sender(senderID), slog.String("kind", string(kind)), slog.String("actor_id", actorID))
+	return nil
+}
+
+func (s *SessionService) Lift(ctx context.Context, senderID string, kind domain.RestrictionKind) error {
+	if err := s.txManager.WithTx(ctx, func(txCtx context.Context) error {
+		p, err := s.memRepo.GetParticipant(txCtx, uuid.MustParse(senderID))
+		if err != nil {
+			return err
+		}
+		return s.restRepo.Lift(txCtx, p.ConversationID, p.UserID, kind)
+	}); err != nil {
+		s.log.ErrorContext(ctx, "session - lift - delete failed", logger.Sender(senderID), slog.String("kind", string(kind)), logger.Err(err))
+		return err
+	}
+	s.log.InfoContext(ctx, "session - lift - delete success", logger.Sender(senderID), slog.String("kind", string(kind)))
+	return nil
+}
+
+func (s *SessionService) MutedUntil(ctx context.Context, senderID string) (time.Time, error) {
+	pid, err := uuid.Parse(senderID)
+	if err != nil {
+		return time.Time{}, domain.ErrInvalidParticipantID
+	}
+	p, err := s.memRepo.GetParticipant(ctx, pid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	r, err := s.restRepo.GetActiveRestriction(ctx, p.ConversationID, p.UserID, domain.RestrictionMute)
+	switch {
+	case errors.Is(err, domain.ErrRestrictionNotFound):
+		return time.Time{}, nil
+	case err != nil:
+		s.log.ErrorContext(ctx, "session - muted until - query failed", logger.Sender(senderID), logger.Err(err))
+		return time.Time{}, err
+	}
+	if r.ExpiresAt == nil {
+		return domain.MutedForever, nil
+	}
+	return *r.ExpiresAt, nil
+}
+
+func (s *SessionService) ListParticipants(ctx context.Context, convID string, senderIDs []string) ([]domain.Participant, error) {
+	ids := make([]uuid.UUID, 0, len(senderIDs))
+	for _, sid := range senderIDs {
+		if id, err := uuid.Parse(sid); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	ps, err := s.memRepo.ListParticipants(ctx, uuid.MustParse(convID), ids)
+	if err != nil {
+		s.log.ErrorContext(ctx, "session - list participants - query failed", logger.Conversation(convID), logger.Err(err))
+		return nil, err
+	}
+	return ps, nil
+}
@@ -3,12 +3,15 @@ package services
 import (
 	"context"
 	"database/sql"
+	"livon/internal/core/contracts"
+	"livon/internal/platform/logger"
+	"livon/internal/platform/metrics"
 	"log/slog"
-)
-
-type txKeyType struct{}
+	"time"
 
-var txKey = txKeyType{}
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
 
 type TxManager struct {
 	log *slog.Logger
@@ -22,15 +25,23 @@ func NewTxManager(log *slog.Logger, db *sql.DB) *TxManager {
 func (tm *TxManager) WithTx(
 	ctx context.Context,
 	fn func(ctx context.Context) error,
-) error {
+) (err error) {
+	start := time.Now()
+	defer func() {
+		outcome := "commit"
+		if err != nil {
+			outcome = "rollback"
+		}
+		metrics.DBTxDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attribute.String("outcome", outcome)))
+	}()
 	tx, err := tm.db.BeginTx(ctx, nil)
 	if err != nil {
-		tm.log.ErrorContext(ctx, "transaction begin failed", "err", err)
+		tm.log.ErrorContext(ctx, "transaction begin failed", logger.Err(err))
 		return err
 	}
-	ctxWithTx := context.WithValue(ctx, txKey, tx)
+	ctxWithTx := contracts.ContextWithTx(ctx, tx)
 	if err := fn(ctxWithTx); err != nil {
-		tm.log.ErrorContext(ctx, "transaction failed", "err", err)
+		tm.log.ErrorContext(ctx, "transaction failed", logger.Err(err))
 		_ = tx.Rollback()
 		return err
 	}
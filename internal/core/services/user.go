@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"livon/internal/core/contracts" // wherever your interfaces live
 	"livon/internal/core/domain"
+	"livon/internal/platform/logger"
+	"livon/internal/platform/metrics"
 	"log/slog"
 )
 
@@ -26,9 +28,15 @@ func NewUserService(log *slog.Logger, repo domain.UserRepository, twilio contrac
 // RequestOTP initiates the registration/login process
 func (s *UserService) RequestOTP(ctx context.Context, phone string) error {
 	if phone == "" {
+		metrics.RecordOTP(ctx, "send", "invalid")
 		return errors.New("phone number is required")
 	}
-	return s.twilio.SendOTP(ctx, phone)
+	if err := s.twilio.SendOTP(ctx, phone); err != nil {
+		metrics.RecordOTP(ctx, "send", "error")
+		return err
+	}
+	metrics.RecordOTP(ctx, "send", "ok")
+	return nil
 }
 
 // VerifyOTP checks the code and handles the user lifecycle
@@ -36,17 +44,20 @@ func (s *UserService) VerifyOTP(ctx context.Context, phone, code string) (*domai
 	// Verify with Twilio
 	isValid, err := s.twilio.VerifyOTP(ctx, phone, code)
 	if err != nil {
-		s.log.ErrorContext(ctx, "user - verify otp error", "error", err)
+		metrics.RecordOTP(ctx, "verify", "error")
+		s.log.ErrorContext(ctx, "user - verify otp error", logger.Err(err))
 		return nil, fmt.Errorf("verification service error: %w", err)
 	}
 	if !isValid {
-		s.log.ErrorContext(ctx, "user - invalid or expired OTP", "phone", phone)
+		metrics.RecordOTP(ctx, "verify", "invalid")
+		s.log.ErrorContext(ctx, "user - invalid or expired OTP", logger.Phone(phone))
 		return nil, errors.New("invalid or expired OTP")
 	}
+	metrics.RecordOTP(ctx, "verify", "ok")
 	// Persist user (CreateUser uses ON CONFLICT, so it handles existing users)
 	user, err := s.repo.CreateUser(ctx, phone)
 	if err != nil {
-		s.log.ErrorContext(ctx, "user - create user error", "phone", phone, "error", err)
+		s.log.ErrorContext(ctx, "user - create user error", logger.Phone(phone), logger.Err(err))
 		return nil, fmt.Errorf("failed to save user: %w", err)
 	}
 	return user, nil
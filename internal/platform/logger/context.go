@@ -2,13 +2,31 @@ package logger
 
 import (
 	"context"
-	"livon/pkg/middleware"
 	"log/slog"
 )
 
+type loggerKey struct{}
+
+type requestIDKey struct{}
+
+// NewContext returns ctx carrying l, retrieved later with FromContext.
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
 func FromContext(ctx context.Context) *slog.Logger {
-	if l, ok := ctx.Value(middleware.LoggerKey).(*slog.Logger); ok && l != nil {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && l != nil {
 		return l
 	}
 	return slog.Default()
 }
+
+// WithRequestID returns ctx carrying the request ID added to every record logged with it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
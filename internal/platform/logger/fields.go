@@ -42,3 +42,15 @@ func Err(err error) slog.Attr {
 	}
 	return slog.String("error", err.Error())
 }
+
+// Personal data
+
+// Phone logs a phone number with all but its last digits masked.
+func Phone(phone string) slog.Attr {
+	return slog.String("phone", MaskPhone(phone))
+}
+
+// User logs a user ID, which is the user's phone number, masked.
+func User(id string) slog.Attr {
+	return slog.String("user_id", MaskPhone(id))
+}
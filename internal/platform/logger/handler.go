@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContextHandler adds the trace, span and request IDs carried by ctx to every
+// record, and filters records by the level configured for its module.
+type ContextHandler struct {
+	inner  slog.Handler
+	levels *Levels
+	module string
+}
+
+func NewContextHandler(inner slog.Handler, levels *Levels) *ContextHandler {
+	return &ContextHandler{inner: inner, levels: levels}
+}
+
+func (h *ContextHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.levels.Level(h.module)
+}
+
+func (h *ContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(TraceID(sc.TraceID().String()), SpanID(sc.SpanID().String()))
+	}
+	if id := RequestIDFromContext(ctx); id != "" {
+		r.AddAttrs(RequestID(id))
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{inner: h.inner.WithAttrs(attrs), levels: h.levels, module: h.module}
+}
+
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{inner: h.inner.WithGroup(name), levels: h.levels, module: h.module}
+}
+
+// Module returns a logger tagged with module whose level can be changed at
+// runtime independently of the rest of the process.
+func Module(l *slog.Logger, module string) *slog.Logger {
+	h, ok := l.Handler().(*ContextHandler)
+	if !ok {
+		return l.With(slog.String("module", module))
+	}
+	return slog.New(&ContextHandler{
+		inner:  h.inner.WithAttrs([]slog.Attr{slog.String("module", module)}),
+		levels: h.levels,
+		module: module,
+	})
+}
+
+// Sensitive values are masked however they reach the logger.
+var (
+	phoneKeys  = map[string]bool{"phone": true, "user_id": true}
+	secretKeys = map[string]bool{"code": true, "otp": true, "token": true}
+)
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	switch {
+	case phoneKeys[a.Key]:
+		return slog.String(a.Key, MaskPhone(a.Value.String()))
+	case secretKeys[a.Key]:
+		return slog.String(a.Key, "[REDACTED]")
+	}
+	return a
+}
+
+// MaskPhone keeps only the last four characters of a phone number.
+func MaskPhone(phone string) string {
+	if len(phone) <= 4 {
+		return strings.Repeat("*", len(phone))
+	}
+	return strings.Repeat("*", len(phone)-4) + phone[len(phone)-4:]
+}
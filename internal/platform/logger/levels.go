@@ -0,0 +1,114 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Levels holds the process-wide log level and per-module overrides.
+type Levels struct {
+	mu      sync.RWMutex
+	base    slog.Level
+	modules map[string]slog.Level
+}
+
+func NewLevels(base slog.Level) *Levels {
+	return &Levels{base: base, modules: make(map[string]slog.Level)}
+}
+
+// Level returns the level of module, falling back to the process-wide level.
+func (l *Levels) Level(module string) slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if lvl, ok := l.modules[module]; ok {
+		return lvl
+	}
+	return l.base
+}
+
+// Set changes the level of module; an empty module sets the process-wide level.
+func (l *Levels) Set(module string, level slog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if module == "" {
+		l.base = level
+		return
+	}
+	l.modules[module] = level
+}
+
+// Reset removes the override of module.
+func (l *Levels) Reset(module string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.modules, module)
+}
+
+// ParseLevel accepts debug, info, warn and error in any case.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// parseModules reads "module=level,module=level" into l.
+func (l *Levels) parseModules(spec string) error {
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		module, lvl, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid module level %q", pair)
+		}
+		level, err := ParseLevel(lvl)
+		if err != nil {
+			return err
+		}
+		l.Set(strings.TrimSpace(module), level)
+	}
+	return nil
+}
+
+type levelsView struct {
+	Level   string            `json:"level"`
+	Modules map[string]string `json:"modules"`
+}
+
+func (l *Levels) view() levelsView {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	v := levelsView{Level: l.base.String(), Modules: make(map[string]string, len(l.modules))}
+	for m, lvl := range l.modules {
+		v.Modules[m] = lvl.String()
+	}
+	return v
+}
+
+// ServeHTTP lists the levels on GET. PUT ?module=redis&level=debug changes one
+// (no module changes the process-wide level); level=reset drops the override.
+func (l *Levels) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		module := r.URL.Query().Get("module")
+		lvl := r.URL.Query().Get("level")
+		if strings.EqualFold(lvl, "reset") && module != "" {
+			l.Reset(module)
+		} else {
+			level, err := ParseLevel(lvl)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			l.Set(module, level)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(l.view())
+}
@@ -4,41 +4,40 @@ import (
 	"livon/internal/config"
 	"log/slog"
 	"os"
+	"strings"
 )
 
-func NewLogger(cfg config.Config) *slog.Logger {
-	var level slog.Level
+// NewLogger builds the process logger and returns the levels it is filtered by,
+// so they can be adjusted at runtime.
+func NewLogger(cfg config.Config) (*slog.Logger, *Levels) {
 	var handler slog.Handler
-	Level := cfg.Logger.Level
-	Format := cfg.Logger.Format
-	switch Level {
-	case "INFO":
-		level = slog.LevelInfo
-	case "debug":
-		level = slog.LevelDebug
-	case "warn":
-		level = slog.LevelWarn
-	case "error":
-		level = slog.LevelError
+	level, levelErr := ParseLevel(cfg.Logger.Level)
+	levels := NewLevels(level)
+	modulesErr := levels.parseModules(cfg.Logger.Modules)
+	opts := &slog.HandlerOptions{
+		// Filtering happens in ContextHandler so levels can change per module
+		Level:       slog.LevelDebug,
+		AddSource:   true, // critical for incident debugging
+		ReplaceAttr: redact,
 	}
-	switch Format {
+	switch strings.ToUpper(cfg.Logger.Format) {
 	case "TEXT":
-		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-			Level:     level,
-			AddSource: true, // critical for incident debugging
-		})
-	case "JSON":
-		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-			Level:     level,
-			AddSource: true, // critical for incident debugging
-		})
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	default:
+		handler = slog.NewJSONHandler(os.Stdout, opts)
 	}
-	logger := slog.New(handler).With(
+	logger := slog.New(NewContextHandler(handler, levels)).With(
 		slog.String("service", cfg.Service.Name),
 		slog.String("env", cfg.Service.Env),
 		slog.String("address", cfg.Service.Add),
 		slog.Int("pid", os.Getpid()),
 	)
 	slog.SetDefault(logger)
-	return logger
+	if levelErr != nil {
+		logger.Warn("logger - new logger - falling back to info", Err(levelErr))
+	}
+	if modulesErr != nil {
+		logger.Warn("logger - new logger - invalid module levels", Err(modulesErr))
+	}
+	return logger, levels
 }
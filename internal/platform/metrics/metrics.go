@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Instruments are bound to the global MeterProvider, so they are safe to use
+// before telemetry is initialised (they record into a no-op until then).
+var meter = otel.Meter("livon")
+
+var (
+	// WebSocket
+	InboxDepth, _ = meter.Int64UpDownCounter(
+		"livon.ws.inbox.depth",
+		metric.WithDescription("Inbound frames queued across all connections awaiting processing"),
+	)
+	FramesInbound, _ = meter.Int64Counter(
+		"livon.ws.frames.inbound",
+		metric.WithDescription("Frames received from clients"),
+	)
+	FramesOutbound, _ = meter.Int64Counter(
+		"livon.ws.frames.outbound",
+		metric.WithDescription("Frames written to clients"),
+	)
+	FramesDropped, _ = meter.Int64Counter(
+		"livon.ws.frames.dropped",
+		metric.WithDescription("Outbound frames dropped for slow consumers"),
+	)
+	MessageGaps, _ = meter.Int64Counter(
+		"livon.ws.gaps",
+		metric.WithDescription("Holes in a connection's seq order reported with a gap notice"),
+	)
+	HandshakesWaiting, _ = meter.Int64UpDownCounter(
+		"livon.ws.handshakes.waiting",
+		metric.WithDescription("Upgrades queued for a handshake slot"),
+	)
+	HandshakesRejected, _ = meter.Int64Counter(
+		"livon.ws.handshakes.rejected",
+		metric.WithDescription("Upgrades turned away with try_again_later"),
+	)
+
+	// Pipeline
+	EnqueueToPersist, _ = meter.Float64Histogram(
+		"livon.message.enqueue_to_persist.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Time from a frame being accepted to its message being committed"),
+	)
+	StreamBatchSize, _ = meter.Int64Histogram(
+		"livon.stream.batch.size",
+		metric.WithDescription("Stream entries handed to the worker per read"),
+	)
+	StreamDeadLettered, _ = meter.Int64Counter(
+		"livon.stream.dead_lettered",
+		metric.WithDescription("Stream entries moved to a dead-letter stream after exhausting their deliveries"),
+	)
+	DBTxDuration, _ = meter.Float64Histogram(
+		"livon.db.transaction.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("PostgreSQL transaction duration"),
+	)
+
+	// Auth
+	OTPOutcomes, _ = meter.Int64Counter(
+		"livon.otp.outcomes",
+		metric.WithDescription("OTP send and verify attempts by outcome"),
+	)
+
+	// HTTP (names and labels match the golden-signals dashboard)
+	HTTPServerDuration, _ = meter.Float64Histogram(
+		"http.server.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("HTTP request duration"),
+	)
+)
+
+// RecordOTP counts an OTP operation ("send" or "verify") with its outcome.
+func RecordOTP(ctx context.Context, op, outcome string) {
+	OTPOutcomes.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("op", op),
+		attribute.String("outcome", outcome),
+	))
+}
+
+// ObserveRegistry registers the connection and room gauges of the local node.
+func ObserveRegistry(stats func() (connections, rooms int)) error {
+	conns, err := meter.Int64ObservableGauge("livon.ws.connections",
+		metric.WithDescription("Open WebSocket connections on this node"))
+	if err != nil {
+		return err
+	}
+	rooms, err := meter.Int64ObservableGauge("livon.rooms",
+		metric.WithDescription("Conversations with at least one client on this node"))
+	if err != nil {
+		return err
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		c, r := stats()
+		o.ObserveInt64(conns, int64(c))
+		o.ObserveInt64(rooms, int64(r))
+		return nil
+	}, conns, rooms)
+	return err
+}
+
+// StreamBacklog reports the undelivered (lag) and unacknowledged (pending)
+// entries of one stream topic.
+type StreamBacklog func(ctx context.Context, topic string) (lag, pending int64, err error)
+
+// ObserveStreams registers per-topic stream lag and PEL size gauges for the
+// topics returned by topics.
+func ObserveStreams(topics func() []string, backlog StreamBacklog) error {
+	lagGauge, err := meter.Int64ObservableGauge("livon.stream.lag",
+		metric.WithDescription("Stream entries not yet delivered to the consumer group"))
+	if err != nil {
+		return err
+	}
+	pendingGauge, err := meter.Int64ObservableGauge("livon.stream.pending",
+		metric.WithDescription("Stream entries delivered but not acknowledged (PEL size)"))
+	if err != nil {
+		return err
+	}
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for _, topic := range topics() {
+			lag, pending, err := backlog(ctx, topic)
+			if err != nil {
+				continue
+			}
+			attrs := metric.WithAttributes(attribute.String("topic", topic))
+			o.ObserveInt64(lagGauge, lag, attrs)
+			o.ObserveInt64(pendingGauge, pending, attrs)
+		}
+		return nil
+	}, lagGauge, pendingGauge)
+	return err
+}
@@ -4,10 +4,16 @@ import (
 	"context"
 	"errors"
 	"livon/internal/config"
+	"net/http"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
@@ -16,7 +22,9 @@ import (
 // ShutdownFunc is a helper to clean up all providers on app exit
 type ShutdownFunc func(context.Context) error
 
-func InitTelemetry(ctx context.Context, cfg config.Config) (ShutdownFunc, error) {
+// InitTelemetry installs the global tracer and meter providers. The returned
+// handler serves the local Prometheus scrape endpoint.
+func InitTelemetry(ctx context.Context, cfg config.Config) (ShutdownFunc, http.Handler, error) {
 	res, _ := resource.Merge(
 		resource.Default(),
 		resource.NewWithAttributes(
@@ -25,12 +33,20 @@ func InitTelemetry(ctx context.Context, cfg config.Config) (ShutdownFunc, error)
 		),
 	)
 
-	// Tracing (Tempo)
-	traceExporter, _ := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(cfg.Tracer.Address), otlptracegrpc.WithInsecure())
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(traceExporter),
+	// Tracing (Tempo). Without a collector spans are still created, so trace
+	// IDs propagate through the stream and reach the logs.
+	traceOpts := []sdktrace.TracerProviderOption{
 		sdktrace.WithResource(res),
-	)
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Tracer.SampleRatio))),
+	}
+	if cfg.Tracer.Address != "" {
+		traceExporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(cfg.Tracer.Address), otlptracegrpc.WithInsecure())
+		if err != nil {
+			return nil, nil, err
+		}
+		traceOpts = append(traceOpts, sdktrace.WithBatcher(traceExporter))
+	}
+	tp := sdktrace.NewTracerProvider(traceOpts...)
 	otel.SetTracerProvider(tp)
 
 	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
@@ -38,10 +54,36 @@ func InitTelemetry(ctx context.Context, cfg config.Config) (ShutdownFunc, error)
 		propagation.Baggage{},
 	))
 
+	// Metrics: pulled locally on /metrics and pushed to the collector (Prometheus)
+	registry := prometheus.NewRegistry()
+	promExporter, err := otelprom.New(otelprom.WithRegisterer(registry))
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := []sdkmetric.Option{
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(promExporter),
+	}
+	if cfg.Metrics.Address != "" {
+		metricExporter, err := otlpmetricgrpc.New(ctx,
+			otlpmetricgrpc.WithEndpoint(cfg.Metrics.Address),
+			otlpmetricgrpc.WithInsecure(),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, sdkmetric.WithReader(
+			sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(cfg.Metrics.ExportInterval)),
+		))
+	}
+	mp := sdkmetric.NewMeterProvider(opts...)
+	otel.SetMeterProvider(mp)
+
 	// Return a combined shutdown function
 	return func(shutdownCtx context.Context) error {
 		var err error
 		err = errors.Join(err, tp.Shutdown(shutdownCtx)) // Flush Traces
+		err = errors.Join(err, mp.Shutdown(shutdownCtx)) // Flush Metrics
 		return err
-	}, nil
+	}, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}), nil
 }
@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// subscriberBuffer is how far a subscriber may fall behind before it misses messages.
+const subscriberBuffer = 1024
+
+// MemoryClusterBus delivers to the subscribers of the same process, for a
+// single node. Like Redis Pub/Sub it is at-most-once: a subscriber that falls
+// subscriberBuffer messages behind misses the rest.
+type MemoryClusterBus struct {
+	mu   sync.RWMutex
+	subs map[string][]chan []byte
+}
+
+func NewMemoryClusterBus() *MemoryClusterBus {
+	return &MemoryClusterBus{subs: make(map[string][]chan []byte)}
+}
+
+/*
+	type ClusterBus interface {
+		// Publish delivers payload to every current subscriber of channel.
+		Publish(ctx context.Context, channel string, payload []byte) error
+		// Subscribe calls handler for each payload published on channel.
+		// It blocks until ctx is cancelled.
+		Subscribe(ctx context.Context, channel string, handler func(ctx context.Context, payload []byte)) error
+	}
+*/
+
+func (b *MemoryClusterBus) Publish(ctx context.Context, channel string, payload []byte) error {
+	payload = slices.Clone(payload)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, sub := range b.subs[channel] {
+		select {
+		case sub <- payload:
+		default:
+		}
+	}
+	return nil
+}
+
+func (b *MemoryClusterBus) Subscribe(
+	ctx context.Context,
+	channel string,
+	handler func(ctx context.Context, payload []byte),
+) error {
+	sub := make(chan []byte, subscriberBuffer)
+	b.mu.Lock()
+	b.subs[channel] = append(b.subs[channel], sub)
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.subs[channel] = slices.DeleteFunc(b.subs[channel], func(c chan []byte) bool { return c == sub })
+		if len(b.subs[channel]) == 0 {
+			delete(b.subs, channel)
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case payload := <-sub:
+			handler(ctx, payload)
+		}
+	}
+}
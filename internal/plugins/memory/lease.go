@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLeaseStore hands out leases within one process. A single node is the
+// only member, so its pool owns every partition.
+type MemoryLeaseStore struct {
+	mu      sync.Mutex
+	leases  map[string]lease
+	members map[string]map[string]time.Time // group -> member -> expiry
+}
+
+type lease struct {
+	owner   string
+	expires time.Time
+}
+
+func NewMemoryLeaseStore() *MemoryLeaseStore {
+	return &MemoryLeaseStore{
+		leases:  make(map[string]lease),
+		members: make(map[string]map[string]time.Time),
+	}
+}
+
+/*
+	type LeaseStore interface {
+		// Acquire takes key for owner for ttl unless another owner holds it.
+		// An owner that already holds key renews it.
+		Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+		// Release gives key up if owner still holds it.
+		Release(ctx context.Context, key, owner string) error
+		// Heartbeat marks member of group alive for ttl and returns how many
+		// members are alive, member included.
+		Heartbeat(ctx context.Context, group, member string, ttl time.Duration) (int, error)
+	}
+*/
+
+func (s *MemoryLeaseStore) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if l, ok := s.leases[key]; ok && l.owner != owner && now.Before(l.expires) {
+		return false, nil
+	}
+	s.leases[key] = lease{owner: owner, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *MemoryLeaseStore) Release(ctx context.Context, key, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.leases[key]; ok && l.owner == owner {
+		delete(s.leases, key)
+	}
+	return nil
+}
+
+func (s *MemoryLeaseStore) Heartbeat(ctx context.Context, group, member string, ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	members, ok := s.members[group]
+	if !ok {
+		members = make(map[string]time.Time)
+		s.members[group] = members
+	}
+	members[member] = now.Add(ttl)
+	for m, expires := range members {
+		if now.After(expires) {
+			delete(members, m)
+		}
+	}
+	return len(members), nil
+}
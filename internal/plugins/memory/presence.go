@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// onlineWindow matches the Redis store: a connection counts as online for
+// this long after its last update.
+const onlineWindow = 30 * time.Second
+
+// MemoryPresenceStore keeps presence in process, for a single node.
+type MemoryPresenceStore struct {
+	mu    sync.Mutex
+	rooms map[string]*room
+}
+
+// room is one conversation's connections; it expires, like the Redis key,
+// twice the TTL after its last update.
+type room struct {
+	seen    map[member]time.Time
+	expires time.Time
+}
+
+// member is one connection of a sender; every device has its own entry so
+// the sender stays online until the last of them goes quiet.
+type member struct {
+	senderID string
+	connID   string
+}
+
+func NewMemoryPresenceStore() *MemoryPresenceStore {
+	return &MemoryPresenceStore{rooms: make(map[string]*room)}
+}
+
+/*
+	type PresenceStore interface {
+		// UpdateStatus sets the TTL-based keys in Redis for one connection of senderID
+		UpdateOnlineStatus(ctx context.Context, convID string, senderID string, connID string, ttl time.Duration) error
+		// RemoveOnlineStatus drops one connection; the sender stays online while another is fresh
+		RemoveOnlineStatus(ctx context.Context, convID string, senderID string, connID string) error
+		// GetOnlineParticipants returns a list of sender_ids with at least one active connection
+		GetOnlineParticipants(ctx context.Context, convID string) ([]string, error)
+		// Manual clean up
+		ClearConversation(ctx context.Context, convID string) error
+		// ListConversations returns the conversations that have presence entries on any node
+		ListConversations(ctx context.Context) ([]string, error)
+	}
+*/
+
+func (p *MemoryPresenceStore) UpdateOnlineStatus(ctx context.Context, convID, senderID, connID string, ttl time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	r := p.room(convID, now)
+	if r == nil {
+		r = &room{seen: make(map[member]time.Time)}
+		p.rooms[convID] = r
+	}
+	r.seen[member{senderID, connID}] = now
+	r.expires = now.Add(2 * ttl)
+	return nil
+}
+
+func (p *MemoryPresenceStore) RemoveOnlineStatus(ctx context.Context, convID, senderID, connID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r := p.room(convID, time.Now()); r != nil {
+		delete(r.seen, member{senderID, connID})
+	}
+	return nil
+}
+
+func (p *MemoryPresenceStore) GetOnlineParticipants(ctx context.Context, convID string) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	r := p.room(convID, now)
+	if r == nil {
+		return []string{}, nil
+	}
+	threshold := now.Add(-onlineWindow)
+	seen := make(map[string]struct{}, len(r.seen))
+	senders := make([]string, 0, len(r.seen))
+	for m, at := range r.seen {
+		// Remove stale members first (Self-cleaning)
+		if at.Before(threshold) {
+			delete(r.seen, m)
+			continue
+		}
+		if _, ok := seen[m.senderID]; !ok {
+			seen[m.senderID] = struct{}{}
+			senders = append(senders, m.senderID)
+		}
+	}
+	return senders, nil
+}
+
+func (p *MemoryPresenceStore) ClearConversation(ctx context.Context, convID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.rooms, convID)
+	return nil
+}
+
+func (p *MemoryPresenceStore) ListConversations(ctx context.Context) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	convIDs := make([]string, 0, len(p.rooms))
+	for convID := range p.rooms {
+		if p.room(convID, now) != nil {
+			convIDs = append(convIDs, convID)
+		}
+	}
+	return convIDs, nil
+}
+
+// room returns convID's entry unless it has expired, in which case it is
+// dropped; p.mu must be held.
+func (p *MemoryPresenceStore) room(convID string, now time.Time) *room {
+	r, ok := p.rooms[convID]
+	if !ok {
+		return nil
+	}
+	if now.After(r.expires) || len(r.seen) == 0 {
+		delete(p.rooms, convID)
+		return nil
+	}
+	return r
+}
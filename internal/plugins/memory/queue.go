@@ -0,0 +1,471 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
+	"livon/internal/platform/logger"
+	"livon/internal/platform/metrics"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// maxLen caps a topic and its dead letters, as MAXLEN does for the Redis streams.
+const maxLen = 1000
+
+// MemoryMessageQueue keeps the stream topics in process. It follows the Redis
+// adapter: consumer groups, pending entries redelivered after ClaimIdle,
+// dead letters after MaxDeliveries. Entries do not survive a restart and are
+// only seen by consumers of the same process, so it suits a single node.
+type MemoryMessageQueue struct {
+	log *slog.Logger
+	cfg config.WorkerConfig
+
+	mu      sync.Mutex
+	streams map[string]*stream
+	lastID  uint64
+	wake    chan struct{} // closed and replaced whenever entries are added
+}
+
+type stream struct {
+	entries []*entry // in id order
+	dead    []*deadEntry
+	groups  map[string]*group
+}
+
+type entry struct {
+	n       uint64
+	id      string
+	key     string
+	data    []byte
+	headers map[string]string
+}
+
+type deadEntry struct {
+	*entry
+	deliveries int64
+}
+
+type group struct {
+	delivered uint64 // last entry handed to the group
+	pending   map[string]*pending
+}
+
+type pending struct {
+	entry      *entry
+	consumer   string
+	at         time.Time
+	deliveries int64
+}
+
+func NewMemoryMessageQueue(log *slog.Logger, cfg config.WorkerConfig) *MemoryMessageQueue {
+	return &MemoryMessageQueue{
+		log:     log,
+		cfg:     cfg,
+		streams: make(map[string]*stream),
+		wake:    make(chan struct{}),
+	}
+}
+
+/*
+	type MessageQueue interface {
+		// Producer side (Ingest Service)
+		// PublishToStream appends payload to topic. key names the conversation the
+		// entry belongs to, since many conversations share a topic.
+		PublishToStream(ctx context.Context, topic string, key string, payload []byte) error
+		// Consumer side (Worker Service)
+		// ConsumeStreams reads the topics returned by topics in batches of up to
+		// batchSize entries per topic, handed to handler in stream order. topics is
+		// called again before every read, so topics can be added and dropped while
+		// it runs. A newly added topic first takes over the entries still pending
+		// for conGroup, which its previous reader did not finish. Entries stay
+		// pending until acknowledged.
+		ConsumeStreams(ctx context.Context, conGroup string, batchSize int, topics func() []string, handler func(ctx context.Context, topic string, entries []StreamEntry) error) error
+		// AcknowledgeMessage acknowledges redis stream that messages are processed
+		AcknowledgeMessage(ctx context.Context, topic, conGroup string, mesgIDs ...string) error
+		// PurgeKey removes every entry published under key from topic, its pending entries and its dead letters
+		PurgeKey(ctx context.Context, topic, conGroup, key string) error
+		// Deletes Messages from redis stream
+		DeleteMessage(ctx context.Context, topic string, mesgIDs ...string) error
+		// Backlog reports the stream length, lag and pending entries for a consumer group
+		Backlog(ctx context.Context, topic, conGroup string) (StreamBacklog, error)
+		// PendingEntries lists up to count entries delivered to conGroup but not acknowledged
+		PendingEntries(ctx context.Context, topic, conGroup string, count int64) ([]PendingEntry, error)
+		// DeadLetters counts the entries published under key that were set aside after exhausting their deliveries
+		DeadLetters(ctx context.Context, topic, key string) (int64, error)
+		// ReplayDeadLetters moves the dead-lettered entries published under key back onto the stream
+		ReplayDeadLetters(ctx context.Context, topic, key string) (int, error)
+	}
+*/
+
+type handlerFunc = func(ctx context.Context, topic string, entries []contracts.StreamEntry) error
+
+// stream returns topic, creating it if needed; q.mu must be held.
+func (q *MemoryMessageQueue) stream(topic string) *stream {
+	s, ok := q.streams[topic]
+	if !ok {
+		s = &stream{groups: make(map[string]*group)}
+		q.streams[topic] = s
+	}
+	return s
+}
+
+// group returns conGroup of s, creating it at the start of the stream; q.mu must be held.
+func (s *stream) group(conGroup string) *group {
+	g, ok := s.groups[conGroup]
+	if !ok {
+		g = &group{pending: make(map[string]*pending)}
+		s.groups[conGroup] = g
+	}
+	return g
+}
+
+// append adds e under a new id and wakes the consumers; q.mu must be held.
+func (q *MemoryMessageQueue) append(topic string, e *entry) {
+	q.lastID++
+	e.n = q.lastID
+	e.id = strconv.FormatUint(e.n, 10) + "-0"
+	s := q.stream(topic)
+	s.entries = append(s.entries, e)
+	if len(s.entries) > maxLen {
+		trimmed := s.entries[:len(s.entries)-maxLen]
+		s.entries = slices.Clone(s.entries[len(s.entries)-maxLen:])
+		// A trimmed entry can no longer be claimed; drop it from the groups
+		for _, old := range trimmed {
+			for _, g := range s.groups {
+				delete(g.pending, old.id)
+			}
+		}
+	}
+	close(q.wake)
+	q.wake = make(chan struct{})
+}
+
+func (q *MemoryMessageQueue) PublishToStream(ctx context.Context, topic string, key string, payload []byte) error {
+	// Carry the W3C trace context (traceparent, tracestate) next to the payload
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.append(topic, &entry{key: key, data: slices.Clone(payload), headers: carrier})
+	return nil
+}
+
+func (q *MemoryMessageQueue) ConsumeStreams(
+	ctx context.Context,
+	conGroup string,
+	batchSize int,
+	topics func() []string,
+	handler handlerFunc,
+) error {
+	consumerName := uuid.NewString()
+	// Entries are finished even if ctx is cancelled while they are being handled
+	handlerCtx := context.WithoutCancel(ctx)
+	// Topics read in the previous pass; anything else is new to this consumer
+	reading := make(map[string]bool)
+	lastReclaim := time.Now()
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		ready := make([]string, 0, len(reading))
+		next := make(map[string]bool, len(reading))
+		for _, topic := range topics() {
+			if !reading[topic] {
+				q.takeOver(handlerCtx, topic, conGroup, consumerName, batchSize, handler)
+			}
+			next[topic] = true
+			ready = append(ready, topic)
+		}
+		reading = next
+		if len(ready) == 0 {
+			// Nothing owned yet; wait for the next assignment
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		if q.cfg.ClaimIdle > 0 && time.Since(lastReclaim) >= q.cfg.ClaimIdle {
+			for _, topic := range ready {
+				q.reclaim(handlerCtx, topic, conGroup, consumerName, batchSize, handler)
+			}
+			lastReclaim = time.Now()
+		}
+		q.mu.Lock()
+		wake := q.wake
+		batches := make([][]contracts.StreamEntry, len(ready))
+		read := false
+		for i, topic := range ready {
+			batches[i] = q.readNew(topic, conGroup, consumerName, batchSize)
+			read = read || len(batches[i]) > 0
+		}
+		q.mu.Unlock()
+		if !read {
+			select {
+			case <-ctx.Done():
+			case <-wake:
+			case <-time.After(2 * time.Second):
+			}
+			continue
+		}
+		for i, topic := range ready {
+			q.handle(handlerCtx, topic, batches[i], handler)
+		}
+	}
+}
+
+// readNew hands up to count entries the group has not seen yet to consumer; q.mu must be held.
+func (q *MemoryMessageQueue) readNew(topic, conGroup, consumer string, count int) []contracts.StreamEntry {
+	s := q.stream(topic)
+	g := s.group(conGroup)
+	start, _ := slices.BinarySearchFunc(s.entries, g.delivered+1, func(e *entry, n uint64) int {
+		return cmp.Compare(e.n, n)
+	})
+	now := time.Now()
+	var out []contracts.StreamEntry
+	for _, e := range s.entries[start:] {
+		if len(out) == count {
+			break
+		}
+		g.delivered = e.n
+		g.pending[e.id] = &pending{entry: e, consumer: consumer, at: now, deliveries: 1}
+		out = append(out, e.streamEntry())
+	}
+	return out
+}
+
+// takeOver hands every entry still pending in the group to consumer, whoever
+// it was delivered to. Only the topic's owner calls it, so nobody else is
+// working on those entries.
+func (q *MemoryMessageQueue) takeOver(
+	ctx context.Context,
+	topic, conGroup, consumer string,
+	batchSize int,
+	handler handlerFunc,
+) {
+	q.mu.Lock()
+	claimed := q.claim(topic, conGroup, consumer, 0, func(*pending) bool { return true })
+	q.mu.Unlock()
+	for batch := range slices.Chunk(claimed, max(batchSize, 1)) {
+		q.handle(ctx, topic, batch, handler)
+	}
+}
+
+// reclaim retries entries left pending by a failed handler, and dead-letters
+// the ones already delivered MaxDeliveries times.
+func (q *MemoryMessageQueue) reclaim(
+	ctx context.Context,
+	topic, conGroup, consumer string,
+	batchSize int,
+	handler handlerFunc,
+) {
+	q.mu.Lock()
+	idle := time.Now().Add(-q.cfg.ClaimIdle)
+	g := q.stream(topic).group(conGroup)
+	for _, p := range g.sorted() {
+		if p.at.After(idle) || q.cfg.MaxDeliveries <= 0 || p.deliveries < q.cfg.MaxDeliveries {
+			continue
+		}
+		q.deadLetter(ctx, topic, conGroup, p)
+	}
+	claimed := q.claim(topic, conGroup, consumer, batchSize, func(p *pending) bool { return !p.at.After(idle) })
+	q.mu.Unlock()
+	q.handle(ctx, topic, claimed, handler)
+}
+
+// claim redelivers up to count pending entries of the group that match to
+// consumer, in id order, or all of them if count is 0; q.mu must be held.
+func (q *MemoryMessageQueue) claim(topic, conGroup, consumer string, count int, match func(*pending) bool) []contracts.StreamEntry {
+	now := time.Now()
+	var out []contracts.StreamEntry
+	for _, p := range q.stream(topic).group(conGroup).sorted() {
+		if count > 0 && len(out) == count {
+			break
+		}
+		if !match(p) {
+			continue
+		}
+		p.consumer = consumer
+		p.at = now
+		p.deliveries++
+		out = append(out, p.entry.streamEntry())
+	}
+	return out
+}
+
+// deadLetter moves a pending entry to the topic's dead letters; q.mu must be held.
+func (q *MemoryMessageQueue) deadLetter(ctx context.Context, topic, conGroup string, p *pending) {
+	s := q.stream(topic)
+	delete(s.group(conGroup).pending, p.entry.id)
+	s.remove(func(e *entry) bool { return e == p.entry })
+	s.dead = append(s.dead, &deadEntry{entry: p.entry, deliveries: p.deliveries})
+	if len(s.dead) > maxLen {
+		s.dead = slices.Clone(s.dead[len(s.dead)-maxLen:])
+	}
+	metrics.StreamDeadLettered.Add(ctx, 1)
+	q.log.WarnContext(ctx, "memory queue - dead letter - entry set aside", slog.String("topic", topic), logger.Conversation(p.entry.key), slog.String("message_id", p.entry.id), slog.Int64("deliveries", p.deliveries))
+}
+
+// handle passes a batch of entries to handler. Entries it does not
+// acknowledge stay pending and are retried by reclaim.
+func (q *MemoryMessageQueue) handle(ctx context.Context, topic string, entries []contracts.StreamEntry, handler handlerFunc) {
+	if len(entries) == 0 {
+		return
+	}
+	if err := handler(ctx, topic, entries); err != nil {
+		q.log.ErrorContext(ctx, "memory queue - handle - handler failed", slog.String("topic", topic), slog.Int("entries", len(entries)), logger.Err(err))
+	}
+}
+
+func (q *MemoryMessageQueue) AcknowledgeMessage(ctx context.Context, topic, conGroup string, mesgIDs ...string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	g := q.stream(topic).group(conGroup)
+	for _, id := range mesgIDs {
+		delete(g.pending, id)
+	}
+	return nil
+}
+
+func (q *MemoryMessageQueue) DeleteMessage(ctx context.Context, topic string, mesgIDs ...string) error {
+	if len(mesgIDs) == 0 {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := q.stream(topic)
+	s.remove(func(e *entry) bool { return slices.Contains(mesgIDs, e.id) })
+	// A deleted entry can no longer be claimed; drop it from the groups like XAUTOCLAIM does
+	for _, g := range s.groups {
+		for _, id := range mesgIDs {
+			delete(g.pending, id)
+		}
+	}
+	return nil
+}
+
+func (q *MemoryMessageQueue) Backlog(ctx context.Context, topic, conGroup string) (contracts.StreamBacklog, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var b contracts.StreamBacklog
+	s, ok := q.streams[topic]
+	if !ok {
+		return b, nil
+	}
+	b.Length = int64(len(s.entries))
+	if g, ok := s.groups[conGroup]; ok {
+		for _, e := range s.entries {
+			if e.n > g.delivered {
+				b.Lag++
+			}
+		}
+		b.Pending = int64(len(g.pending))
+	}
+	return b, nil
+}
+
+func (q *MemoryMessageQueue) PendingEntries(ctx context.Context, topic, conGroup string, count int64) ([]contracts.PendingEntry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, ok := q.streams[topic]
+	if !ok {
+		return nil, nil
+	}
+	g, ok := s.groups[conGroup]
+	if !ok {
+		return nil, nil
+	}
+	now := time.Now()
+	entries := make([]contracts.PendingEntry, 0, min(int64(len(g.pending)), count))
+	for _, p := range g.sorted() {
+		if int64(len(entries)) == count {
+			break
+		}
+		entries = append(entries, contracts.PendingEntry{
+			ID:         p.entry.id,
+			Consumer:   p.consumer,
+			IdleMs:     now.Sub(p.at).Milliseconds(),
+			Deliveries: p.deliveries,
+		})
+	}
+	return entries, nil
+}
+
+func (q *MemoryMessageQueue) DeadLetters(ctx context.Context, topic, key string) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var n int64
+	if s, ok := q.streams[topic]; ok {
+		for _, d := range s.dead {
+			if d.key == key {
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+func (q *MemoryMessageQueue) ReplayDeadLetters(ctx context.Context, topic, key string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, ok := q.streams[topic]
+	if !ok {
+		return 0, nil
+	}
+	var replay []*deadEntry
+	s.dead = slices.DeleteFunc(s.dead, func(d *deadEntry) bool {
+		if d.key == key {
+			replay = append(replay, d)
+			return true
+		}
+		return false
+	})
+	for _, d := range replay {
+		q.append(topic, &entry{key: d.key, data: d.data, headers: d.headers})
+	}
+	return len(replay), nil
+}
+
+func (q *MemoryMessageQueue) PurgeKey(ctx context.Context, topic, conGroup, key string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, ok := q.streams[topic]
+	if !ok {
+		return nil
+	}
+	g := s.group(conGroup)
+	s.remove(func(e *entry) bool {
+		if e.key == key {
+			delete(g.pending, e.id)
+			return true
+		}
+		return false
+	})
+	s.dead = slices.DeleteFunc(s.dead, func(d *deadEntry) bool { return d.key == key })
+	return nil
+}
+
+func (s *stream) remove(match func(*entry) bool) {
+	s.entries = slices.DeleteFunc(s.entries, match)
+}
+
+// sorted lists the group's pending entries in id order.
+func (g *group) sorted() []*pending {
+	return slices.SortedFunc(maps.Values(g.pending), func(a, b *pending) int {
+		return cmp.Compare(a.entry.n, b.entry.n)
+	})
+}
+
+func (e *entry) streamEntry() contracts.StreamEntry {
+	return contracts.StreamEntry{ID: e.id, Key: e.key, Data: e.data, Headers: maps.Clone(e.headers)}
+}
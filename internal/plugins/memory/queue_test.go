@@ -0,0 +1,20 @@
+package memory
+
+import (
+	"context"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
+	"livon/internal/plugins/queuetest"
+	"log/slog"
+	"testing"
+)
+
+func TestMemoryMessageQueue(t *testing.T) {
+	log := slog.New(slog.DiscardHandler)
+	err := queuetest.TestQueue(context.Background(), func(cfg config.WorkerConfig) contracts.MessageQueue {
+		return NewMemoryMessageQueue(log, cfg)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
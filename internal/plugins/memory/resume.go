@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"context"
+	"livon/internal/core/domain"
+	"sync"
+	"time"
+)
+
+// MemoryResumeStore keeps resume tokens in process, for a single node.
+// Tokens do not survive a restart; those clients fall back to a normal connect.
+type MemoryResumeStore struct {
+	mu        sync.Mutex
+	tokens    map[string]resumeEntry
+	lastSweep time.Time
+}
+
+type resumeEntry struct {
+	state   domain.ResumeState
+	expires time.Time
+}
+
+func NewMemoryResumeStore() *MemoryResumeStore {
+	return &MemoryResumeStore{tokens: make(map[string]resumeEntry)}
+}
+
+/*
+	type ResumeStore interface {
+		// Save stores or replaces the state behind token for ttl.
+		Save(ctx context.Context, token string, state domain.ResumeState, ttl time.Duration) error
+		// Take returns the state behind token and deletes it, so a token is used at
+		// most once. Unknown or expired tokens give domain.ErrResumeInvalid.
+		Take(ctx context.Context, token string) (*domain.ResumeState, error)
+	}
+*/
+
+func (s *MemoryResumeStore) Save(ctx context.Context, token string, state domain.ResumeState, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	// Tokens that are never taken are swept now and then instead of on a timer
+	if now.Sub(s.lastSweep) >= time.Minute {
+		for t, e := range s.tokens {
+			if now.After(e.expires) {
+				delete(s.tokens, t)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.tokens[token] = resumeEntry{state: state, expires: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryResumeStore) Take(ctx context.Context, token string) (*domain.ResumeState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.tokens[token]
+	delete(s.tokens, token)
+	if !ok || time.Now().After(e.expires) {
+		return nil, domain.ErrResumeInvalid
+	}
+	return &e.state, nil
+}
@@ -0,0 +1,25 @@
+package nats
+
+import (
+	"livon/internal/config"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func NewNATSClient(cfg config.NATSConfig) (*nats.Conn, jetstream.JetStream, error) {
+	nc, err := nats.Connect(cfg.URL,
+		nats.Name("livon"),
+		nats.Timeout(cfg.ConnectTimeout),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, nil, err
+	}
+	return nc, js, nil
+}
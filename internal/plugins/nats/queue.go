@@ -0,0 +1,544 @@
+package nats
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
+	"livon/internal/platform/logger"
+	"livon/internal/platform/metrics"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// maxPerKey caps the entries kept per conversation, as MAXLEN caps a Redis stream.
+const maxPerKey = 1000
+
+// NATSMessageQueue keeps the stream topics in one JetStream stream, on the
+// subject <stream>.stream.<topic>.<key>. A consumer group is a durable pull
+// consumer per topic, and an entry's id is its stream sequence. JetStream
+// redelivers entries left unacknowledged for ClaimIdle by itself.
+type NATSMessageQueue struct {
+	js     jetstream.JetStream
+	log    *slog.Logger
+	cfg    config.WorkerConfig
+	prefix string
+	stream jetstream.Stream
+	dead   jetstream.Stream
+
+	mu       sync.Mutex
+	inflight map[string]*inflight // by group/topic/id; acks need the delivered message
+}
+
+// inflight is an entry delivered to a consumer of this process and not yet acknowledged.
+type inflight struct {
+	msg      jetstream.Msg
+	consumer string
+	key      string
+	seq      uint64
+	at       time.Time
+	count    int64
+}
+
+// NewNATSMessageQueue creates or updates the stream and its dead-letter stream.
+func NewNATSMessageQueue(ctx context.Context, log *slog.Logger, js jetstream.JetStream, cfg config.WorkerConfig, ncfg config.NATSConfig) (*NATSMessageQueue, error) {
+	q := &NATSMessageQueue{
+		js:       js,
+		log:      log,
+		cfg:      cfg,
+		prefix:   ncfg.Stream,
+		inflight: make(map[string]*inflight),
+	}
+	var err error
+	q.stream, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:              ncfg.Stream,
+		Subjects:          []string{ncfg.Stream + ".stream.>"},
+		Storage:           jetstream.FileStorage,
+		Replicas:          max(ncfg.Replicas, 1),
+		MaxMsgsPerSubject: maxPerKey,
+		AllowDirect:       true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	q.dead, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:              ncfg.Stream + "-deadletter",
+		Subjects:          []string{ncfg.Stream + ".deadletter.>"},
+		Storage:           jetstream.FileStorage,
+		Replicas:          max(ncfg.Replicas, 1),
+		MaxMsgsPerSubject: maxPerKey,
+		AllowDirect:       true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+/*
+	type MessageQueue interface {
+		// Producer side (Ingest Service)
+		// PublishToStream appends payload to topic. key names the conversation the
+		// entry belongs to, since many conversations share a topic.
+		PublishToStream(ctx context.Context, topic string, key string, payload []byte) error
+		// Consumer side (Worker Service)
+		// ConsumeStreams reads the topics returned by topics in batches of up to
+		// batchSize entries per topic, handed to handler in stream order. topics is
+		// called again before every read, so topics can be added and dropped while
+		// it runs. A newly added topic first takes over the entries still pending
+		// for conGroup, which its previous reader did not finish. Entries stay
+		// pending until acknowledged.
+		ConsumeStreams(ctx context.Context, conGroup string, batchSize int, topics func() []string, handler func(ctx context.Context, topic string, entries []StreamEntry) error) error
+		// AcknowledgeMessage acknowledges redis stream that messages are processed
+		AcknowledgeMessage(ctx context.Context, topic, conGroup string, mesgIDs ...string) error
+		// PurgeKey removes every entry published under key from topic, its pending entries and its dead letters
+		PurgeKey(ctx context.Context, topic, conGroup, key string) error
+		// Deletes Messages from redis stream
+		DeleteMessage(ctx context.Context, topic string, mesgIDs ...string) error
+		// Backlog reports the stream length, lag and pending entries for a consumer group
+		Backlog(ctx context.Context, topic, conGroup string) (StreamBacklog, error)
+		// PendingEntries lists up to count entries delivered to conGroup but not acknowledged
+		PendingEntries(ctx context.Context, topic, conGroup string, count int64) ([]PendingEntry, error)
+		// DeadLetters counts the entries published under key that were set aside after exhausting their deliveries
+		DeadLetters(ctx context.Context, topic, key string) (int64, error)
+		// ReplayDeadLetters moves the dead-lettered entries published under key back onto the stream
+		ReplayDeadLetters(ctx context.Context, topic, key string) (int, error)
+	}
+*/
+
+type handlerFunc = func(ctx context.Context, topic string, entries []contracts.StreamEntry) error
+
+func (q *NATSMessageQueue) subject(topic, key string) string {
+	return q.prefix + ".stream." + topic + "." + key
+}
+
+func (q *NATSMessageQueue) deadSubject(topic, key string) string {
+	return q.prefix + ".deadletter." + topic + "." + key
+}
+
+// consumerName is the durable consumer of conGroup for topic.
+func consumerName(conGroup, topic string) string {
+	return conGroup + "-" + topic
+}
+
+func inflightKey(conGroup, topic, id string) string {
+	return conGroup + "/" + topic + "/" + id
+}
+
+func (q *NATSMessageQueue) PublishToStream(ctx context.Context, topic string, key string, payload []byte) error {
+	msg := nats.NewMsg(q.subject(topic, key))
+	msg.Data = payload
+	// Carry the W3C trace context (traceparent, tracestate) next to the payload;
+	// set directly so the header names keep their case
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	for k, v := range carrier {
+		msg.Header[k] = []string{v}
+	}
+	_, err := q.js.PublishMsg(ctx, msg)
+	return err
+}
+
+// reader is one topic being read by ConsumeStreams.
+type reader struct {
+	cc   jetstream.ConsumeContext
+	stop chan struct{}
+}
+
+type delivered struct {
+	topic string
+	msg   jetstream.Msg
+}
+
+func (q *NATSMessageQueue) ConsumeStreams(
+	ctx context.Context,
+	conGroup string,
+	batchSize int,
+	topics func() []string,
+	handler handlerFunc,
+) error {
+	consumer := uuid.NewString()
+	batchSize = max(batchSize, 1)
+	// Entries are finished even if ctx is cancelled while they are being handled
+	handlerCtx := context.WithoutCancel(ctx)
+	in := make(chan delivered, batchSize)
+	reading := make(map[string]*reader)
+	defer func() {
+		for topic, r := range reading {
+			q.stopReading(conGroup, topic, r)
+		}
+	}()
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		next := make(map[string]*reader, len(reading))
+		for _, topic := range topics() {
+			if r, ok := reading[topic]; ok {
+				next[topic] = r
+				delete(reading, topic)
+				continue
+			}
+			r, err := q.takeOver(ctx, topic, conGroup, batchSize, in)
+			if err != nil {
+				if ctx.Err() == nil {
+					q.log.ErrorContext(ctx, "nats queue - consume - take over failed", slog.String("topic", topic), logger.Err(err))
+				}
+				continue
+			}
+			next[topic] = r
+		}
+		// Whatever is left was dropped; its unacknowledged entries go to the next owner
+		for topic, r := range reading {
+			q.stopReading(conGroup, topic, r)
+		}
+		reading = next
+		if len(reading) == 0 {
+			// Nothing owned yet; wait for the next assignment
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		var first delivered
+		select {
+		case <-ctx.Done():
+			continue
+		case <-time.After(2 * time.Second):
+			continue
+		case first = <-in:
+		}
+		// Take what else has arrived, up to a batch per topic
+		order := make([]string, 0, len(reading))
+		batches := make(map[string][]jetstream.Msg)
+		add := func(d delivered) {
+			if reading[d.topic] == nil {
+				// Prefetched for a topic that was dropped since
+				return
+			}
+			if batches[d.topic] == nil {
+				order = append(order, d.topic)
+			}
+			batches[d.topic] = append(batches[d.topic], d.msg)
+		}
+		add(first)
+	collect:
+		for range batchSize*len(reading) - 1 {
+			select {
+			case d := <-in:
+				add(d)
+			default:
+				break collect
+			}
+		}
+		for _, topic := range order {
+			for batch := range slices.Chunk(batches[topic], batchSize) {
+				q.handle(handlerCtx, topic, conGroup, consumer, batch, handler)
+			}
+		}
+	}
+}
+
+// takeOver prepares topic for reading and starts pulling it into in. If the
+// group's consumer still has unacknowledged entries, the previous reader did
+// not finish them: the consumer is recreated from its ack floor, so they are
+// delivered again, in order, ahead of new entries. Acknowledged entries are
+// deleted by the worker, so they are not delivered twice. Only the topic's
+// owner calls it, so nobody else is working on those entries.
+func (q *NATSMessageQueue) takeOver(ctx context.Context, topic, conGroup string, batchSize int, in chan<- delivered) (*reader, error) {
+	name := consumerName(conGroup, topic)
+	cfg := jetstream.ConsumerConfig{
+		Durable:       name,
+		FilterSubject: q.subject(topic, "*"),
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       q.cfg.ClaimIdle,
+		// Dead letters are handled here, so the server never gives up on an entry
+		MaxDeliver: -1,
+	}
+	cons, err := q.stream.Consumer(ctx, name)
+	switch {
+	case errors.Is(err, jetstream.ErrConsumerNotFound):
+		cons, err = q.stream.CreateOrUpdateConsumer(ctx, cfg)
+	case err == nil:
+		var info *jetstream.ConsumerInfo
+		if info, err = cons.Info(ctx); err != nil {
+			return nil, err
+		}
+		if info.NumAckPending == 0 {
+			break
+		}
+		if err = q.stream.DeleteConsumer(ctx, name); err != nil {
+			return nil, err
+		}
+		cfg.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+		cfg.OptStartSeq = info.AckFloor.Stream + 1
+		cons, err = q.stream.CreateOrUpdateConsumer(ctx, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{stop: make(chan struct{})}
+	r.cc, err = cons.Consume(func(msg jetstream.Msg) {
+		select {
+		case in <- delivered{topic: topic, msg: msg}:
+		case <-r.stop:
+		}
+	},
+		jetstream.PullMaxMessages(batchSize),
+		jetstream.ConsumeErrHandler(func(_ jetstream.ConsumeContext, err error) {
+			q.log.WarnContext(ctx, "nats queue - consume - pull failed", slog.String("topic", topic), logger.Err(err))
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// stopReading stops pulling topic and forgets its unacknowledged entries.
+func (q *NATSMessageQueue) stopReading(conGroup, topic string, r *reader) {
+	r.cc.Stop()
+	close(r.stop)
+	prefix := inflightKey(conGroup, topic, "")
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for k := range q.inflight {
+		if strings.HasPrefix(k, prefix) {
+			delete(q.inflight, k)
+		}
+	}
+}
+
+// handle passes a batch of entries to handler, setting aside those already
+// delivered MaxDeliveries times. Entries it does not acknowledge are
+// delivered again once ClaimIdle has passed.
+func (q *NATSMessageQueue) handle(
+	ctx context.Context,
+	topic, conGroup, consumer string,
+	msgs []jetstream.Msg,
+	handler handlerFunc,
+) {
+	entries := make([]contracts.StreamEntry, 0, len(msgs))
+	for _, msg := range msgs {
+		md, err := msg.Metadata()
+		if err != nil {
+			q.log.WarnContext(ctx, "nats queue - handle - entry without metadata", slog.String("topic", topic), logger.Err(err))
+			continue
+		}
+		key := msg.Subject()[strings.LastIndexByte(msg.Subject(), '.')+1:]
+		id := strconv.FormatUint(md.Sequence.Stream, 10)
+		if q.cfg.MaxDeliveries > 0 && int64(md.NumDelivered) > q.cfg.MaxDeliveries {
+			if err := q.deadLetter(ctx, topic, key, id, msg, int64(md.NumDelivered)-1); err != nil {
+				q.log.ErrorContext(ctx, "nats queue - handle - dead letter failed", slog.String("topic", topic), slog.String("message_id", id), logger.Err(err))
+			}
+			continue
+		}
+		q.mu.Lock()
+		q.inflight[inflightKey(conGroup, topic, id)] = &inflight{
+			msg:      msg,
+			consumer: consumer,
+			key:      key,
+			seq:      md.Sequence.Stream,
+			at:       time.Now(),
+			count:    int64(md.NumDelivered),
+		}
+		q.mu.Unlock()
+		e := contracts.StreamEntry{ID: id, Key: key, Data: msg.Data(), Headers: make(map[string]string)}
+		for k, v := range msg.Headers() {
+			if len(v) > 0 {
+				e.Headers[k] = v[0]
+			}
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		return
+	}
+	if err := handler(ctx, topic, entries); err != nil {
+		q.log.ErrorContext(ctx, "nats queue - handle - handler failed", slog.String("topic", topic), slog.Int("entries", len(entries)), logger.Err(err))
+	}
+}
+
+// deadLetter copies an entry to the dead-letter stream and removes it from
+// the stream.
+func (q *NATSMessageQueue) deadLetter(ctx context.Context, topic, key, id string, msg jetstream.Msg, deliveries int64) error {
+	dl := nats.NewMsg(q.deadSubject(topic, key))
+	dl.Data = msg.Data()
+	maps.Copy(dl.Header, msg.Headers())
+	dl.Header["deliveries"] = []string{strconv.FormatInt(deliveries, 10)}
+	dl.Header["original_id"] = []string{id}
+	if _, err := q.js.PublishMsg(ctx, dl); err != nil {
+		return err
+	}
+	if err := msg.Term(); err != nil {
+		return err
+	}
+	if err := q.DeleteMessage(ctx, topic, id); err != nil {
+		return err
+	}
+	metrics.StreamDeadLettered.Add(ctx, 1)
+	q.log.WarnContext(ctx, "nats queue - dead letter - entry set aside", slog.String("topic", topic), logger.Conversation(key), slog.String("message_id", id), slog.Int64("deliveries", deliveries))
+	return nil
+}
+
+func (q *NATSMessageQueue) AcknowledgeMessage(ctx context.Context, topic, conGroup string, mesgIDs ...string) error {
+	var errs []error
+	for _, id := range mesgIDs {
+		k := inflightKey(conGroup, topic, id)
+		q.mu.Lock()
+		f, ok := q.inflight[k]
+		delete(q.inflight, k)
+		q.mu.Unlock()
+		// Unknown ids were never delivered here, or were already acknowledged.
+		// The ack is confirmed, as XACK is, so a delete that follows cannot
+		// overtake it.
+		if ok {
+			errs = append(errs, f.msg.DoubleAck(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (q *NATSMessageQueue) DeleteMessage(ctx context.Context, topic string, mesgIDs ...string) error {
+	for _, id := range mesgIDs {
+		seq, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return err
+		}
+		if err := q.stream.DeleteMsg(ctx, seq); err != nil && !errors.Is(err, jetstream.ErrMsgNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *NATSMessageQueue) Backlog(ctx context.Context, topic, conGroup string) (contracts.StreamBacklog, error) {
+	var b contracts.StreamBacklog
+	length, err := count(ctx, q.stream, q.subject(topic, "*"))
+	if err != nil {
+		return b, err
+	}
+	b.Length = length
+	cons, err := q.stream.Consumer(ctx, consumerName(conGroup, topic))
+	if errors.Is(err, jetstream.ErrConsumerNotFound) {
+		// Group not created yet; nothing was delivered
+		b.Lag = b.Length
+		return b, nil
+	}
+	if err != nil {
+		return b, err
+	}
+	info, err := cons.Info(ctx)
+	if err != nil {
+		return b, err
+	}
+	b.Lag = int64(info.NumPending)
+	b.Pending = int64(info.NumAckPending)
+	return b, nil
+}
+
+// PendingEntries lists the unacknowledged entries delivered to this process;
+// JetStream does not list those of other clients.
+func (q *NATSMessageQueue) PendingEntries(ctx context.Context, topic, conGroup string, count int64) ([]contracts.PendingEntry, error) {
+	prefix := inflightKey(conGroup, topic, "")
+	q.mu.Lock()
+	var pending []*inflight
+	for k, f := range q.inflight {
+		if strings.HasPrefix(k, prefix) {
+			pending = append(pending, f)
+		}
+	}
+	q.mu.Unlock()
+	slices.SortFunc(pending, func(a, b *inflight) int { return cmp.Compare(a.seq, b.seq) })
+	now := time.Now()
+	entries := make([]contracts.PendingEntry, 0, min(int64(len(pending)), count))
+	for _, f := range pending {
+		if int64(len(entries)) == count {
+			break
+		}
+		entries = append(entries, contracts.PendingEntry{
+			ID:         strconv.FormatUint(f.seq, 10),
+			Consumer:   f.consumer,
+			IdleMs:     now.Sub(f.at).Milliseconds(),
+			Deliveries: f.count,
+		})
+	}
+	return entries, nil
+}
+
+func (q *NATSMessageQueue) DeadLetters(ctx context.Context, topic, key string) (int64, error) {
+	return count(ctx, q.dead, q.deadSubject(topic, key))
+}
+
+func (q *NATSMessageQueue) ReplayDeadLetters(ctx context.Context, topic, key string) (int, error) {
+	subject := q.deadSubject(topic, key)
+	replayed := 0
+	var seq uint64 = 1
+	for {
+		raw, err := q.dead.GetMsg(ctx, seq, jetstream.WithGetMsgSubject(subject))
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			return replayed, nil
+		}
+		if err != nil {
+			return replayed, err
+		}
+		msg := nats.NewMsg(q.subject(topic, key))
+		msg.Data = raw.Data
+		maps.Copy(msg.Header, raw.Header)
+		delete(msg.Header, "deliveries")
+		delete(msg.Header, "original_id")
+		if _, err := q.js.PublishMsg(ctx, msg); err != nil {
+			return replayed, err
+		}
+		if err := q.dead.DeleteMsg(ctx, raw.Sequence); err != nil {
+			return replayed, err
+		}
+		replayed++
+		seq = raw.Sequence + 1
+	}
+}
+
+func (q *NATSMessageQueue) PurgeKey(ctx context.Context, topic, conGroup, key string) error {
+	if err := q.stream.Purge(ctx, jetstream.WithPurgeSubject(q.subject(topic, key))); err != nil {
+		return err
+	}
+	if err := q.dead.Purge(ctx, jetstream.WithPurgeSubject(q.deadSubject(topic, key))); err != nil {
+		return err
+	}
+	// Purged entries are gone from the consumer too; only the local view is left
+	prefix := inflightKey(conGroup, topic, "")
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for k, f := range q.inflight {
+		if strings.HasPrefix(k, prefix) && f.key == key {
+			delete(q.inflight, k)
+		}
+	}
+	return nil
+}
+
+// count returns how many entries of stream are on subjects matching filter.
+func count(ctx context.Context, stream jetstream.Stream, filter string) (int64, error) {
+	info, err := stream.Info(ctx, jetstream.WithSubjectFilter(filter))
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, c := range info.State.Subjects {
+		n += int64(c)
+	}
+	return n, nil
+}
@@ -0,0 +1,62 @@
+package nats
+
+import (
+	"context"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
+	"livon/internal/plugins/queuetest"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// runServer starts an embedded JetStream server that stops with the test.
+func runServer(t *testing.T) *server.Server {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Start()
+	t.Cleanup(srv.Shutdown)
+	if !srv.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	return srv
+}
+
+func TestNATSMessageQueue(t *testing.T) {
+	srv := runServer(t)
+	ncfg := config.NATSConfig{
+		URL:            srv.ClientURL(),
+		Stream:         "queuetest",
+		Replicas:       1,
+		ConnectTimeout: 2 * time.Second,
+	}
+	nc, js, err := NewNATSClient(ncfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	ctx := context.Background()
+	log := slog.New(slog.DiscardHandler)
+	err = queuetest.TestQueue(ctx, func(cfg config.WorkerConfig) contracts.MessageQueue {
+		q, err := NewNATSMessageQueue(ctx, log, js, cfg, ncfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
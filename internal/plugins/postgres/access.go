@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"livon/internal/core/domain"
+
+	"github.com/google/uuid"
+)
+
+type AccessRepo struct {
+	db *sql.DB
+}
+
+func NewAccessRepo(db *sql.DB) *AccessRepo {
+	return &AccessRepo{db: db}
+}
+
+/*
+	type ConversationAccessRepository interface {
+		AddMember(ctx context.Context, convID uuid.UUID, userID string) error
+		RemoveMember(ctx context.Context, convID uuid.UUID, userID string) error
+		IsMember(ctx context.Context, convID uuid.UUID, userID string) (bool, error)
+		// AddActiveParticipants makes everyone currently in the conversation a member
+		AddActiveParticipants(ctx context.Context, convID uuid.UUID) error
+		CreateInvite(ctx context.Context, inv *Invite) error
+		// RedeemInvite consumes a use; ErrInviteInvalid if it is unknown, expired, revoked or used up
+		RedeemInvite(ctx context.Context, convID, inviteID uuid.UUID) error
+		RevokeInvite(ctx context.Context, convID, inviteID uuid.UUID) error
+	}
+*/
+
+func (r *AccessRepo) AddMember(ctx context.Context, convID uuid.UUID, userID string) error {
+	if convID == uuid.Nil {
+		return domain.ErrInvalidConversationID
+	}
+	exec := GetExecutor(ctx, r.db)
+	_, err := exec.ExecContext(ctx, `
+		INSERT INTO conversation_members (conversation_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (conversation_id, user_id) DO NOTHING
+	`, convID, userID)
+	return err
+}
+
+func (r *AccessRepo) RemoveMember(ctx context.Context, convID uuid.UUID, userID string) error {
+	if convID == uuid.Nil {
+		return domain.ErrInvalidConversationID
+	}
+	exec := GetExecutor(ctx, r.db)
+	_, err := exec.ExecContext(ctx, `
+		DELETE FROM conversation_members
+		WHERE conversation_id = $1 AND user_id = $2
+	`, convID, userID)
+	return err
+}
+
+func (r *AccessRepo) IsMember(ctx context.Context, convID uuid.UUID, userID string) (bool, error) {
+	if convID == uuid.Nil {
+		return false, domain.ErrInvalidConversationID
+	}
+	exec := GetExecutor(ctx, r.db)
+	var member bool
+	err := exec.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM conversation_members
+			WHERE conversation_id = $1 AND user_id = $2
+		)
+	`, convID, userID).Scan(&member)
+	return member, err
+}
+
+func (r *AccessRepo) AddActiveParticipants(ctx context.Context, convID uuid.UUID) error {
+	if convID == uuid.Nil {
+		return domain.ErrInvalidConversationID
+	}
+	exec := GetExecutor(ctx, r.db)
+	_, err := exec.ExecContext(ctx, `
+		INSERT INTO conversation_members (conversation_id, user_id)
+		SELECT DISTINCT conversation_id, user_id
+		FROM conversation_participants
+		WHERE conversation_id = $1 AND left_at IS NULL
+		ON CONFLICT (conversation_id, user_id) DO NOTHING
+	`, convID)
+	return err
+}
+
+func (r *AccessRepo) CreateInvite(ctx context.Context, inv *domain.Invite) error {
+	if inv.ConversationID == uuid.Nil {
+		return domain.ErrInvalidConversationID
+	}
+	exec := GetExecutor(ctx, r.db)
+	return exec.QueryRowContext(ctx, `
+		INSERT INTO conversation_invites (id, conversation_id, created_by, expires_at, single_use)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at
+	`, inv.ID, inv.ConversationID, inv.CreatedBy, inv.ExpiresAt, inv.SingleUse).Scan(&inv.CreatedAt)
+}
+
+func (r *AccessRepo) RedeemInvite(ctx context.Context, convID, inviteID uuid.UUID) error {
+	if convID == uuid.Nil {
+		return domain.ErrInvalidConversationID
+	}
+	exec := GetExecutor(ctx, r.db)
+	// One statement, so two holders of a single-use invite cannot both redeem it
+	result, err := exec.ExecContext(ctx, `
+		UPDATE conversation_invites
+		SET used_at = now()
+		WHERE id = $1
+		  AND conversation_id = $2
+		  AND revoked_at IS NULL
+		  AND expires_at > now()
+		  AND (NOT single_use OR used_at IS NULL)
+	`, inviteID, convID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrInviteInvalid
+	}
+	return nil
+}
+
+func (r *AccessRepo) RevokeInvite(ctx context.Context, convID, inviteID uuid.UUID) error {
+	if convID == uuid.Nil {
+		return domain.ErrInvalidConversationID
+	}
+	exec := GetExecutor(ctx, r.db)
+	result, err := exec.ExecContext(ctx, `
+		UPDATE conversation_invites
+		SET revoked_at = now()
+		WHERE id = $1 AND conversation_id = $2 AND revoked_at IS NULL
+	`, inviteID, convID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrInviteNotFound
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"livon/internal/core/domain"
+
+	"github.com/google/uuid"
+)
+
+type BlockRepo struct {
+	db *sql.DB
+}
+
+func NewBlockRepo(db *sql.DB) *BlockRepo {
+	return &BlockRepo{db: db}
+}
+
+/*
+	type BlockRepository interface {
+		// Block records that blockerID blocks blockedID, placed through the sender_id via
+		Block(ctx context.Context, blockerID, blockedID string, via uuid.UUID) error
+		// Unblock removes the block placed through via, if any
+		Unblock(ctx context.Context, blockerID string, via uuid.UUID) error
+		// BlockedUsers returns the user_ids blockerID has blocked
+		BlockedUsers(ctx context.Context, blockerID string) ([]string, error)
+	}
+*/
+
+func (r *BlockRepo) Block(ctx context.Context, blockerID, blockedID string, via uuid.UUID) error {
+	if blockerID == "" || blockedID == "" {
+		return domain.ErrInvalidUserID
+	}
+	exec := GetExecutor(ctx, r.db)
+	_, err := exec.ExecContext(ctx, `
+		INSERT INTO user_blocks (blocker_id, blocked_id, via_sender)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (blocker_id, via_sender) DO NOTHING
+	`, blockerID, blockedID, via)
+	return err
+}
+
+func (r *BlockRepo) Unblock(ctx context.Context, blockerID string, via uuid.UUID) error {
+	if blockerID == "" {
+		return domain.ErrInvalidUserID
+	}
+	exec := GetExecutor(ctx, r.db)
+	_, err := exec.ExecContext(ctx, `
+		DELETE FROM user_blocks
+		WHERE blocker_id = $1 AND via_sender = $2
+	`, blockerID, via)
+	return err
+}
+
+func (r *BlockRepo) BlockedUsers(ctx context.Context, blockerID string) ([]string, error) {
+	if blockerID == "" {
+		return nil, domain.ErrInvalidUserID
+	}
+	exec := GetExecutor(ctx, r.db)
+	rows, err := exec.QueryContext(ctx, `
+		SELECT DISTINCT blocked_id
+		FROM user_blocks
+		WHERE blocker_id = $1
+	`, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var blocked []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		blocked = append(blocked, id)
+	}
+	return blocked, rows.Err()
+}
@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"livon/internal/platform/logger"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxInlinePayload keeps a notification under the 8000 byte NOTIFY limit,
+// with room for the marker.
+const maxInlinePayload = 7900
+
+// ClusterBus carries commands between replicas over LISTEN/NOTIFY. Payloads
+// too large for a notification are stored in bus_messages and only their id
+// is sent. Delivery is at-most-once: replicas that are not listening miss
+// the message.
+type ClusterBus struct {
+	db  *sql.DB
+	log *slog.Logger
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewClusterBus(log *slog.Logger, db *sql.DB) *ClusterBus {
+	return &ClusterBus{db: db, log: log}
+}
+
+/*
+	type ClusterBus interface {
+		// Publish delivers payload to every current subscriber of channel.
+		Publish(ctx context.Context, channel string, payload []byte) error
+		// Subscribe calls handler for each payload published on channel.
+		// It blocks until ctx is cancelled.
+		Subscribe(ctx context.Context, channel string, handler func(ctx context.Context, payload []byte)) error
+	}
+*/
+
+// Notifications are "i" followed by the payload itself, or "r" followed by
+// the id of its bus_messages row.
+func (b *ClusterBus) Publish(ctx context.Context, channel string, payload []byte) error {
+	if len(payload) <= maxInlinePayload && utf8.Valid(payload) && bytes.IndexByte(payload, 0) < 0 {
+		_, err := b.db.ExecContext(ctx, `SELECT pg_notify($1, 'i' || $2)`, channel, string(payload))
+		return err
+	}
+	b.sweep(ctx)
+	_, err := b.db.ExecContext(ctx, `
+		WITH msg AS (
+			INSERT INTO bus_messages (channel, payload)
+			VALUES ($1, $2)
+			RETURNING id
+		)
+		SELECT pg_notify($1, 'r' || id) FROM msg
+	`, channel, payload)
+	return err
+}
+
+// Subscribe keeps listening across dropped connections; only a first LISTEN
+// that fails is reported.
+func (b *ClusterBus) Subscribe(
+	ctx context.Context,
+	channel string,
+	handler func(ctx context.Context, payload []byte),
+) error {
+	listened := false
+	for {
+		err := listen(ctx, b.db, channel, func() { listened = true }, func(n string) {
+			if payload, ok := b.payload(ctx, channel, n); ok {
+				handler(ctx, payload)
+			}
+		})
+		if err == nil {
+			return nil
+		}
+		if !listened {
+			return err
+		}
+		b.log.ErrorContext(ctx, "postgres bus - subscribe - listen failed", slog.String("channel", channel), logger.Err(err))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// payload decodes a notification, loading a stored payload by its id.
+func (b *ClusterBus) payload(ctx context.Context, channel, n string) ([]byte, bool) {
+	if inline, ok := strings.CutPrefix(n, "i"); ok {
+		return []byte(inline), true
+	}
+	ref, ok := strings.CutPrefix(n, "r")
+	if !ok {
+		b.log.WarnContext(ctx, "postgres bus - subscribe - unknown notification", slog.String("channel", channel))
+		return nil, false
+	}
+	id, err := strconv.ParseInt(ref, 10, 64)
+	if err != nil {
+		b.log.WarnContext(ctx, "postgres bus - subscribe - unknown notification", slog.String("channel", channel))
+		return nil, false
+	}
+	var payload []byte
+	err = b.db.QueryRowContext(ctx, `
+		SELECT payload FROM bus_messages
+		WHERE id = $1
+	`, id).Scan(&payload)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) && ctx.Err() == nil {
+			b.log.ErrorContext(ctx, "postgres bus - subscribe - payload lookup failed", slog.String("channel", channel), logger.Err(err))
+		}
+		return nil, false
+	}
+	return payload, true
+}
+
+// sweep drops stored payloads every subscriber has had time to read. It runs
+// at most once a minute per node instead of on a timer.
+func (b *ClusterBus) sweep(ctx context.Context) {
+	b.mu.Lock()
+	due := time.Since(b.lastSweep) >= time.Minute
+	if due {
+		b.lastSweep = time.Now()
+	}
+	b.mu.Unlock()
+	if !due {
+		return
+	}
+	if _, err := b.db.ExecContext(ctx, `
+		DELETE FROM bus_messages
+		WHERE created_at < now() - interval '1 minute'
+	`); err != nil {
+		b.log.WarnContext(ctx, "postgres bus - publish - sweep failed", logger.Err(err))
+	}
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestClusterBus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := NewClusterBus(slog.New(slog.DiscardHandler), testDB(t))
+	channel := "bustest-" + uuid.NewString()
+
+	received := make(chan []byte, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Subscribe(ctx, channel, func(ctx context.Context, payload []byte) {
+			received <- payload
+		})
+	}()
+	// Notifications sent before the LISTEN are lost, so probe until one arrives
+	ping := []byte("ping")
+	deadline := time.After(10 * time.Second)
+waitListen:
+	for {
+		if err := b.Publish(ctx, channel, ping); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-received:
+			break waitListen
+		case err := <-done:
+			t.Fatalf("subscribe returned early: %v", err)
+		case <-deadline:
+			t.Fatal("subscriber never started listening")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	payloads := map[string][]byte{
+		"inline": []byte(`{"type":"message"}`),
+		"large":  bytes.Repeat([]byte("x"), maxInlinePayload+1),
+		"binary": {0xff, 0x00, 0xfe},
+	}
+	for _, name := range []string{"inline", "large", "binary"} {
+		if err := b.Publish(ctx, channel, payloads[name]); err != nil {
+			t.Fatalf("publish %s: %v", name, err)
+		}
+		for {
+			select {
+			case got := <-received:
+				if bytes.Equal(got, ping) {
+					continue // a late probe
+				}
+				if !bytes.Equal(got, payloads[name]) {
+					t.Errorf("%s payload: got %d bytes, want %d", name, len(got), len(payloads[name]))
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s payload not delivered", name)
+			}
+			break
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("subscribe: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("subscribe did not return after cancel")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"livon/internal/core/domain"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -20,13 +21,24 @@ func NewConversationRepo(db *sql.DB) *ConversationRepo {
 	-- Conversations
 	CREATE TABLE conversations (
 		id          UUID PRIMARY KEY,
+		type        TEXT NOT NULL DEFAULT 'group',
+		visibility  TEXT NOT NULL DEFAULT 'public',
+		identity_policy   TEXT NOT NULL DEFAULT 'resume',
+		resume_window_sec INTEGER,
 		created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
 	);
 
 	type ConversationRepository interface {
 		GetConversationByID(ctx context.Context, convID uuid.UUID) (*Conversation, error)
-		CreateConversation(ctx context.Context, convID uuid.UUID) (*Conversation, error)
+		// CreateConversation ensures the conversation exists; created is false if it already did
+		CreateConversation(ctx context.Context, convID uuid.UUID) (conv *Conversation, created bool, err error)
 		DeleteConversation(ctx context.Context, convID uuid.UUID) error
+		// UpdateType changes the conversation type (room settings)
+		UpdateType(ctx context.Context, convID uuid.UUID, convType string) error
+		// UpdateVisibility switches the conversation between public and private
+		UpdateVisibility(ctx context.Context, convID uuid.UUID, visibility Visibility) error
+		// UpdateIdentityPolicy sets how returning users get their identity back; a zero window uses the server default
+		UpdateIdentityPolicy(ctx context.Context, convID uuid.UUID, policy IdentityPolicy, window time.Duration) error
 	}
 */
 
@@ -35,9 +47,9 @@ func (r *ConversationRepo) GetConversationByID(ctx context.Context, convID uuid.
 		return nil, domain.ErrInvalidConversationID
 	}
 	conversation := &domain.Conversation{ID: convID}
-	query := `SELECT created_at FROM conversations WHERE id = $1`
+	query := `SELECT ` + conversationColumns + ` FROM conversations WHERE id = $1`
 	exec := GetExecutor(ctx, r.db)
-	err := exec.QueryRowContext(ctx, query, convID).Scan(&conversation.CreatedAt)
+	err := scanConversation(exec.QueryRowContext(ctx, query, convID), conversation)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, domain.ErrConversationNotFound
@@ -47,9 +59,9 @@ func (r *ConversationRepo) GetConversationByID(ctx context.Context, convID uuid.
 	return conversation, nil
 }
 
-func (r *ConversationRepo) CreateConversation(ctx context.Context, convID uuid.UUID) (*domain.Conversation, error) {
+func (r *ConversationRepo) CreateConversation(ctx context.Context, convID uuid.UUID) (*domain.Conversation, bool, error) {
 	if convID == uuid.Nil {
-		return nil, domain.ErrInvalidConversationID
+		return nil, false, domain.ErrInvalidConversationID
 	}
 	conversation := &domain.Conversation{
 		ID: convID,
@@ -60,18 +72,20 @@ func (r *ConversationRepo) CreateConversation(ctx context.Context, convID uuid.U
 		`INSERT INTO conversations (id) 
         VALUES ($1) 
 		ON CONFLICT (id) DO NOTHING
-        RETURNING created_at`
+        RETURNING ` + conversationColumns
 
 	exec := GetExecutor(ctx, r.db)
-	err := exec.QueryRowContext(ctx, query, convID).Scan(&conversation.CreatedAt)
+	created := true
+	err := scanConversation(exec.QueryRowContext(ctx, query, convID), conversation)
 	if err == sql.ErrNoRows {
+		created = false
 		existing, err := r.GetConversationByID(ctx, convID)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
-		conversation.CreatedAt = existing.CreatedAt
+		conversation = existing
 	} else if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	_, err = exec.ExecContext(ctx, `
 		INSERT INTO conversation_sequences (conversation_id, last_seq)
@@ -79,9 +93,9 @@ func (r *ConversationRepo) CreateConversation(ctx context.Context, convID uuid.U
 		ON CONFLICT (conversation_id) DO NOTHING
 	`, convID)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	return conversation, nil
+	return conversation, created, nil
 }
 
 func (r *ConversationRepo) DeleteConversation(ctx context.Context, convID uuid.UUID) error {
@@ -103,3 +117,85 @@ func (r *ConversationRepo) DeleteConversation(ctx context.Context, convID uuid.U
 	}
 	return nil
 }
+
+func (r *ConversationRepo) UpdateType(ctx context.Context, convID uuid.UUID, convType string) error {
+	if convID == uuid.Nil {
+		return domain.ErrInvalidConversationID
+	}
+	exec := GetExecutor(ctx, r.db)
+	result, err := exec.ExecContext(ctx, `UPDATE conversations SET type = $2 WHERE id = $1`, convID, convType)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return domain.ErrConversationNotFound
+	}
+	return nil
+}
+
+func (r *ConversationRepo) UpdateVisibility(ctx context.Context, convID uuid.UUID, visibility domain.Visibility) error {
+	if convID == uuid.Nil {
+		return domain.ErrInvalidConversationID
+	}
+	exec := GetExecutor(ctx, r.db)
+	result, err := exec.ExecContext(ctx, `UPDATE conversations SET visibility = $2 WHERE id = $1`, convID, visibility)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return domain.ErrConversationNotFound
+	}
+	return nil
+}
+
+func (r *ConversationRepo) UpdateIdentityPolicy(
+	ctx context.Context,
+	convID uuid.UUID,
+	policy domain.IdentityPolicy,
+	window time.Duration,
+) error {
+	if convID == uuid.Nil {
+		return domain.ErrInvalidConversationID
+	}
+	var windowSec sql.NullInt64
+	if window > 0 {
+		windowSec = sql.NullInt64{Int64: int64(window / time.Second), Valid: true}
+	}
+	exec := GetExecutor(ctx, r.db)
+	result, err := exec.ExecContext(ctx, `
+		UPDATE conversations
+		SET identity_policy = $2, resume_window_sec = $3
+		WHERE id = $1
+	`, convID, policy, windowSec)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return domain.ErrConversationNotFound
+	}
+	return nil
+}
+
+const conversationColumns = `type, visibility, identity_policy, resume_window_sec, created_at`
+
+// scanConversation reads conversationColumns into c.
+func scanConversation(row rowScanner, c *domain.Conversation) error {
+	var windowSec sql.NullInt64
+	if err := row.Scan(&c.Type, &c.Visibility, &c.IdentityPolicy, &windowSec, &c.CreatedAt); err != nil {
+		return err
+	}
+	c.ResumeWindow = time.Duration(windowSec.Int64) * time.Second
+	return nil
+}
@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LeaseStore keeps partition leases and pool members in Postgres. Expiry is
+// judged by the database clock, so nodes need not agree on the time.
+type LeaseStore struct {
+	db *sql.DB
+}
+
+func NewLeaseStore(db *sql.DB) *LeaseStore {
+	return &LeaseStore{db: db}
+}
+
+/*
+	type LeaseStore interface {
+		// Acquire takes key for owner for ttl unless another owner holds it.
+		// An owner that already holds key renews it.
+		Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+		// Release gives key up if owner still holds it.
+		Release(ctx context.Context, key, owner string) error
+		// Heartbeat marks member of group alive for ttl and returns how many
+		// members are alive, member included.
+		Heartbeat(ctx context.Context, group, member string, ttl time.Duration) (int, error)
+	}
+*/
+
+func (s *LeaseStore) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	// The conflicting row is only taken over when it is ours or has expired
+	var holder string
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO leases (key, owner, expires_at)
+		VALUES ($1, $2, now() + $3 * interval '1 millisecond')
+		ON CONFLICT (key) DO UPDATE
+		SET owner = EXCLUDED.owner, expires_at = EXCLUDED.expires_at
+		WHERE leases.owner = EXCLUDED.owner OR leases.expires_at < now()
+		RETURNING owner
+	`, key, owner, ttl.Milliseconds()).Scan(&holder)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *LeaseStore) Release(ctx context.Context, key, owner string) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM leases
+		WHERE key = $1 AND owner = $2
+	`, key, owner)
+	return err
+}
+
+func (s *LeaseStore) Heartbeat(ctx context.Context, group, member string, ttl time.Duration) (int, error) {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO lease_members (group_name, member, expires_at)
+		VALUES ($1, $2, now() + $3 * interval '1 millisecond')
+		ON CONFLICT (group_name, member)
+		DO UPDATE SET expires_at = EXCLUDED.expires_at
+	`, group, member, ttl.Milliseconds())
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		DELETE FROM lease_members
+		WHERE group_name = $1 AND expires_at < now()
+	`, group); err != nil {
+		return 0, err
+	}
+	var n int
+	err = s.db.QueryRowContext(ctx, `
+		SELECT count(*) FROM lease_members
+		WHERE group_name = $1
+	`, group).Scan(&n)
+	return n, err
+}
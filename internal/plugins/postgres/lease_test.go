@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLeaseStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewLeaseStore(testDB(t))
+	acquire := func(owner string, ttl time.Duration, want bool) {
+		t.Helper()
+		got, err := s.Acquire(ctx, "partition-0", owner, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Acquire(%s) = %v, want %v", owner, got, want)
+		}
+	}
+	acquire("a", time.Minute, true)
+	acquire("b", time.Minute, false)
+	// The holder renews
+	acquire("a", time.Minute, true)
+
+	// Only the holder can release
+	if err := s.Release(ctx, "partition-0", "b"); err != nil {
+		t.Fatal(err)
+	}
+	acquire("b", time.Minute, false)
+	if err := s.Release(ctx, "partition-0", "a"); err != nil {
+		t.Fatal(err)
+	}
+	acquire("b", 50*time.Millisecond, true)
+
+	// An expired lease is taken over
+	time.Sleep(150 * time.Millisecond)
+	acquire("a", time.Minute, true)
+}
+
+func TestLeaseStoreHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	s := NewLeaseStore(testDB(t))
+	heartbeat := func(member string, ttl time.Duration, want int) {
+		t.Helper()
+		got, err := s.Heartbeat(ctx, "workers", member, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Heartbeat(%s) = %d members, want %d", member, got, want)
+		}
+	}
+	heartbeat("a", 50*time.Millisecond, 1)
+	heartbeat("b", time.Minute, 2)
+	heartbeat("b", time.Minute, 2)
+	// a stopped beating
+	time.Sleep(150 * time.Millisecond)
+	heartbeat("b", time.Minute, 1)
+}
@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// listen runs LISTEN on channel over a pool connection of its own and passes
+// each notification's payload to handle until ctx is cancelled. listening is
+// called once the LISTEN is in place. It returns nil when ctx is cancelled and
+// the error otherwise; notifications sent while nobody listens are lost.
+func listen(ctx context.Context, db *sql.DB, channel string, listening func(), handle func(payload string)) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer conn.Close()
+	var failed error
+	_ = conn.Raw(func(driverConn any) error {
+		// The session keeps the LISTEN, so the connection is discarded rather
+		// than handed back to the pool
+		sc, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			failed = fmt.Errorf("unexpected driver connection %T", driverConn)
+			return driver.ErrBadConn
+		}
+		pc := sc.Conn()
+		if _, failed = pc.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); failed != nil {
+			return driver.ErrBadConn
+		}
+		listening()
+		for {
+			n, err := pc.WaitForNotification(ctx)
+			if err != nil {
+				failed = err
+				return driver.ErrBadConn
+			}
+			handle(n.Payload)
+		}
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return failed
+}
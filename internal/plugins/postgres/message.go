@@ -3,9 +3,14 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"livon/internal/core/domain"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type MessageRepo struct {
@@ -23,9 +28,18 @@ func NewMessageRepo(db *sql.DB) *MessageRepo {
 		// Atomic Persistence: Increments sequence and inserts message in one TX
 		// This fulfills the "Double Tick" requirement by returning the final Seq
 		SaveWithSequence(ctx context.Context, msg *Message) (seq int64, err error)
+		// Batch Persistence: takes one block of consecutive seqs for msgs of one
+		// conversation and inserts them in slice order; fills in Seq and the sender's pseudonym
+		SaveBatchWithSequence(ctx context.Context, convID uuid.UUID, msgs []*Message) error
 		// Visibility Logic: Join-Onward + Recent 1-min Window
 		// Uses the Participant.JoinedAt and current time to filter history
 		GetVisibleMessages(ctx context.Context, convID uuid.UUID, p *Participant) ([]Message, error)
+		// Resync: messages with seq greater than afterSeq created at or after since, oldest first
+		GetMessagesAfter(ctx context.Context, convID uuid.UUID, afterSeq int64, since time.Time, limit int) ([]Message, error)
+		// GetMessageBySeq loads one message of a conversation
+		GetMessageBySeq(ctx context.Context, convID uuid.UUID, seq int64) (*Message, error)
+		// EditMessage replaces the payload, keeping the seq, and sets edited_at
+		EditMessage(ctx context.Context, convID uuid.UUID, seq int64, payload string) (*Message, error)
 	}
 */
 
@@ -51,23 +65,113 @@ func (r *MessageRepo) SaveWithSequence(
 		}
 		return 0, err
 	}
-	_, err = exec.ExecContext(ctx, `
-        INSERT INTO messages (
-            id, conversation_id, sender_id, seq, payload
-        ) VALUES ($1, $2, $3, $4, $5)
+	// The sender's pseudonym comes back with the insert for the broadcast
+	err = exec.QueryRowContext(ctx, `
+        WITH m AS (
+            INSERT INTO messages (
+                id, conversation_id, sender_id, seq, payload
+            ) VALUES ($1, $2, $3, $4, $5)
+            RETURNING sender_id
+        )
+        SELECT p.display_name, p.avatar_seed
+        FROM m
+        JOIN conversation_participants p ON p.id = m.sender_id
     `,
 		msg.ID,
 		msg.ConversationID,
 		msg.SenderID,
 		seq,
 		msg.Payload,
-	)
+	).Scan(&msg.SenderName, &msg.SenderAvatar)
 	if err != nil {
-		return 0, err
+		return 0, rejected(err)
 	}
 	return seq, nil
 }
 
+func (r *MessageRepo) SaveBatchWithSequence(
+	ctx context.Context,
+	convID uuid.UUID,
+	msgs []*domain.Message,
+) error {
+	if convID == uuid.Nil {
+		return domain.ErrInvalidConversationID
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	exec := GetExecutor(ctx, r.db)
+	var last int64
+	err := exec.QueryRowContext(ctx, `
+        UPDATE conversation_sequences
+        SET last_seq = last_seq + $2
+        WHERE conversation_id = $1
+        RETURNING last_seq
+    `, convID, len(msgs)).Scan(&last)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.ErrSequenceNotInitialized
+		}
+		return err
+	}
+	// The block is (last - n, last]; hand it out in slice order
+	ids := make([]string, len(msgs))
+	senders := make([]string, len(msgs))
+	seqs := make([]int64, len(msgs))
+	payloads := make([]string, len(msgs))
+	byID := make(map[uuid.UUID]*domain.Message, len(msgs))
+	for i, m := range msgs {
+		m.Seq = last - int64(len(msgs)) + int64(i) + 1
+		ids[i] = m.ID.String()
+		senders[i] = m.SenderID.String()
+		seqs[i] = m.Seq
+		payloads[i] = m.Payload
+		byID[m.ID] = m
+	}
+	// One multi-row insert; the senders' pseudonyms come back for the broadcast
+	rows, err := exec.QueryContext(ctx, `
+        WITH m AS (
+            INSERT INTO messages (
+                id, conversation_id, sender_id, seq, payload
+            )
+            SELECT t.id, $1, t.sender_id, t.seq, t.payload
+            FROM unnest($2::uuid[], $3::uuid[], $4::bigint[], $5::text[])
+                AS t(id, sender_id, seq, payload)
+            RETURNING id, sender_id
+        )
+        SELECT m.id, p.display_name, p.avatar_seed
+        FROM m
+        JOIN conversation_participants p ON p.id = m.sender_id
+    `, convID, ids, senders, seqs, payloads)
+	if err != nil {
+		return rejected(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		var name, avatar string
+		if err := rows.Scan(&id, &name, &avatar); err != nil {
+			return err
+		}
+		if m := byID[id]; m != nil {
+			m.SenderName, m.SenderAvatar = name, avatar
+		}
+	}
+	return rejected(rows.Err())
+}
+
+// rejected maps the errors Postgres raises for the rows themselves, an
+// integrity constraint violation (class 23) or a payload too long for its
+// column (22001), to ErrMessageRejected: saving the same message again fails
+// the same way. Any other error is returned as is.
+func rejected(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (strings.HasPrefix(pgErr.Code, "23") || pgErr.Code == "22001") {
+		return fmt.Errorf("%w: %w", domain.ErrMessageRejected, err)
+	}
+	return err
+}
+
 func (r *MessageRepo) GetVisibleMessages(
 	ctx context.Context,
 	convID uuid.UUID,
@@ -77,11 +181,12 @@ func (r *MessageRepo) GetVisibleMessages(
 	}
 	exec := GetExecutor(ctx, r.db)
 	rows, err := exec.QueryContext(ctx, `
-		SELECT id, conversation_id, sender_id, seq, payload, created_at
-		FROM messages
-		WHERE conversation_id = $1
-		AND created_at >= now() - interval '1 minutes'
-		ORDER BY seq ASC
+		SELECT `+messageColumns+`
+		FROM messages m
+		JOIN conversation_participants p ON p.id = m.sender_id
+		WHERE m.conversation_id = $1
+		AND m.created_at >= now() - interval '1 minutes'
+		ORDER BY m.seq ASC
 	`, convID)
 	if err != nil {
 		return nil, err
@@ -90,17 +195,124 @@ func (r *MessageRepo) GetVisibleMessages(
 	var msgs []domain.Message
 	for rows.Next() {
 		var m domain.Message
-		if err := rows.Scan(
-			&m.ID,
-			&m.ConversationID,
-			&m.SenderID,
-			&m.Seq,
-			&m.Payload,
-			&m.CreatedAt,
-		); err != nil {
+		if err := scanMessage(rows, &m); err != nil {
 			return nil, err
 		}
 		msgs = append(msgs, m)
 	}
 	return msgs, nil
 }
+
+func (r *MessageRepo) GetMessagesAfter(
+	ctx context.Context,
+	convID uuid.UUID,
+	afterSeq int64,
+	since time.Time,
+	limit int,
+) ([]domain.Message, error) {
+	if convID == uuid.Nil {
+		return nil, domain.ErrInvalidConversationID
+	}
+	exec := GetExecutor(ctx, r.db)
+	rows, err := exec.QueryContext(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages m
+		JOIN conversation_participants p ON p.id = m.sender_id
+		WHERE m.conversation_id = $1
+		AND m.seq > $2
+		AND m.created_at >= $3
+		ORDER BY m.seq ASC
+		LIMIT $4
+	`, convID, afterSeq, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var msgs []domain.Message
+	for rows.Next() {
+		var m domain.Message
+		if err := scanMessage(rows, &m); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+func (r *MessageRepo) GetMessageBySeq(
+	ctx context.Context,
+	convID uuid.UUID,
+	seq int64,
+) (*domain.Message, error) {
+	if convID == uuid.Nil {
+		return nil, domain.ErrInvalidConversationID
+	}
+	exec := GetExecutor(ctx, r.db)
+	var m domain.Message
+	err := scanMessage(exec.QueryRowContext(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages m
+		JOIN conversation_participants p ON p.id = m.sender_id
+		WHERE m.conversation_id = $1 AND m.seq = $2
+	`, convID, seq), &m)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domain.ErrMessageNotFound
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *MessageRepo) EditMessage(
+	ctx context.Context,
+	convID uuid.UUID,
+	seq int64,
+	payload string,
+) (*domain.Message, error) {
+	if convID == uuid.Nil {
+		return nil, domain.ErrInvalidConversationID
+	}
+	exec := GetExecutor(ctx, r.db)
+	var m domain.Message
+	err := scanMessage(exec.QueryRowContext(ctx, `
+		WITH m AS (
+			UPDATE messages
+			SET payload = $3, edited_at = now()
+			WHERE conversation_id = $1 AND seq = $2
+			RETURNING *
+		)
+		SELECT `+messageColumns+`
+		FROM m
+		JOIN conversation_participants p ON p.id = m.sender_id
+	`, convID, seq, payload), &m)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domain.ErrMessageNotFound
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// messageColumns selects a message with its sender's pseudonym from messages m
+// joined to conversation_participants p; read it with scanMessage.
+const messageColumns = `m.id, m.conversation_id, m.sender_id, m.seq, m.payload, m.created_at, m.edited_at, p.display_name, p.avatar_seed`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMessage(row rowScanner, m *domain.Message) error {
+	return row.Scan(
+		&m.ID,
+		&m.ConversationID,
+		&m.SenderID,
+		&m.Seq,
+		&m.Payload,
+		&m.CreatedAt,
+		&m.EditedAt,
+		&m.SenderName,
+		&m.SenderAvatar,
+	)
+}
@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"livon/internal/core/domain"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestRejected(t *testing.T) {
+	connErr := errors.New("connection reset")
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"foreign key violation", &pgconn.PgError{Code: "23503"}, true},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, true},
+		{"not null violation", &pgconn.PgError{Code: "23502"}, true},
+		{"value too long", &pgconn.PgError{Code: "22001"}, true},
+		{"invalid text representation", &pgconn.PgError{Code: "22P02"}, false},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, false},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, false},
+		{"connection error", connErr, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := rejected(tc.err)
+			if got := errors.Is(err, domain.ErrMessageRejected); got != tc.want {
+				t.Errorf("rejected(%v) is ErrMessageRejected = %t, want %t", tc.err, got, tc.want)
+			}
+			if !errors.Is(err, tc.err) {
+				t.Errorf("rejected(%v) = %v, lost the cause", tc.err, err)
+			}
+		})
+	}
+	if rejected(nil) != nil {
+		t.Error("rejected(nil) is not nil")
+	}
+}
+
+func TestSaveRejectsUnknownSender(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	convID := uuid.New()
+	if _, _, err := NewConversationRepo(db).CreateConversation(ctx, convID); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewMessageRepo(db)
+	msg := &domain.Message{ID: uuid.New(), ConversationID: convID, SenderID: uuid.New(), Payload: "hi"}
+	if _, err := repo.SaveWithSequence(ctx, msg); !errors.Is(err, domain.ErrMessageRejected) {
+		t.Errorf("SaveWithSequence: %v, want %v", err, domain.ErrMessageRejected)
+	}
+	batch := []*domain.Message{{ID: uuid.New(), ConversationID: convID, SenderID: uuid.New(), Payload: "hi"}}
+	if err := repo.SaveBatchWithSequence(ctx, convID, batch); !errors.Is(err, domain.ErrMessageRejected) {
+		t.Errorf("SaveBatchWithSequence: %v, want %v", err, domain.ErrMessageRejected)
+	}
+}
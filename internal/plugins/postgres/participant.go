@@ -18,14 +18,24 @@ func NewParticipantRepo(db *sql.DB) *ParticipantRepo {
 
 /*
 	type ConversationParticipantRepository interface {
-		// Rejoin Logic - finds active session within the 5-min window
+		// Rejoin Logic - finds the user's active identity, whether or not it may be resumed
 		FindRecentParticipant(ctx context.Context, userID string, convID uuid.UUID) (*Participant, error)
-		// Identity Creation - Assigns a new sender_id (Participant.ID)
+		// Identity Creation - Assigns a new sender_id (Participant.ID);
+		// ErrDisplayNameTaken if the pseudonym is in use in the conversation
 		CreateParticipant(ctx context.Context, p *Participant) error
 		// Presence - High-durability last_seen_at sync (the 5-min PG sync)
 		UpdatePresence(ctx context.Context, participantID uuid.UUID) error
+		// LockIdentity serialises identity resolution for a user in a conversation
+		// until the surrounding transaction ends
+		LockIdentity(ctx context.Context, userID string, convID uuid.UUID) error
 		// Mark permanent leave left_at
 		MarkLeft(ctx context.Context, participantID uuid.UUID) error
+		// GetParticipant loads a participant by sender_id
+		GetParticipant(ctx context.Context, participantID uuid.UUID) (*Participant, error)
+		// SetRole changes a participant's role
+		SetRole(ctx context.Context, participantID uuid.UUID, role Role) error
+		// ListParticipants loads the given participants of a conversation
+		ListParticipants(ctx context.Context, convID uuid.UUID, participantIDs []uuid.UUID) ([]Participant, error)
 	}
 */
 
@@ -39,7 +49,7 @@ func (r *ParticipantRepo) FindRecentParticipant(
 	}
 	exec := GetExecutor(ctx, r.db)
 	row := exec.QueryRowContext(ctx, `
-		SELECT id, conversation_id, user_id, joined_at, last_seen_at, left_at
+		SELECT id, conversation_id, user_id, joined_at, last_seen_at, left_at, role, display_name, avatar_seed
 		FROM conversation_participants
 		WHERE user_id = $1
 		  AND conversation_id = $2
@@ -55,6 +65,9 @@ func (r *ParticipantRepo) FindRecentParticipant(
 		&p.JoinedAt,
 		&p.LastSeenAt,
 		&p.LeftAt,
+		&p.Role,
+		&p.DisplayName,
+		&p.AvatarSeed,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -75,19 +88,37 @@ func (r *ParticipantRepo) CreateParticipant(
 	if p.ConversationID == uuid.Nil {
 		return domain.ErrInvalidConversationID
 	}
+	if p.Role == "" {
+		p.Role = domain.RoleMember
+	}
 	exec := GetExecutor(ctx, r.db)
-	_, err := exec.ExecContext(ctx, `
+	// A taken name inserts nothing rather than failing, which would abort the transaction
+	result, err := exec.ExecContext(ctx, `
 		INSERT INTO conversation_participants (
-			id, conversation_id, user_id, joined_at, last_seen_at
-		) VALUES ($1, $2, $3, $4, $5)
+			id, conversation_id, user_id, joined_at, last_seen_at, role, display_name, avatar_seed
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (conversation_id, lower(display_name)) DO NOTHING
 	`,
 		p.ID,
 		p.ConversationID,
 		p.UserID,
 		p.JoinedAt,
 		p.LastSeenAt,
+		p.Role,
+		p.DisplayName,
+		p.AvatarSeed,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrDisplayNameTaken
+	}
+	return nil
 }
 
 func (r *ParticipantRepo) UpdatePresence(
@@ -116,6 +147,22 @@ func (r *ParticipantRepo) UpdatePresence(
 	return err
 }
 
+func (r *ParticipantRepo) LockIdentity(
+	ctx context.Context,
+	userID string,
+	convID uuid.UUID,
+) error {
+	if convID == uuid.Nil {
+		return domain.ErrInvalidConversationID
+	}
+	// A transaction-scoped advisory lock also covers the case where no row exists yet
+	exec := GetExecutor(ctx, r.db)
+	_, err := exec.ExecContext(ctx, `
+		SELECT pg_advisory_xact_lock(hashtextextended($1 || ':' || $2, 0))
+	`, convID.String(), userID)
+	return err
+}
+
 func (r *ParticipantRepo) MarkLeft(
 	ctx context.Context,
 	participantID uuid.UUID,
@@ -141,3 +188,112 @@ func (r *ParticipantRepo) MarkLeft(
 	}
 	return err
 }
+
+func (r *ParticipantRepo) GetParticipant(
+	ctx context.Context,
+	participantID uuid.UUID,
+) (*domain.Participant, error) {
+	if participantID == uuid.Nil {
+		return nil, domain.ErrInvalidParticipantID
+	}
+	exec := GetExecutor(ctx, r.db)
+	var p domain.Participant
+	err := exec.QueryRowContext(ctx, `
+		SELECT id, conversation_id, user_id, joined_at, last_seen_at, left_at, role, display_name, avatar_seed
+		FROM conversation_participants
+		WHERE id = $1
+	`, participantID).Scan(
+		&p.ID,
+		&p.ConversationID,
+		&p.UserID,
+		&p.JoinedAt,
+		&p.LastSeenAt,
+		&p.LeftAt,
+		&p.Role,
+		&p.DisplayName,
+		&p.AvatarSeed,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domain.ErrParticipantNotFound
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *ParticipantRepo) SetRole(
+	ctx context.Context,
+	participantID uuid.UUID,
+	role domain.Role,
+) error {
+	if participantID == uuid.Nil {
+		return domain.ErrInvalidParticipantID
+	}
+	if !role.Valid() {
+		return domain.ErrInvalidRole
+	}
+	exec := GetExecutor(ctx, r.db)
+	result, err := exec.ExecContext(ctx, `
+		UPDATE conversation_participants
+		SET role = $2
+		WHERE id = $1
+	`, participantID, role)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrParticipantNotFound
+	}
+	return nil
+}
+
+func (r *ParticipantRepo) ListParticipants(
+	ctx context.Context,
+	convID uuid.UUID,
+	participantIDs []uuid.UUID,
+) ([]domain.Participant, error) {
+	if convID == uuid.Nil {
+		return nil, domain.ErrInvalidConversationID
+	}
+	if len(participantIDs) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(participantIDs))
+	for i, id := range participantIDs {
+		ids[i] = id.String()
+	}
+	exec := GetExecutor(ctx, r.db)
+	rows, err := exec.QueryContext(ctx, `
+		SELECT id, conversation_id, user_id, joined_at, last_seen_at, left_at, role, display_name, avatar_seed
+		FROM conversation_participants
+		WHERE conversation_id = $1 AND id = ANY($2::uuid[])
+	`, convID, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ps []domain.Participant
+	for rows.Next() {
+		var p domain.Participant
+		if err := rows.Scan(
+			&p.ID,
+			&p.ConversationID,
+			&p.UserID,
+			&p.JoinedAt,
+			&p.LastSeenAt,
+			&p.LeftAt,
+			&p.Role,
+			&p.DisplayName,
+			&p.AvatarSeed,
+		); err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	return ps, rows.Err()
+}
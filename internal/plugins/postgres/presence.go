@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// onlineWindow matches the Redis store: a connection counts as online for
+// this long after its last update.
+const onlineWindow = 30 * time.Second
+
+// PresenceStore keeps presence in the unlogged presence table, one row per
+// connection. Like the Redis key, a conversation's rows expire twice the TTL
+// after their last update.
+type PresenceStore struct {
+	db *sql.DB
+}
+
+func NewPresenceStore(db *sql.DB) *PresenceStore {
+	return &PresenceStore{db: db}
+}
+
+/*
+	type PresenceStore interface {
+		// UpdateStatus sets the TTL-based keys in Redis for one connection of senderID
+		UpdateOnlineStatus(ctx context.Context, convID string, senderID string, connID string, ttl time.Duration) error
+		// RemoveOnlineStatus drops one connection; the sender stays online while another is fresh
+		RemoveOnlineStatus(ctx context.Context, convID string, senderID string, connID string) error
+		// GetOnlineParticipants returns a list of sender_ids with at least one active connection
+		GetOnlineParticipants(ctx context.Context, convID string) ([]string, error)
+		// Manual clean up
+		ClearConversation(ctx context.Context, convID string) error
+		// ListConversations returns the conversations that have presence entries on any node
+		ListConversations(ctx context.Context) ([]string, error)
+	}
+*/
+
+func (p *PresenceStore) UpdateOnlineStatus(ctx context.Context, convID, senderID, connID string, ttl time.Duration) error {
+	// Every row of the conversation gets the new expiry, as the Redis key does
+	_, err := p.db.ExecContext(ctx, `
+		WITH seen AS (
+			INSERT INTO presence (conversation_id, sender_id, connection_id, seen_at, expires_at)
+			VALUES ($1, $2, $3, now(), now() + $4 * interval '1 millisecond')
+			ON CONFLICT (conversation_id, sender_id, connection_id)
+			DO UPDATE SET seen_at = EXCLUDED.seen_at, expires_at = EXCLUDED.expires_at
+		)
+		UPDATE presence
+		SET expires_at = now() + $4 * interval '1 millisecond'
+		WHERE conversation_id = $1
+		  AND NOT (sender_id = $2 AND connection_id = $3)
+	`, convID, senderID, connID, (2 * ttl).Milliseconds())
+	return err
+}
+
+func (p *PresenceStore) RemoveOnlineStatus(ctx context.Context, convID, senderID, connID string) error {
+	_, err := p.db.ExecContext(ctx, `
+		DELETE FROM presence
+		WHERE conversation_id = $1 AND sender_id = $2 AND connection_id = $3
+	`, convID, senderID, connID)
+	return err
+}
+
+func (p *PresenceStore) GetOnlineParticipants(ctx context.Context, convID string) ([]string, error) {
+	// Remove stale connections first (Self-cleaning)
+	_, err := p.db.ExecContext(ctx, `
+		DELETE FROM presence
+		WHERE conversation_id = $1
+		  AND (seen_at < now() - $2 * interval '1 millisecond' OR expires_at < now())
+	`, convID, onlineWindow.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT DISTINCT sender_id FROM presence
+		WHERE conversation_id = $1
+	`, convID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	senders := []string{}
+	for rows.Next() {
+		var senderID string
+		if err := rows.Scan(&senderID); err != nil {
+			return nil, err
+		}
+		senders = append(senders, senderID)
+	}
+	return senders, rows.Err()
+}
+
+func (p *PresenceStore) ClearConversation(ctx context.Context, convID string) error {
+	_, err := p.db.ExecContext(ctx, `
+		DELETE FROM presence
+		WHERE conversation_id = $1
+	`, convID)
+	return err
+}
+
+// ListConversations also drops the rows of conversations that expired, which
+// nothing else would revisit.
+func (p *PresenceStore) ListConversations(ctx context.Context) ([]string, error) {
+	if _, err := p.db.ExecContext(ctx, `DELETE FROM presence WHERE expires_at < now()`); err != nil {
+		return nil, err
+	}
+	rows, err := p.db.QueryContext(ctx, `SELECT DISTINCT conversation_id FROM presence`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var convIDs []string
+	for rows.Next() {
+		var convID string
+		if err := rows.Scan(&convID); err != nil {
+			return nil, err
+		}
+		convIDs = append(convIDs, convID)
+	}
+	return convIDs, rows.Err()
+}
@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPresenceStore(t *testing.T) {
+	ctx := context.Background()
+	p := NewPresenceStore(testDB(t))
+	online := func(want ...string) {
+		t.Helper()
+		got, err := p.GetOnlineParticipants(ctx, "conv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("online %v, want %v", got, want)
+		}
+	}
+	for _, c := range []struct{ sender, conn string }{{"alice", "phone"}, {"alice", "laptop"}, {"bob", "phone"}} {
+		if err := p.UpdateOnlineStatus(ctx, "conv", c.sender, c.conn, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	online("alice", "bob")
+
+	// A sender stays online while another of their connections is
+	if err := p.RemoveOnlineStatus(ctx, "conv", "alice", "phone"); err != nil {
+		t.Fatal(err)
+	}
+	online("alice", "bob")
+	if err := p.RemoveOnlineStatus(ctx, "conv", "alice", "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	online("bob")
+
+	convs, err := p.ListConversations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(convs, []string{"conv"}) {
+		t.Errorf("conversations %v, want [conv]", convs)
+	}
+	if err := p.ClearConversation(ctx, "conv"); err != nil {
+		t.Fatal(err)
+	}
+	online()
+	if convs, err := p.ListConversations(ctx); err != nil || len(convs) != 0 {
+		t.Errorf("conversations %v after clearing, err %v", convs, err)
+	}
+}
+
+func TestPresenceStoreExpires(t *testing.T) {
+	ctx := context.Background()
+	p := NewPresenceStore(testDB(t))
+	// Rows expire twice the TTL after the conversation's last update
+	if err := p.UpdateOnlineStatus(ctx, "conv", "alice", "phone", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if got, err := p.GetOnlineParticipants(ctx, "conv"); err != nil || len(got) != 0 {
+		t.Errorf("online %v after expiry, err %v", got, err)
+	}
+	if convs, err := p.ListConversations(ctx); err != nil || len(convs) != 0 {
+		t.Errorf("conversations %v after expiry, err %v", convs, err)
+	}
+}
@@ -0,0 +1,581 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
+	"livon/internal/platform/logger"
+	"livon/internal/platform/metrics"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// queueChannel is the NOTIFY channel that wakes consumers; the payload is the
+// topic that received entries.
+const queueChannel = "livon_queue"
+
+// MessageQueue keeps the ingestion streams in Postgres. Consumers claim
+// entries with FOR UPDATE SKIP LOCKED and sleep on LISTEN until a publish
+// notifies them. Every delivery is a row in queue_deliveries, so the group's
+// pending entries survive any node.
+type MessageQueue struct {
+	db  *sql.DB
+	log *slog.Logger
+	cfg config.WorkerConfig
+}
+
+func NewMessageQueue(log *slog.Logger, db *sql.DB, cfg config.WorkerConfig) *MessageQueue {
+	return &MessageQueue{db: db, log: log, cfg: cfg}
+}
+
+/*
+	type MessageQueue interface {
+		// Producer side (Ingest Service)
+		// PublishToStream appends payload to topic. key names the conversation the
+		// entry belongs to, since many conversations share a topic.
+		PublishToStream(ctx context.Context, topic string, key string, payload []byte) error
+		// Consumer side (Worker Service)
+		// ConsumeStreams reads the topics returned by topics in batches of up to
+		// batchSize entries per topic, handed to handler in stream order. topics is
+		// called again before every read, so topics can be added and dropped while
+		// it runs. A newly added topic first takes over the entries still pending
+		// for conGroup, which its previous reader did not finish. Entries stay
+		// pending until acknowledged.
+		ConsumeStreams(ctx context.Context, conGroup string, batchSize int, topics func() []string, handler func(ctx context.Context, topic string, entries []StreamEntry) error) error
+		// AcknowledgeMessage acknowledges redis stream that messages are processed
+		AcknowledgeMessage(ctx context.Context, topic, conGroup string, mesgIDs ...string) error
+		// PurgeKey removes every entry published under key from topic, its pending entries and its dead letters
+		PurgeKey(ctx context.Context, topic, conGroup, key string) error
+		// Deletes Messages from redis stream
+		DeleteMessage(ctx context.Context, topic string, mesgIDs ...string) error
+		// Backlog reports the stream length, lag and pending entries for a consumer group
+		Backlog(ctx context.Context, topic, conGroup string) (StreamBacklog, error)
+		// PendingEntries lists up to count entries delivered to conGroup but not acknowledged
+		PendingEntries(ctx context.Context, topic, conGroup string, count int64) ([]PendingEntry, error)
+		// DeadLetters counts the entries published under key that were set aside after exhausting their deliveries
+		DeadLetters(ctx context.Context, topic, key string) (int64, error)
+		// ReplayDeadLetters moves the dead-lettered entries published under key back onto the stream
+		ReplayDeadLetters(ctx context.Context, topic, key string) (int, error)
+	}
+*/
+
+type handlerFunc = func(ctx context.Context, topic string, entries []contracts.StreamEntry) error
+
+// errPendingElsewhere reports that another consumer still holds pending
+// entries of a topic being taken over.
+var errPendingElsewhere = errors.New("entries pending with another consumer")
+
+func (q *MessageQueue) PublishToStream(ctx context.Context, topic string, key string, payload []byte) error {
+	// Carry the W3C trace context (traceparent, tracestate) next to the payload
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	headers, err := json.Marshal(carrier)
+	if err != nil {
+		return err
+	}
+	// The notification is sent when the insert commits
+	_, err = q.db.ExecContext(ctx, `
+		WITH entry AS (
+			INSERT INTO queue_entries (topic, key, data, headers)
+			VALUES ($1, $2, $3, $4)
+			RETURNING topic
+		)
+		SELECT pg_notify($5, topic) FROM entry
+	`, topic, key, payload, string(headers), queueChannel)
+	return err
+}
+
+func (q *MessageQueue) ConsumeStreams(
+	ctx context.Context,
+	conGroup string,
+	batchSize int,
+	topics func() []string,
+	handler handlerFunc,
+) error {
+	consumer := uuid.NewString()
+	// Entries are finished even if ctx is cancelled while they are being handled
+	handlerCtx := context.WithoutCancel(ctx)
+	wake := make(chan struct{}, 1)
+	go q.watch(ctx, wake)
+	// Topics read in the previous pass; anything else is new to this consumer
+	reading := make(map[string]bool)
+	lastReclaim := time.Now()
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		ready := make([]string, 0, len(reading))
+		next := make(map[string]bool, len(reading))
+		for _, topic := range topics() {
+			if !reading[topic] {
+				if err := q.takeOver(ctx, handlerCtx, topic, conGroup, consumer, batchSize, handler); err != nil {
+					if errors.Is(err, errPendingElsewhere) {
+						q.log.DebugContext(ctx, "postgres queue - consume - waiting for pending entries", slog.String("topic", topic))
+					} else if ctx.Err() == nil {
+						q.log.ErrorContext(ctx, "postgres queue - consume - take over failed", slog.String("topic", topic), logger.Err(err))
+					}
+					continue
+				}
+			}
+			next[topic] = true
+			ready = append(ready, topic)
+		}
+		reading = next
+		if len(ready) == 0 {
+			// Nothing owned yet; wait for the next assignment
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		if q.cfg.ClaimIdle > 0 && time.Since(lastReclaim) >= q.cfg.ClaimIdle {
+			for _, topic := range ready {
+				q.reclaim(ctx, handlerCtx, topic, conGroup, consumer, batchSize, handler)
+			}
+			lastReclaim = time.Now()
+		}
+		batches, err := q.readNew(ctx, ready, conGroup, consumer, batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				q.log.ErrorContext(ctx, "postgres queue - consume - read failed", logger.Err(err))
+				// Back off so a Postgres outage doesn't spin
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+			}
+			continue
+		}
+		for _, topic := range ready {
+			if entries := batches[topic]; len(entries) > 0 {
+				q.handle(handlerCtx, topic, entries, handler)
+			}
+		}
+		if len(batches) == 0 {
+			// A missed notification costs at most one interval
+			select {
+			case <-ctx.Done():
+			case <-wake:
+			case <-time.After(2 * time.Second):
+			}
+		}
+	}
+}
+
+// watch signals wake whenever an entry is published, until ctx is cancelled.
+func (q *MessageQueue) watch(ctx context.Context, wake chan<- struct{}) {
+	signal := func() {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	for ctx.Err() == nil {
+		// Entries published before the LISTEN took hold are read on the wake-up
+		err := listen(ctx, q.db, queueChannel, signal, func(string) { signal() })
+		if err == nil {
+			return
+		}
+		q.log.ErrorContext(ctx, "postgres queue - watch - listen failed", logger.Err(err))
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// readNew delivers up to batchSize entries per topic that conGroup has not
+// seen yet. SKIP LOCKED lets a concurrent reader pass over the rows this one
+// is claiming instead of queueing behind it.
+func (q *MessageQueue) readNew(
+	ctx context.Context,
+	topics []string,
+	conGroup, consumer string,
+	batchSize int,
+) (map[string][]contracts.StreamEntry, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		WITH picked AS (
+			SELECT p.id, p.topic, p.key, p.data, p.headers
+			FROM unnest($1::text[]) AS t(topic)
+			CROSS JOIN LATERAL (
+				SELECT e.id, e.topic, e.key, e.data, e.headers
+				FROM queue_entries e
+				WHERE e.topic = t.topic
+				  AND NOT EXISTS (
+					SELECT 1 FROM queue_deliveries d
+					WHERE d.group_name = $2 AND d.entry_id = e.id
+				  )
+				ORDER BY e.id
+				LIMIT $4
+				FOR UPDATE SKIP LOCKED
+			) p
+		), delivered AS (
+			INSERT INTO queue_deliveries (group_name, entry_id, consumer)
+			SELECT $2, id, $3 FROM picked
+			ON CONFLICT DO NOTHING
+			RETURNING entry_id
+		)
+		SELECT p.id, p.topic, p.key, p.data, p.headers
+		FROM picked p
+		JOIN delivered d ON d.entry_id = p.id
+		ORDER BY p.topic, p.id
+	`, topics, conGroup, consumer, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	batches := make(map[string][]contracts.StreamEntry)
+	for rows.Next() {
+		var (
+			topic   string
+			e       contracts.StreamEntry
+			id      int64
+			headers []byte
+		)
+		if err := rows.Scan(&id, &topic, &e.Key, &e.Data, &headers); err != nil {
+			return nil, err
+		}
+		e.ID = strconv.FormatInt(id, 10)
+		e.Headers = decodeHeaders(headers)
+		batches[topic] = append(batches[topic], e)
+	}
+	return batches, rows.Err()
+}
+
+// takeOver handles every entry still pending for conGroup in topic, whoever
+// it was delivered to. As in the Redis adapter, entries are only taken once
+// idle for ClaimIdle, since a previous owner that lost the topic may still be
+// persisting them; while another consumer holds some, it returns
+// errPendingElsewhere and the topic stays unread.
+func (q *MessageQueue) takeOver(
+	ctx, handlerCtx context.Context,
+	topic, conGroup, consumer string,
+	batchSize int,
+	handler handlerFunc,
+) error {
+	var after int64
+	for {
+		entries, err := q.claim(ctx, topic, conGroup, consumer, q.cfg.ClaimIdle, after, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			break
+		}
+		q.handle(handlerCtx, topic, entries, handler)
+		if after, err = strconv.ParseInt(entries[len(entries)-1].ID, 10, 64); err != nil {
+			return err
+		}
+	}
+	var elsewhere bool
+	err := q.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM queue_deliveries d
+			JOIN queue_entries e ON e.id = d.entry_id
+			WHERE d.group_name = $1
+			  AND e.topic = $2
+			  AND NOT d.acked
+			  AND d.consumer <> $3
+		)
+	`, conGroup, topic, consumer).Scan(&elsewhere)
+	if err != nil {
+		return err
+	}
+	if elsewhere {
+		return errPendingElsewhere
+	}
+	return nil
+}
+
+// claim hands consumer up to count of conGroup's pending entries in topic
+// that have been idle for at least idle, starting after the entry id after.
+func (q *MessageQueue) claim(
+	ctx context.Context,
+	topic, conGroup, consumer string,
+	idle time.Duration,
+	after int64,
+	count int,
+) ([]contracts.StreamEntry, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		WITH claimable AS (
+			SELECT d.entry_id
+			FROM queue_deliveries d
+			JOIN queue_entries e ON e.id = d.entry_id
+			WHERE d.group_name = $1
+			  AND e.topic = $2
+			  AND NOT d.acked
+			  AND d.entry_id > $3
+			  AND d.delivered_at <= now() - $4 * interval '1 millisecond'
+			ORDER BY d.entry_id
+			LIMIT $5
+			FOR UPDATE OF d SKIP LOCKED
+		), claimed AS (
+			UPDATE queue_deliveries d
+			SET consumer = $6, delivered_at = now(), deliveries = d.deliveries + 1
+			FROM claimable c
+			WHERE d.group_name = $1 AND d.entry_id = c.entry_id
+			RETURNING d.entry_id
+		)
+		SELECT e.id, e.key, e.data, e.headers
+		FROM claimed c
+		JOIN queue_entries e ON e.id = c.entry_id
+		ORDER BY e.id
+	`, conGroup, topic, after, idle.Milliseconds(), count, consumer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []contracts.StreamEntry
+	for rows.Next() {
+		var (
+			e       contracts.StreamEntry
+			id      int64
+			headers []byte
+		)
+		if err := rows.Scan(&id, &e.Key, &e.Data, &headers); err != nil {
+			return nil, err
+		}
+		e.ID = strconv.FormatInt(id, 10)
+		e.Headers = decodeHeaders(headers)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// handle passes a batch of entries to handler. Entries it does not
+// acknowledge stay pending and are retried by reclaim.
+func (q *MessageQueue) handle(
+	ctx context.Context,
+	topic string,
+	entries []contracts.StreamEntry,
+	handler handlerFunc,
+) {
+	if err := handler(ctx, topic, entries); err != nil {
+		q.log.ErrorContext(ctx, "postgres queue - handle - handler failed", slog.String("topic", topic), slog.Int("entries", len(entries)), logger.Err(err))
+	}
+}
+
+// reclaim retries entries left pending by a failed handler, and dead-letters
+// the ones already delivered MaxDeliveries times.
+func (q *MessageQueue) reclaim(
+	ctx, handlerCtx context.Context,
+	topic, conGroup, consumer string,
+	batchSize int,
+	handler handlerFunc,
+) {
+	if q.cfg.MaxDeliveries > 0 {
+		if err := q.deadLetter(ctx, topic, conGroup, batchSize); err != nil {
+			if ctx.Err() == nil {
+				q.log.ErrorContext(ctx, "postgres queue - reclaim - dead letter failed", slog.String("topic", topic), logger.Err(err))
+			}
+			return
+		}
+	}
+	entries, err := q.claim(ctx, topic, conGroup, consumer, q.cfg.ClaimIdle, 0, batchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			q.log.ErrorContext(ctx, "postgres queue - reclaim - claim failed", slog.String("topic", topic), logger.Err(err))
+		}
+		return
+	}
+	if len(entries) > 0 {
+		q.handle(handlerCtx, topic, entries, handler)
+	}
+}
+
+// deadLetter moves the idle pending entries of topic that exhausted their
+// deliveries to queue_dead_letters, in one statement.
+func (q *MessageQueue) deadLetter(ctx context.Context, topic, conGroup string, count int) error {
+	rows, err := q.db.QueryContext(ctx, `
+		WITH exhausted AS (
+			SELECT d.entry_id, d.deliveries
+			FROM queue_deliveries d
+			JOIN queue_entries e ON e.id = d.entry_id
+			WHERE d.group_name = $1
+			  AND e.topic = $2
+			  AND NOT d.acked
+			  AND d.delivered_at <= now() - $3 * interval '1 millisecond'
+			  AND d.deliveries >= $4
+			ORDER BY d.entry_id
+			LIMIT $5
+			FOR UPDATE OF d SKIP LOCKED
+		), moved AS (
+			DELETE FROM queue_entries e
+			USING exhausted x
+			WHERE e.id = x.entry_id
+			RETURNING e.id, e.topic, e.key, e.data, e.headers, x.deliveries
+		)
+		INSERT INTO queue_dead_letters (topic, key, data, headers, deliveries, original_id)
+		SELECT topic, key, data, headers, deliveries, id FROM moved ORDER BY id
+		RETURNING original_id, key, deliveries
+	`, conGroup, topic, q.cfg.ClaimIdle.Milliseconds(), q.cfg.MaxDeliveries, count)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id, deliveries int64
+			key            string
+		)
+		if err := rows.Scan(&id, &key, &deliveries); err != nil {
+			return err
+		}
+		metrics.StreamDeadLettered.Add(ctx, 1)
+		q.log.WarnContext(ctx, "postgres queue - dead letter - entry set aside", slog.String("topic", topic), logger.Conversation(key), slog.String("message_id", strconv.FormatInt(id, 10)), slog.Int64("deliveries", deliveries))
+	}
+	return rows.Err()
+}
+
+func (q *MessageQueue) AcknowledgeMessage(ctx context.Context, topic, conGroup string, mesgIDs ...string) error {
+	if len(mesgIDs) == 0 {
+		return nil
+	}
+	ids, err := entryIDs(mesgIDs)
+	if err != nil {
+		return err
+	}
+	_, err = q.db.ExecContext(ctx, `
+		UPDATE queue_deliveries
+		SET acked = true
+		WHERE group_name = $1 AND entry_id = ANY($2)
+	`, conGroup, ids)
+	return err
+}
+
+func (q *MessageQueue) DeleteMessage(ctx context.Context, topic string, mesgIDs ...string) error {
+	if len(mesgIDs) == 0 {
+		return nil
+	}
+	ids, err := entryIDs(mesgIDs)
+	if err != nil {
+		return err
+	}
+	// Deliveries go with their entry (ON DELETE CASCADE)
+	_, err = q.db.ExecContext(ctx, `
+		DELETE FROM queue_entries
+		WHERE topic = $1 AND id = ANY($2)
+	`, topic, ids)
+	return err
+}
+
+func (q *MessageQueue) Backlog(ctx context.Context, topic, conGroup string) (contracts.StreamBacklog, error) {
+	var b contracts.StreamBacklog
+	err := q.db.QueryRowContext(ctx, `
+		SELECT count(*),
+		       count(*) FILTER (WHERE d.entry_id IS NULL),
+		       count(*) FILTER (WHERE d.entry_id IS NOT NULL AND NOT d.acked)
+		FROM queue_entries e
+		LEFT JOIN queue_deliveries d ON d.entry_id = e.id AND d.group_name = $2
+		WHERE e.topic = $1
+	`, topic, conGroup).Scan(&b.Length, &b.Lag, &b.Pending)
+	return b, err
+}
+
+func (q *MessageQueue) PendingEntries(ctx context.Context, topic, conGroup string, count int64) ([]contracts.PendingEntry, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT d.entry_id, d.consumer,
+		       (extract(epoch FROM now() - d.delivered_at) * 1000)::bigint,
+		       d.deliveries
+		FROM queue_deliveries d
+		JOIN queue_entries e ON e.id = d.entry_id
+		WHERE d.group_name = $2 AND e.topic = $1 AND NOT d.acked
+		ORDER BY d.entry_id
+		LIMIT $3
+	`, topic, conGroup, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []contracts.PendingEntry
+	for rows.Next() {
+		var (
+			p  contracts.PendingEntry
+			id int64
+		)
+		if err := rows.Scan(&id, &p.Consumer, &p.IdleMs, &p.Deliveries); err != nil {
+			return nil, err
+		}
+		p.ID = strconv.FormatInt(id, 10)
+		entries = append(entries, p)
+	}
+	return entries, rows.Err()
+}
+
+func (q *MessageQueue) DeadLetters(ctx context.Context, topic, key string) (int64, error) {
+	var n int64
+	err := q.db.QueryRowContext(ctx, `
+		SELECT count(*) FROM queue_dead_letters
+		WHERE topic = $1 AND key = $2
+	`, topic, key).Scan(&n)
+	return n, err
+}
+
+func (q *MessageQueue) ReplayDeadLetters(ctx context.Context, topic, key string) (int, error) {
+	var replayed int
+	err := q.db.QueryRowContext(ctx, `
+		WITH moved AS (
+			DELETE FROM queue_dead_letters
+			WHERE topic = $1 AND key = $2
+			RETURNING id, topic, key, data, headers
+		), replayed AS (
+			INSERT INTO queue_entries (topic, key, data, headers)
+			SELECT topic, key, data, headers FROM moved ORDER BY id
+			RETURNING id
+		)
+		SELECT count(*) FROM replayed
+	`, topic, key).Scan(&replayed)
+	if err != nil || replayed == 0 {
+		return replayed, err
+	}
+	// Consumers pick the entries up on their next poll if this is missed
+	if _, err := q.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, queueChannel, topic); err != nil {
+		q.log.WarnContext(ctx, "postgres queue - replay - notify failed", slog.String("topic", topic), logger.Err(err))
+	}
+	return replayed, nil
+}
+
+func (q *MessageQueue) PurgeKey(ctx context.Context, topic, conGroup, key string) error {
+	// Deliveries of every group go with their entries (ON DELETE CASCADE)
+	_, err := q.db.ExecContext(ctx, `
+		WITH entries AS (
+			DELETE FROM queue_entries
+			WHERE topic = $1 AND key = $2
+		)
+		DELETE FROM queue_dead_letters
+		WHERE topic = $1 AND key = $2
+	`, topic, key)
+	return err
+}
+
+// entryIDs parses the string IDs handed out with StreamEntry.
+func entryIDs(mesgIDs []string) ([]int64, error) {
+	ids := make([]int64, 0, len(mesgIDs))
+	for _, m := range mesgIDs {
+		id, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid queue entry id %q: %w", m, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// decodeHeaders reads the trace context stored with an entry; headers that
+// cannot be read only cost the trace link.
+func decodeHeaders(raw []byte) map[string]string {
+	headers := make(map[string]string)
+	_ = json.Unmarshal(raw, &headers)
+	return headers
+}
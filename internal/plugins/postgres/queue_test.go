@@ -0,0 +1,21 @@
+package postgres
+
+import (
+	"context"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
+	"livon/internal/plugins/queuetest"
+	"log/slog"
+	"testing"
+)
+
+func TestMessageQueue(t *testing.T) {
+	db := testDB(t)
+	log := slog.New(slog.DiscardHandler)
+	err := queuetest.TestQueue(context.Background(), func(cfg config.WorkerConfig) contracts.MessageQueue {
+		return NewMessageQueue(log, db, cfg)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"livon/internal/core/domain"
+
+	"github.com/google/uuid"
+)
+
+type RestrictionRepo struct {
+	db *sql.DB
+}
+
+func NewRestrictionRepo(db *sql.DB) *RestrictionRepo {
+	return &RestrictionRepo{db: db}
+}
+
+/*
+	type ConversationRestrictionRepository interface {
+		// Restrict creates or replaces the restriction of its kind
+		Restrict(ctx context.Context, r *Restriction) error
+		// Lift removes a restriction; lifting one that does not exist is not an error
+		Lift(ctx context.Context, convID uuid.UUID, userID string, kind RestrictionKind) error
+		// GetActiveRestriction returns ErrRestrictionNotFound unless an unexpired restriction exists
+		GetActiveRestriction(ctx context.Context, convID uuid.UUID, userID string, kind RestrictionKind) (*Restriction, error)
+	}
+*/
+
+func (r *RestrictionRepo) Restrict(ctx context.Context, rs *domain.Restriction) error {
+	if rs.ConversationID == uuid.Nil {
+		return domain.ErrInvalidConversationID
+	}
+	if rs.UserID == "" {
+		return domain.ErrInvalidUserID
+	}
+	exec := GetExecutor(ctx, r.db)
+	return exec.QueryRowContext(ctx, `
+		INSERT INTO conversation_restrictions (conversation_id, user_id, kind, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (conversation_id, user_id, kind)
+		DO UPDATE SET created_by = EXCLUDED.created_by, created_at = now(), expires_at = EXCLUDED.expires_at
+		RETURNING created_at
+	`, rs.ConversationID, rs.UserID, rs.Kind, rs.CreatedBy, rs.ExpiresAt).Scan(&rs.CreatedAt)
+}
+
+func (r *RestrictionRepo) Lift(
+	ctx context.Context,
+	convID uuid.UUID,
+	userID string,
+	kind domain.RestrictionKind,
+) error {
+	if convID == uuid.Nil {
+		return domain.ErrInvalidConversationID
+	}
+	exec := GetExecutor(ctx, r.db)
+	_, err := exec.ExecContext(ctx, `
+		DELETE FROM conversation_restrictions
+		WHERE conversation_id = $1 AND user_id = $2 AND kind = $3
+	`, convID, userID, kind)
+	return err
+}
+
+func (r *RestrictionRepo) GetActiveRestriction(
+	ctx context.Context,
+	convID uuid.UUID,
+	userID string,
+	kind domain.RestrictionKind,
+) (*domain.Restriction, error) {
+	if convID == uuid.Nil {
+		return nil, domain.ErrInvalidConversationID
+	}
+	exec := GetExecutor(ctx, r.db)
+	row := exec.QueryRowContext(ctx, `
+		SELECT conversation_id, user_id, kind, created_by, created_at, expires_at
+		FROM conversation_restrictions
+		WHERE conversation_id = $1
+		  AND user_id = $2
+		  AND kind = $3
+		  AND (expires_at IS NULL OR expires_at > now())
+	`, convID, userID, kind)
+	var rs domain.Restriction
+	err := row.Scan(
+		&rs.ConversationID,
+		&rs.UserID,
+		&rs.Kind,
+		&rs.CreatedBy,
+		&rs.CreatedAt,
+		&rs.ExpiresAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domain.ErrRestrictionNotFound
+		}
+		return nil, err
+	}
+	return &rs, nil
+}
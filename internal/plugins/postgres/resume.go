@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"livon/internal/core/domain"
+	"sync"
+	"time"
+)
+
+// ResumeStore keeps resume tokens in the unlogged resume_tokens table.
+type ResumeStore struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewResumeStore(db *sql.DB) *ResumeStore {
+	return &ResumeStore{db: db}
+}
+
+/*
+	type ResumeStore interface {
+		// Save stores or replaces the state behind token for ttl.
+		Save(ctx context.Context, token string, state domain.ResumeState, ttl time.Duration) error
+		// Take returns the state behind token and deletes it, so a token is used at
+		// most once. Unknown or expired tokens give domain.ErrResumeInvalid.
+		Take(ctx context.Context, token string) (*domain.ResumeState, error)
+	}
+*/
+
+func (s *ResumeStore) Save(ctx context.Context, token string, state domain.ResumeState, ttl time.Duration) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// Tokens that are never taken are swept now and then instead of on a timer
+	s.mu.Lock()
+	sweep := time.Since(s.lastSweep) >= time.Minute
+	if sweep {
+		s.lastSweep = time.Now()
+	}
+	s.mu.Unlock()
+	if sweep {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM resume_tokens WHERE expires_at < now()`); err != nil {
+			return err
+		}
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO resume_tokens (token, state, expires_at)
+		VALUES ($1, $2, now() + $3 * interval '1 millisecond')
+		ON CONFLICT (token)
+		DO UPDATE SET state = EXCLUDED.state, expires_at = EXCLUDED.expires_at
+	`, token, string(data), ttl.Milliseconds())
+	return err
+}
+
+func (s *ResumeStore) Take(ctx context.Context, token string) (*domain.ResumeState, error) {
+	var (
+		data    []byte
+		expired bool
+	)
+	err := s.db.QueryRowContext(ctx, `
+		DELETE FROM resume_tokens
+		WHERE token = $1
+		RETURNING state, expires_at < now()
+	`, token).Scan(&data, &expired)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrResumeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, domain.ErrResumeInvalid
+	}
+	var state domain.ResumeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, domain.ErrResumeInvalid
+	}
+	return &state, nil
+}
@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"livon/internal/core/domain"
+	"testing"
+	"time"
+)
+
+func TestResumeStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewResumeStore(testDB(t))
+	state := domain.ResumeState{
+		UserID:           "alice",
+		ConversationID:   "conv",
+		ConversationType: domain.ConversationTypeGroup,
+		SenderID:         "sender",
+		LastDeliveredSeq: 42,
+		Window:           time.Minute,
+	}
+	if err := s.Save(ctx, "token", state, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Take(ctx, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != state {
+		t.Errorf("took %+v, want %+v", *got, state)
+	}
+	// A token is used at most once
+	if _, err := s.Take(ctx, "token"); !errors.Is(err, domain.ErrResumeInvalid) {
+		t.Errorf("second take: %v, want %v", err, domain.ErrResumeInvalid)
+	}
+	if _, err := s.Take(ctx, "unknown"); !errors.Is(err, domain.ErrResumeInvalid) {
+		t.Errorf("unknown token: %v, want %v", err, domain.ErrResumeInvalid)
+	}
+}
+
+func TestResumeStoreExpires(t *testing.T) {
+	ctx := context.Background()
+	s := NewResumeStore(testDB(t))
+	if err := s.Save(ctx, "token", domain.ResumeState{UserID: "alice"}, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if _, err := s.Take(ctx, "token"); !errors.Is(err, domain.ErrResumeInvalid) {
+		t.Errorf("expired token: %v, want %v", err, domain.ErrResumeInvalid)
+	}
+}
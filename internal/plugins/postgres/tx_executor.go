@@ -3,12 +3,9 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"livon/internal/core/contracts"
 )
 
-type txKeyType struct{}
-
-var txKey = txKeyType{}
-
 type execer interface {
 	ExecContext(context.Context, string, ...any) (sql.Result, error)
 	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
@@ -16,7 +13,7 @@ type execer interface {
 }
 
 func GetExecutor(ctx context.Context, db *sql.DB) execer {
-	if tx, ok := ctx.Value(txKey).(*sql.Tx); ok {
+	if tx, ok := contracts.TxFromContext(ctx); ok {
 		return tx
 	}
 	return db
@@ -0,0 +1,385 @@
+// Package queuetest checks implementations of contracts.MessageQueue against
+// the behaviour the worker pool relies on. Every adapter must pass it:
+//
+//	err := queuetest.TestQueue(ctx, func(cfg config.WorkerConfig) contracts.MessageQueue {
+//		return redisPlugin.NewRedisMessageQueue(log, rdb, cfg)
+//	})
+//
+// Each check works on topics of its own, so one backend can be shared by all
+// of them and by earlier runs.
+package queuetest
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Config is the worker configuration TestQueue builds queues with. ClaimIdle
+// is short so redelivery and dead letters can be observed.
+var Config = config.WorkerConfig{
+	MessageGroup:  "queuetest",
+	ClaimIdle:     500 * time.Millisecond,
+	MaxDeliveries: 2,
+	BatchSize:     16,
+}
+
+// wait bounds how long a check waits for entries to be delivered. Redelivery
+// takes ClaimIdle plus up to one blocking read of the adapter.
+const wait = 15 * time.Second
+
+// TestQueue runs every check against queues made by newQueue and returns the
+// failures joined, or nil.
+func TestQueue(ctx context.Context, newQueue func(cfg config.WorkerConfig) contracts.MessageQueue) error {
+	checks := []struct {
+		name string
+		run  func(context.Context, contracts.MessageQueue) error
+	}{
+		{"publish and consume in order", checkOrder},
+		{"acknowledge and delete", checkAckDelete},
+		{"topics added while consuming", checkAddTopic},
+		{"take over pending entries", checkTakeOver},
+		{"redeliver unacknowledged entries", checkRedeliver},
+		{"dead letter and replay", checkDeadLetters},
+		{"purge key", checkPurgeKey},
+	}
+	var errs []error
+	for _, c := range checks {
+		if err := c.run(ctx, newQueue(Config)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// consumer runs ConsumeStreams in the background and records what it is handed.
+type consumer struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	mode    func(contracts.StreamEntry) bool // acknowledges an entry when it returns true
+	entries []contracts.StreamEntry
+	err     error
+	changed chan struct{}
+}
+
+func consume(ctx context.Context, q contracts.MessageQueue, topics func() []string, ack func(contracts.StreamEntry) bool) *consumer {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &consumer{cancel: cancel, done: make(chan struct{}), mode: ack, changed: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		_ = q.ConsumeStreams(ctx, Config.MessageGroup, Config.BatchSize, topics, func(ctx context.Context, topic string, entries []contracts.StreamEntry) error {
+			if len(entries) > Config.BatchSize {
+				err := fmt.Errorf("batch of %d entries exceeds %d", len(entries), Config.BatchSize)
+				c.record(nil, err)
+				return err
+			}
+			var done []string
+			c.mu.Lock()
+			mode := c.mode
+			c.mu.Unlock()
+			for _, e := range entries {
+				if mode(e) {
+					done = append(done, e.ID)
+				}
+			}
+			if err := q.AcknowledgeMessage(ctx, topic, Config.MessageGroup, done...); err != nil {
+				return err
+			}
+			if err := q.DeleteMessage(ctx, topic, done...); err != nil {
+				return err
+			}
+			c.record(entries, nil)
+			return nil
+		})
+	}()
+	return c
+}
+
+func (c *consumer) record(entries []contracts.StreamEntry, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, entries...)
+	c.err = cmp.Or(c.err, err)
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// acknowledge switches what the consumer acknowledges from now on.
+func (c *consumer) acknowledge(ack func(contracts.StreamEntry) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mode = ack
+}
+
+// waitFor waits until the recorded entries satisfy ok and returns them.
+func (c *consumer) waitFor(ok func([]contracts.StreamEntry) bool) ([]contracts.StreamEntry, error) {
+	timeout := time.After(wait)
+	for {
+		c.mu.Lock()
+		entries, err, changed := slices.Clone(c.entries), c.err, c.changed
+		c.mu.Unlock()
+		if err != nil {
+			return entries, err
+		}
+		if ok(entries) {
+			return entries, nil
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			return entries, fmt.Errorf("timed out with %d entries delivered", len(entries))
+		}
+	}
+}
+
+func (c *consumer) stop() {
+	c.cancel()
+	<-c.done
+}
+
+func all(contracts.StreamEntry) bool  { return true }
+func none(contracts.StreamEntry) bool { return false }
+
+func atLeast(n int) func([]contracts.StreamEntry) bool {
+	return func(entries []contracts.StreamEntry) bool { return len(entries) >= n }
+}
+
+func fixed(topics ...string) func() []string {
+	return func() []string { return topics }
+}
+
+func newTopic() string {
+	// Topics and keys end up in subjects and key names; keep them plain
+	return "qt" + uuid.NewString()[:8]
+}
+
+// publish adds n entries under key with payloads "<key>:0" … "<key>:n-1".
+func publish(ctx context.Context, q contracts.MessageQueue, topic, key string, n int) error {
+	for i := range n {
+		if err := q.PublishToStream(ctx, topic, key, fmt.Appendf(nil, "%s:%d", key, i)); err != nil {
+			return fmt.Errorf("publish: %w", err)
+		}
+	}
+	return nil
+}
+
+// inOrder checks that the entries under key are exactly payloads 0..n-1.
+func inOrder(entries []contracts.StreamEntry, key string, n int) error {
+	i := 0
+	for _, e := range entries {
+		if e.Key != key {
+			continue
+		}
+		if want := fmt.Sprintf("%s:%d", key, i); string(e.Data) != want {
+			return fmt.Errorf("entry %d of %s is %q, want %q", i, key, e.Data, want)
+		}
+		i++
+	}
+	if i != n {
+		return fmt.Errorf("%d entries of %s delivered, want %d", i, key, n)
+	}
+	return nil
+}
+
+func checkOrder(ctx context.Context, q contracts.MessageQueue) error {
+	topic, a, b := newTopic(), uuid.NewString(), uuid.NewString()
+	n := 2*Config.BatchSize + 3
+	if err := publish(ctx, q, topic, a, n); err != nil {
+		return err
+	}
+	if err := publish(ctx, q, topic, b, n); err != nil {
+		return err
+	}
+	c := consume(ctx, q, fixed(topic), all)
+	defer c.stop()
+	entries, err := c.waitFor(atLeast(2 * n))
+	if err != nil {
+		return err
+	}
+	if err := inOrder(entries, a, n); err != nil {
+		return err
+	}
+	return inOrder(entries, b, n)
+}
+
+func checkAckDelete(ctx context.Context, q contracts.MessageQueue) error {
+	topic, key := newTopic(), uuid.NewString()
+	if err := publish(ctx, q, topic, key, 5); err != nil {
+		return err
+	}
+	c := consume(ctx, q, fixed(topic), all)
+	if _, err := c.waitFor(atLeast(5)); err != nil {
+		c.stop()
+		return err
+	}
+	c.stop()
+	b, err := q.Backlog(ctx, topic, Config.MessageGroup)
+	if err != nil {
+		return fmt.Errorf("backlog: %w", err)
+	}
+	if b != (contracts.StreamBacklog{}) {
+		return fmt.Errorf("backlog is %+v after acknowledging and deleting everything", b)
+	}
+	return nil
+}
+
+func checkAddTopic(ctx context.Context, q contracts.MessageQueue) error {
+	first, second, key := newTopic(), newTopic(), uuid.NewString()
+	var mu sync.Mutex
+	topics := []string{first}
+	c := consume(ctx, q, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(topics)
+	}, all)
+	defer c.stop()
+	if err := publish(ctx, q, first, key, 1); err != nil {
+		return err
+	}
+	if _, err := c.waitFor(atLeast(1)); err != nil {
+		return err
+	}
+	if err := publish(ctx, q, second, key, 3); err != nil {
+		return err
+	}
+	mu.Lock()
+	topics = append(topics, second)
+	mu.Unlock()
+	_, err := c.waitFor(atLeast(4))
+	return err
+}
+
+func checkTakeOver(ctx context.Context, q contracts.MessageQueue) error {
+	topic, key := newTopic(), uuid.NewString()
+	if err := publish(ctx, q, topic, key, 3); err != nil {
+		return err
+	}
+	// The first reader fails everything and goes away
+	first := consume(ctx, q, fixed(topic), none)
+	if _, err := first.waitFor(atLeast(3)); err != nil {
+		first.stop()
+		return err
+	}
+	first.stop()
+	b, err := q.Backlog(ctx, topic, Config.MessageGroup)
+	if err != nil {
+		return fmt.Errorf("backlog: %w", err)
+	}
+	if b.Pending != 3 {
+		return fmt.Errorf("backlog is %+v, want 3 pending", b)
+	}
+	if err := publish(ctx, q, topic, uuid.NewString(), 1); err != nil {
+		return err
+	}
+	// The next reader finishes them before anything newer. Adapters shared by
+	// several nodes may first wait for ClaimIdle, so no time limit is checked.
+	next := consume(ctx, q, fixed(topic), all)
+	defer next.stop()
+	entries, err := next.waitFor(atLeast(4))
+	if err != nil {
+		return err
+	}
+	return inOrder(entries[:3], key, 3)
+}
+
+func checkRedeliver(ctx context.Context, q contracts.MessageQueue) error {
+	topic, key := newTopic(), uuid.NewString()
+	if err := publish(ctx, q, topic, key, 1); err != nil {
+		return err
+	}
+	c := consume(ctx, q, fixed(topic), none)
+	defer c.stop()
+	if _, err := c.waitFor(atLeast(1)); err != nil {
+		return err
+	}
+	pending, err := q.PendingEntries(ctx, topic, Config.MessageGroup, 10)
+	if err != nil {
+		return fmt.Errorf("pending entries: %w", err)
+	}
+	if len(pending) != 1 || pending[0].Deliveries != 1 {
+		return fmt.Errorf("pending entries are %+v, want one delivered once", pending)
+	}
+	c.acknowledge(all)
+	if _, err := c.waitFor(atLeast(2)); err != nil {
+		return fmt.Errorf("not redelivered: %w", err)
+	}
+	return nil
+}
+
+func checkDeadLetters(ctx context.Context, q contracts.MessageQueue) error {
+	topic, key := newTopic(), uuid.NewString()
+	if err := publish(ctx, q, topic, key, 1); err != nil {
+		return err
+	}
+	c := consume(ctx, q, fixed(topic), none)
+	defer c.stop()
+	if _, err := c.waitFor(atLeast(int(Config.MaxDeliveries))); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		n, err := q.DeadLetters(ctx, topic, key)
+		if err != nil {
+			return fmt.Errorf("dead letters: %w", err)
+		}
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d dead letters after %d deliveries, want 1", n, Config.MaxDeliveries)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.acknowledge(all)
+	replayed, err := q.ReplayDeadLetters(ctx, topic, key)
+	if err != nil {
+		return fmt.Errorf("replay: %w", err)
+	}
+	if replayed != 1 {
+		return fmt.Errorf("%d entries replayed, want 1", replayed)
+	}
+	entries, err := c.waitFor(atLeast(int(Config.MaxDeliveries) + 1))
+	if err != nil {
+		return fmt.Errorf("replayed entry not delivered: %w", err)
+	}
+	if last := entries[len(entries)-1]; string(last.Data) != key+":0" {
+		return fmt.Errorf("replayed entry is %q", last.Data)
+	}
+	if n, err := q.DeadLetters(ctx, topic, key); err != nil || n != 0 {
+		return fmt.Errorf("%d dead letters left after replay (%v)", n, err)
+	}
+	return nil
+}
+
+func checkPurgeKey(ctx context.Context, q contracts.MessageQueue) error {
+	topic, gone, kept := newTopic(), uuid.NewString(), uuid.NewString()
+	if err := publish(ctx, q, topic, gone, 3); err != nil {
+		return err
+	}
+	if err := publish(ctx, q, topic, kept, 2); err != nil {
+		return err
+	}
+	if err := q.PurgeKey(ctx, topic, Config.MessageGroup, gone); err != nil {
+		return fmt.Errorf("purge: %w", err)
+	}
+	c := consume(ctx, q, fixed(topic), all)
+	defer c.stop()
+	entries, err := c.waitFor(atLeast(2))
+	if err != nil {
+		return err
+	}
+	if err := inOrder(entries, kept, 2); err != nil {
+		return err
+	}
+	return inOrder(entries, gone, 0)
+}
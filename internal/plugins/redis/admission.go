@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const handshakeKey = "ws:handshakes"
+
+// acquireHandshake prunes expired slots and claims one if any are free.
+// KEYS[1] slot set, ARGV: id, now (ms), ttl (ms), limit
+var acquireHandshake = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', tonumber(ARGV[2]) - tonumber(ARGV[3]))
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[4]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+type RedisHandshakeGate struct {
+	rdb   *redis.Client
+	limit int
+	ttl   time.Duration
+}
+
+func NewRedisHandshakeGate(rdb *redis.Client, limit int, ttl time.Duration) *RedisHandshakeGate {
+	return &RedisHandshakeGate{rdb: rdb, limit: limit, ttl: ttl}
+}
+
+/*
+	type HandshakeGate interface {
+		// TryAcquire takes a slot for id and reports false when all are taken.
+		// Slots that are never released expire, so a crashed node cannot leak them.
+		TryAcquire(ctx context.Context, id string) (bool, error)
+		// Release frees the slot held by id.
+		Release(ctx context.Context, id string) error
+	}
+*/
+
+func (g *RedisHandshakeGate) TryAcquire(ctx context.Context, id string) (bool, error) {
+	ok, err := acquireHandshake.Run(ctx, g.rdb, []string{handshakeKey},
+		id, time.Now().UnixMilli(), g.ttl.Milliseconds(), g.limit).Int()
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+func (g *RedisHandshakeGate) Release(ctx context.Context, id string) error {
+	return g.rdb.ZRem(ctx, handshakeKey, id).Err()
+}
@@ -0,0 +1,59 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisClusterBus carries commands between replicas over Redis Pub/Sub.
+// Delivery is at-most-once: replicas that are not subscribed miss the message.
+type RedisClusterBus struct {
+	rdb *redis.Client
+}
+
+func NewRedisClusterBus(rdb *redis.Client) *RedisClusterBus {
+	return &RedisClusterBus{rdb: rdb}
+}
+
+/*
+	type ClusterBus interface {
+		// Publish delivers payload to every current subscriber of channel.
+		Publish(ctx context.Context, channel string, payload []byte) error
+		// Subscribe calls handler for each payload published on channel.
+		// It blocks until ctx is cancelled.
+		Subscribe(ctx context.Context, channel string, handler func(ctx context.Context, payload []byte)) error
+	}
+*/
+
+func (b *RedisClusterBus) Publish(ctx context.Context, channel string, payload []byte) error {
+	return b.rdb.Publish(ctx, channel, payload).Err()
+}
+
+func (b *RedisClusterBus) Subscribe(
+	ctx context.Context,
+	channel string,
+	handler func(ctx context.Context, payload []byte),
+) error {
+	sub := b.rdb.Subscribe(ctx, channel)
+	defer sub.Close()
+	// Wait for the subscription to be confirmed before reporting success
+	if _, err := sub.Receive(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	msgs := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			handler(ctx, []byte(msg.Payload))
+		}
+	}
+}
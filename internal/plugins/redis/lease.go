@@ -0,0 +1,74 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireLease sets or renews a lease held by ARGV[1].
+// KEYS[1] lease, ARGV: owner, ttl (ms)
+var acquireLease = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner and owner ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// releaseLease deletes a lease only if ARGV[1] still holds it.
+var releaseLease = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// heartbeat records a member as alive and counts the members seen within ttl.
+// KEYS[1] member set, ARGV: member, now (ms), ttl (ms)
+var heartbeat = redis.NewScript(`
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', tonumber(ARGV[2]) - tonumber(ARGV[3]))
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return redis.call('ZCARD', KEYS[1])
+`)
+
+type RedisLeaseStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisLeaseStore(rdb *redis.Client) *RedisLeaseStore {
+	return &RedisLeaseStore{rdb: rdb}
+}
+
+/*
+	type LeaseStore interface {
+		// Acquire takes key for owner for ttl unless another owner holds it.
+		// An owner that already holds key renews it.
+		Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+		// Release gives key up if owner still holds it.
+		Release(ctx context.Context, key, owner string) error
+		// Heartbeat marks member of group alive for ttl and returns how many
+		// members are alive, member included.
+		Heartbeat(ctx context.Context, group, member string, ttl time.Duration) (int, error)
+	}
+*/
+
+func (s *RedisLeaseStore) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	ok, err := acquireLease.Run(ctx, s.rdb, []string{"lease:" + key}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+func (s *RedisLeaseStore) Release(ctx context.Context, key, owner string) error {
+	return releaseLease.Run(ctx, s.rdb, []string{"lease:" + key}, owner).Err()
+}
+
+func (s *RedisLeaseStore) Heartbeat(ctx context.Context, group, member string, ttl time.Duration) (int, error) {
+	return heartbeat.Run(ctx, s.rdb, []string{"members:" + group},
+		member, time.Now().UnixMilli(), ttl.Milliseconds()).Int()
+}
@@ -3,6 +3,7 @@ package redis
 import (
 	"context"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -20,29 +21,40 @@ func NewRedisPresenceStore(rdb *redis.Client) *RedisPresenceStore {
 
 /*
 	type PresenceStore interface {
-		// UpdateStatus sets the TTL-based keys in Redis
-		UpdateOnlineStatus(ctx context.Context, convID string, senderID string, ttl time.Duration) error
-		// GetOnlineParticipants returns a list of sender_ids currently active
+		// UpdateStatus sets the TTL-based keys in Redis for one connection of senderID
+		UpdateOnlineStatus(ctx context.Context, convID string, senderID string, connID string, ttl time.Duration) error
+		// RemoveOnlineStatus drops one connection; the sender stays online while another is fresh
+		RemoveOnlineStatus(ctx context.Context, convID string, senderID string, connID string) error
+		// GetOnlineParticipants returns a list of sender_ids with at least one active connection
 		GetOnlineParticipants(ctx context.Context, convID string) ([]string, error)
 		// Manual clean up
 		ClearConversation(ctx context.Context, convID string) error
+		// ListConversations returns the conversations that have presence entries on any node
+		ListConversations(ctx context.Context) ([]string, error)
 	}
 */
 
-// UpdateOnlineStatus adds/updates a user in the conversation's ZSet with the current timestamp.
+// presenceMember is one connection of a sender; every device has its own entry
+// so the sender stays online until the last of them goes quiet.
+func presenceMember(senderID, connID string) string {
+	return senderID + "/" + connID
+}
+
+// UpdateOnlineStatus adds/updates a connection in the conversation's ZSet with the current timestamp.
 func (p *RedisPresenceStore) UpdateOnlineStatus(
 	ctx context.Context,
 	convID string,
 	senderID string,
+	connID string,
 	ttl time.Duration, // "inactivity threshold"
 ) error {
 	key := "presence:" + convID
 	now := time.Now().Unix()
 
-	// Add/Update user with current timestamp
+	// Add/Update connection with current timestamp
 	err := p.rdb.ZAdd(ctx, key, redis.Z{
 		Score:  float64(now),
-		Member: senderID,
+		Member: presenceMember(senderID, connID),
 	}).Err()
 	if err != nil {
 		return err
@@ -53,7 +65,12 @@ func (p *RedisPresenceStore) UpdateOnlineStatus(
 	return p.rdb.Expire(ctx, key, ttl*2).Err()
 }
 
-// GetOnlineParticipants returns users who have checked in within the last 'ttl' duration.
+// RemoveOnlineStatus removes a single connection from the conversation's ZSet.
+func (p *RedisPresenceStore) RemoveOnlineStatus(ctx context.Context, convID, senderID, connID string) error {
+	return p.rdb.ZRem(ctx, "presence:"+convID, presenceMember(senderID, connID)).Err()
+}
+
+// GetOnlineParticipants returns users with a connection that checked in within the last 'ttl' duration.
 func (p *RedisPresenceStore) GetOnlineParticipants(
 	ctx context.Context,
 	convID string,
@@ -67,8 +84,21 @@ func (p *RedisPresenceStore) GetOnlineParticipants(
 	// Remove stale members first (Self-cleaning)
 	p.rdb.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(threshold, 10))
 
-	// Get all members remaining in the set
-	return p.rdb.ZRange(ctx, key, 0, -1).Result()
+	// Get all members remaining in the set, one per sender
+	members, err := p.rdb.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{}, len(members))
+	senders := make([]string, 0, len(members))
+	for _, m := range members {
+		senderID, _, _ := strings.Cut(m, "/")
+		if _, ok := seen[senderID]; !ok {
+			seen[senderID] = struct{}{}
+			senders = append(senders, senderID)
+		}
+	}
+	return senders, nil
 }
 
 // ClearConversation deletes the entire ZSet for the conversation.
@@ -76,3 +106,14 @@ func (p *RedisPresenceStore) ClearConversation(ctx context.Context, convID strin
 	key := "presence:" + convID
 	return p.rdb.Del(ctx, key).Err()
 }
+
+// ListConversations scans the presence keys; SCAN keeps Redis responsive
+// where KEYS would block it.
+func (p *RedisPresenceStore) ListConversations(ctx context.Context) ([]string, error) {
+	var convIDs []string
+	iter := p.rdb.Scan(ctx, 0, "presence:*", 100).Iterator()
+	for iter.Next(ctx) {
+		convIDs = append(convIDs, strings.TrimPrefix(iter.Val(), "presence:"))
+	}
+	return convIDs, iter.Err()
+}
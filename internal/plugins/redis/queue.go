@@ -2,113 +2,542 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
+	"livon/internal/platform/logger"
+	"livon/internal/platform/metrics"
+	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 type RedisMessageQueue struct {
 	rdb *redis.Client
+	log *slog.Logger
+	cfg config.WorkerConfig
 }
 
-func NewRedisMessageQueue(rdb *redis.Client) *RedisMessageQueue {
-	return &RedisMessageQueue{rdb: rdb}
+func NewRedisMessageQueue(log *slog.Logger, rdb *redis.Client, cfg config.WorkerConfig) *RedisMessageQueue {
+	return &RedisMessageQueue{rdb: rdb, log: log, cfg: cfg}
 }
 
 /*
 	type MessageQueue interface {
 		// Producer side (Ingest Service)
-		PublishToStream(ctx context.Context, topic, payload []byte) error
+		// PublishToStream appends payload to topic. key names the conversation the
+		// entry belongs to, since many conversations share a topic.
+		PublishToStream(ctx context.Context, topic string, key string, payload []byte) error
 		// Consumer side (Worker Service)
-		// SubscribeToStream handles the reliable reading from the Redis Stream
-		SubscribeToStream(ctx context.Context, topic string, conGroup string, handler func(ctx context.Context, messageID string, data []byte) error) error
-		// AcknowledgeMessage acknowledges redis stream that message is picked for processing
-		AcknowledgeMessage(ctx context.Context, convID, conGroup, mesgID string) error
-		// DeleteStream removes the message stream from redis
-		DeleteStream(ctx context.Context, convID string) error
-		// Deletes Message from redis stream
-		DeleteMessage(ctx context.Context, convID, mesgID string) error
+		// ConsumeStreams reads the topics returned by topics in batches of up to
+		// batchSize entries per topic, handed to handler in stream order. topics is
+		// called again before every read, so topics can be added and dropped while
+		// it runs. A newly added topic first takes over the entries still pending
+		// for conGroup, which its previous reader did not finish. Entries stay
+		// pending until acknowledged.
+		ConsumeStreams(ctx context.Context, conGroup string, batchSize int, topics func() []string, handler func(ctx context.Context, topic string, entries []StreamEntry) error) error
+		// AcknowledgeMessage acknowledges redis stream that messages are processed
+		AcknowledgeMessage(ctx context.Context, topic, conGroup string, mesgIDs ...string) error
+		// PurgeKey removes every entry published under key from topic, its pending entries and its dead letters
+		PurgeKey(ctx context.Context, topic, conGroup, key string) error
+		// Deletes Messages from redis stream
+		DeleteMessage(ctx context.Context, topic string, mesgIDs ...string) error
+		// Backlog reports the stream length, lag and pending entries for a consumer group
+		Backlog(ctx context.Context, topic, conGroup string) (StreamBacklog, error)
+		// PendingEntries lists up to count entries delivered to conGroup but not acknowledged
+		PendingEntries(ctx context.Context, topic, conGroup string, count int64) ([]PendingEntry, error)
+		// DeadLetters counts the entries published under key that were set aside after exhausting their deliveries
+		DeadLetters(ctx context.Context, topic, key string) (int64, error)
+		// ReplayDeadLetters moves the dead-lettered entries published under key back onto the stream
+		ReplayDeadLetters(ctx context.Context, topic, key string) (int, error)
 	}
 */
 
-func (q *RedisMessageQueue) streamKey(convID string) string {
-	return "stream:" + convID
+type handlerFunc = func(ctx context.Context, topic string, entries []contracts.StreamEntry) error
+
+// errPendingElsewhere reports that another consumer still holds pending
+// entries of a topic being taken over.
+var errPendingElsewhere = errors.New("entries pending with another consumer")
+
+func (q *RedisMessageQueue) streamKey(topic string) string {
+	return "stream:" + topic
+}
+
+func (q *RedisMessageQueue) deadLetterKey(topic string) string {
+	return "deadletter:" + topic
 }
 
-func (q *RedisMessageQueue) PublishToStream(ctx context.Context, convID string, payload []byte) error {
+func (q *RedisMessageQueue) PublishToStream(ctx context.Context, topic string, key string, payload []byte) error {
+	values := map[string]interface{}{"data": payload, "key": key}
+	// Carry the W3C trace context (traceparent, tracestate) next to the payload
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	for k, v := range carrier {
+		values[k] = v
+	}
+	// No MAXLEN: a partition is shared by many conversations, and trimming by
+	// length would drop entries nobody has persisted yet. trim removes the
+	// acknowledged ones instead.
 	return q.rdb.XAdd(ctx, &redis.XAddArgs{
-		Stream: q.streamKey(convID),
-		MaxLen: 1000,
-		Approx: true,
+		Stream: q.streamKey(topic),
 		ID:     "*",
-		Values: map[string]interface{}{"data": payload},
+		Values: values,
 	}).Err()
 }
 
-func (q *RedisMessageQueue) SubscribeToStream(
+func (q *RedisMessageQueue) ConsumeStreams(
 	ctx context.Context,
-	convID string,
 	conGroup string,
-	handler func(ctx context.Context, messageID string, data []byte) error,
+	batchSize int,
+	topics func() []string,
+	handler handlerFunc,
 ) error {
-	topic := q.streamKey(convID)
-	// Create group if not exists
-	err := q.rdb.XGroupCreateMkStream(ctx, topic, conGroup, "0").Err()
-	if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
-		return fmt.Errorf("failed to create consumer group: %w", err)
-	}
 	consumerName := uuid.NewString()
-	// Run in a goroutine
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				// Read new messages (">")
-				res, err := q.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
-					Group:    conGroup,
-					Consumer: consumerName,
-					Streams:  []string{topic, ">"},
-					Count:    1,
-					Block:    2 * time.Second,
-				}).Result()
-				if err != nil {
-					if err != redis.Nil {
-						log.Printf("Stream read error: %v", err)
+	// Entries are finished even if ctx is cancelled while they are being handled
+	handlerCtx := context.WithoutCancel(ctx)
+	// Topics read in the previous pass; anything else is new to this consumer
+	reading := make(map[string]bool)
+	lastReclaim := time.Now()
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		ready := make([]string, 0, len(reading))
+		next := make(map[string]bool, len(reading))
+		for _, topic := range topics() {
+			if !reading[topic] {
+				if err := q.takeOver(ctx, handlerCtx, topic, conGroup, consumerName, batchSize, handler); err != nil {
+					if errors.Is(err, errPendingElsewhere) {
+						q.log.DebugContext(ctx, "redis queue - consume - waiting for pending entries", slog.String("topic", topic))
+					} else if ctx.Err() == nil {
+						q.log.ErrorContext(ctx, "redis queue - consume - take over failed", slog.String("topic", topic), logger.Err(err))
 					}
 					continue
 				}
-				for _, stream := range res {
-					for _, msg := range stream.Messages {
-						raw, ok := msg.Values["data"].(string)
-						if !ok {
-							continue
-						}
-						if err := handler(ctx, msg.ID, []byte(raw)); err != nil {
-							log.Printf("Handler error for message %s: %v", msg.ID, err)
-						}
-					}
+			}
+			next[topic] = true
+			ready = append(ready, topic)
+		}
+		reading = next
+		if len(ready) == 0 {
+			// Nothing owned yet; wait for the next assignment
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		if q.cfg.ClaimIdle > 0 && time.Since(lastReclaim) >= q.cfg.ClaimIdle {
+			for _, topic := range ready {
+				q.reclaim(ctx, handlerCtx, topic, conGroup, consumerName, batchSize, handler)
+				q.trim(ctx, topic)
+			}
+			lastReclaim = time.Now()
+		}
+		// One blocking read covers every topic: keys first, then one ">" per key
+		streams := make([]string, 0, 2*len(ready))
+		for _, topic := range ready {
+			streams = append(streams, q.streamKey(topic))
+		}
+		for range ready {
+			streams = append(streams, ">")
+		}
+		res, err := q.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    conGroup,
+			Consumer: consumerName,
+			Streams:  streams,
+			Count:    int64(batchSize),
+			Block:    2 * time.Second,
+		}).Result()
+		if err != nil {
+			if err != redis.Nil && ctx.Err() == nil {
+				q.log.ErrorContext(ctx, "redis queue - consume - stream read failed", logger.Err(err))
+				// Back off so a purged stream or a Redis outage doesn't spin
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+				// Recreate groups of streams that were deleted meanwhile
+				reading = make(map[string]bool)
+			}
+			continue
+		}
+		for _, stream := range res {
+			q.handle(handlerCtx, strings.TrimPrefix(stream.Stream, "stream:"), stream.Messages, handler)
+		}
+	}
+}
+
+// takeOver prepares topic for reading: it creates the consumer group if
+// needed and handles every entry still pending in it, whoever it was
+// delivered to. The previous owner may still be finishing a read it started
+// before losing the partition, so entries are only taken once idle for
+// ClaimIdle. Until none is left with another consumer it returns
+// errPendingElsewhere and the topic stays unread, so nothing newer is
+// persisted ahead of them.
+func (q *RedisMessageQueue) takeOver(
+	ctx, handlerCtx context.Context,
+	topic, conGroup, consumer string,
+	batchSize int,
+	handler handlerFunc,
+) error {
+	stream := q.streamKey(topic)
+	err := q.rdb.XGroupCreateMkStream(ctx, stream, conGroup, "0").Err()
+	if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+	start := "0-0"
+	for {
+		msgs, next, err := q.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    conGroup,
+			Consumer: consumer,
+			MinIdle:  q.cfg.ClaimIdle,
+			Start:    start,
+			Count:    int64(batchSize),
+		}).Result()
+		if err != nil {
+			return err
+		}
+		q.handle(handlerCtx, topic, msgs, handler)
+		if next == "0-0" || next == "" {
+			break
+		}
+		start = next
+	}
+	consumers, err := q.rdb.XInfoConsumers(ctx, stream, conGroup).Result()
+	if err != nil {
+		return err
+	}
+	for _, c := range consumers {
+		if c.Name != consumer && c.Pending > 0 {
+			return errPendingElsewhere
+		}
+	}
+	return nil
+}
+
+// handle passes a batch of entries to handler. Entries it does not
+// acknowledge stay pending and are retried by reclaim.
+func (q *RedisMessageQueue) handle(
+	ctx context.Context,
+	topic string,
+	msgs []redis.XMessage,
+	handler handlerFunc,
+) {
+	entries := make([]contracts.StreamEntry, 0, len(msgs))
+	for _, msg := range msgs {
+		raw, ok := msg.Values["data"].(string)
+		if !ok {
+			q.log.WarnContext(ctx, "redis queue - handle - entry without data", slog.String("topic", topic), slog.String("message_id", msg.ID))
+			continue
+		}
+		e := contracts.StreamEntry{ID: msg.ID, Data: []byte(raw), Headers: make(map[string]string)}
+		e.Key, _ = msg.Values["key"].(string)
+		for k, v := range msg.Values {
+			if s, ok := v.(string); ok && k != "data" && k != "key" {
+				e.Headers[k] = s
+			}
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		return
+	}
+	if err := handler(ctx, topic, entries); err != nil {
+		q.log.ErrorContext(ctx, "redis queue - handle - handler failed", slog.String("topic", topic), slog.Int("entries", len(entries)), logger.Err(err))
+	}
+}
+
+// reclaim retries entries left pending by a failed handler, and dead-letters
+// the ones already delivered MaxDeliveries times.
+func (q *RedisMessageQueue) reclaim(
+	ctx, handlerCtx context.Context,
+	topic, conGroup, consumer string,
+	batchSize int,
+	handler handlerFunc,
+) {
+	stream := q.streamKey(topic)
+	pending, err := q.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  conGroup,
+		Idle:   q.cfg.ClaimIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  int64(batchSize),
+	}).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			q.log.ErrorContext(ctx, "redis queue - reclaim - pending lookup failed", slog.String("topic", topic), logger.Err(err))
+		}
+		return
+	}
+	retry := make([]string, 0, len(pending))
+	for _, p := range pending {
+		if q.cfg.MaxDeliveries > 0 && p.RetryCount >= q.cfg.MaxDeliveries {
+			if err := q.deadLetter(ctx, topic, conGroup, p.ID, p.RetryCount); err != nil {
+				q.log.ErrorContext(ctx, "redis queue - reclaim - dead letter failed", slog.String("topic", topic), slog.String("message_id", p.ID), logger.Err(err))
+			}
+			continue
+		}
+		retry = append(retry, p.ID)
+	}
+	if len(retry) == 0 {
+		return
+	}
+	// MinIdle makes the claim atomic: only one consumer wins each entry
+	msgs, err := q.rdb.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    conGroup,
+		Consumer: consumer,
+		MinIdle:  q.cfg.ClaimIdle,
+		Messages: retry,
+	}).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			q.log.ErrorContext(ctx, "redis queue - reclaim - claim failed", slog.String("topic", topic), logger.Err(err))
+		}
+		return
+	}
+	q.handle(handlerCtx, topic, msgs, handler)
+}
+
+// trim drops the entries every group has acknowledged: those before the
+// oldest pending entry, or before the last delivered one when nothing is
+// pending. The worker deletes entries once persisted, so this only catches
+// those whose delete failed; undelivered and pending entries are never
+// trimmed. A growing backlog shows up as livon_stream_lag instead.
+func (q *RedisMessageQueue) trim(ctx context.Context, topic string) {
+	stream := q.streamKey(topic)
+	groups, err := q.rdb.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			q.log.WarnContext(ctx, "redis queue - trim - group lookup failed", slog.String("topic", topic), logger.Err(err))
+		}
+		return
+	}
+	minID := ""
+	for _, g := range groups {
+		floor := g.LastDeliveredID
+		if g.Pending > 0 {
+			p, err := q.rdb.XPending(ctx, stream, g.Name).Result()
+			if err != nil {
+				if ctx.Err() == nil {
+					q.log.WarnContext(ctx, "redis queue - trim - pending lookup failed", slog.String("topic", topic), logger.Err(err))
 				}
+				return
 			}
+			floor = p.Lower
 		}
-	}()
+		if minID == "" || streamIDLess(floor, minID) {
+			minID = floor
+		}
+	}
+	if minID == "" || minID == "0-0" {
+		return
+	}
+	if err := q.rdb.XTrimMinIDApprox(ctx, stream, minID, 0).Err(); err != nil && ctx.Err() == nil {
+		q.log.WarnContext(ctx, "redis queue - trim - trim failed", slog.String("topic", topic), logger.Err(err))
+	}
+}
+
+// streamIDLess orders stream ids ("<ms>-<seq>").
+func streamIDLess(a, b string) bool {
+	aMs, aSeq, _ := strings.Cut(a, "-")
+	bMs, bSeq, _ := strings.Cut(b, "-")
+	am, _ := strconv.ParseUint(aMs, 10, 64)
+	bm, _ := strconv.ParseUint(bMs, 10, 64)
+	if am != bm {
+		return am < bm
+	}
+	as, _ := strconv.ParseUint(aSeq, 10, 64)
+	bs, _ := strconv.ParseUint(bSeq, 10, 64)
+	return as < bs
+}
+
+// deadLetter copies an entry to the topic's dead-letter stream and
+// removes it from the consumer group.
+func (q *RedisMessageQueue) deadLetter(ctx context.Context, topic, conGroup, id string, deliveries int64) error {
+	stream := q.streamKey(topic)
+	entries, err := q.rdb.XRange(ctx, stream, id, id).Result()
+	if err != nil {
+		return err
+	}
+	var key string
+	_, err = q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		// An entry deleted meanwhile has nothing left to keep; it is only acknowledged
+		if len(entries) == 1 {
+			values := entries[0].Values
+			key, _ = values["key"].(string)
+			values["deliveries"] = deliveries
+			values["original_id"] = id
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: q.deadLetterKey(topic),
+				MaxLen: 1000,
+				Approx: true,
+				ID:     "*",
+				Values: values,
+			})
+		}
+		pipe.XAck(ctx, stream, conGroup, id)
+		pipe.XDel(ctx, stream, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	metrics.StreamDeadLettered.Add(ctx, 1)
+	q.log.WarnContext(ctx, "redis queue - dead letter - entry set aside", slog.String("topic", topic), logger.Conversation(key), slog.String("message_id", id), slog.Int64("deliveries", deliveries))
 	return nil
 }
 
-func (q *RedisMessageQueue) AcknowledgeMessage(ctx context.Context, convID, conGroup, mesgID string) error {
-	return q.rdb.XAck(ctx, q.streamKey(convID), conGroup, mesgID).Err()
+func (q *RedisMessageQueue) AcknowledgeMessage(ctx context.Context, topic, conGroup string, mesgIDs ...string) error {
+	if len(mesgIDs) == 0 {
+		return nil
+	}
+	return q.rdb.XAck(ctx, q.streamKey(topic), conGroup, mesgIDs...).Err()
+}
+
+func (q *RedisMessageQueue) DeleteMessage(ctx context.Context, topic string, mesgIDs ...string) error {
+	if len(mesgIDs) == 0 {
+		return nil
+	}
+	return q.rdb.XDel(ctx, q.streamKey(topic), mesgIDs...).Err()
+}
+
+func (q *RedisMessageQueue) Backlog(ctx context.Context, topic, conGroup string) (contracts.StreamBacklog, error) {
+	var b contracts.StreamBacklog
+	stream := q.streamKey(topic)
+	length, err := q.rdb.XLen(ctx, stream).Result()
+	if err != nil {
+		return b, err
+	}
+	b.Length = length
+	groups, err := q.rdb.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		// Stream not created yet
+		if strings.Contains(err.Error(), "no such key") {
+			return b, nil
+		}
+		return b, err
+	}
+	for _, g := range groups {
+		if g.Name == conGroup {
+			b.Lag = g.Lag
+			b.Pending = g.Pending
+			break
+		}
+	}
+	return b, nil
 }
 
-func (q *RedisMessageQueue) DeleteMessage(ctx context.Context, convID, mesgID string) error {
-	return q.rdb.XDel(ctx, q.streamKey(convID), mesgID).Err()
+func (q *RedisMessageQueue) PendingEntries(ctx context.Context, topic, conGroup string, count int64) ([]contracts.PendingEntry, error) {
+	pending, err := q.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: q.streamKey(topic),
+		Group:  conGroup,
+		Start:  "-",
+		End:    "+",
+		Count:  count,
+	}).Result()
+	if err != nil {
+		// Stream or group not created yet
+		if strings.Contains(err.Error(), "NOGROUP") || strings.Contains(err.Error(), "no such key") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	entries := make([]contracts.PendingEntry, 0, len(pending))
+	for _, p := range pending {
+		entries = append(entries, contracts.PendingEntry{
+			ID:         p.ID,
+			Consumer:   p.Consumer,
+			IdleMs:     p.Idle.Milliseconds(),
+			Deliveries: p.RetryCount,
+		})
+	}
+	return entries, nil
 }
 
-func (q *RedisMessageQueue) DeleteStream(ctx context.Context, convID string) error {
-	return q.rdb.Del(ctx, q.streamKey(convID)).Err()
+// keyed returns the entries of stream published under key. Persisted entries
+// are deleted, so a stream holds little more than its backlog and a full
+// range stays cheap.
+func (q *RedisMessageQueue) keyed(ctx context.Context, stream, key string) ([]redis.XMessage, error) {
+	entries, err := q.rdb.XRange(ctx, stream, "-", "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	out := entries[:0]
+	for _, e := range entries {
+		if k, _ := e.Values["key"].(string); k == key {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (q *RedisMessageQueue) DeadLetters(ctx context.Context, topic, key string) (int64, error) {
+	entries, err := q.keyed(ctx, q.deadLetterKey(topic), key)
+	return int64(len(entries)), err
+}
+
+func (q *RedisMessageQueue) ReplayDeadLetters(ctx context.Context, topic, key string) (int, error) {
+	dlq := q.deadLetterKey(topic)
+	entries, err := q.keyed(ctx, dlq, key)
+	if err != nil {
+		return 0, err
+	}
+	replayed := 0
+	for _, e := range entries {
+		values := e.Values
+		delete(values, "deliveries")
+		delete(values, "original_id")
+		if _, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: q.streamKey(topic),
+				ID:     "*",
+				Values: values,
+			})
+			pipe.XDel(ctx, dlq, e.ID)
+			return nil
+		}); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+func (q *RedisMessageQueue) PurgeKey(ctx context.Context, topic, conGroup, key string) error {
+	stream := q.streamKey(topic)
+	entries, err := q.keyed(ctx, stream, key)
+	if err != nil {
+		return err
+	}
+	dead, err := q.keyed(ctx, q.deadLetterKey(topic), key)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 && len(dead) == 0 {
+		return nil
+	}
+	_, err = q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, e := range entries {
+			pipe.XAck(ctx, stream, conGroup, e.ID)
+			pipe.XDel(ctx, stream, e.ID)
+		}
+		for _, e := range dead {
+			pipe.XDel(ctx, q.deadLetterKey(topic), e.ID)
+		}
+		return nil
+	})
+	return err
 }
 
 /*
@@ -0,0 +1,38 @@
+package redis
+
+import (
+	"context"
+	"livon/internal/config"
+	"livon/internal/core/contracts"
+	"livon/internal/plugins/queuetest"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestRedisMessageQueue needs a Redis server at REDIS_URL; it is skipped
+// when none is set or reachable.
+func TestRedisMessageQueue(t *testing.T) {
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		t.Skip("REDIS_URL not set")
+	}
+	ctx := context.Background()
+	rdb, err := NewRedisClient(ctx, config.RedisConfig{
+		URL:         url,
+		DialTimeout: 2 * time.Second,
+		PingTimeout: 2 * time.Second,
+	})
+	if err != nil {
+		t.Skipf("redis at %s unreachable: %v", url, err)
+	}
+	defer rdb.Close()
+	log := slog.New(slog.DiscardHandler)
+	err = queuetest.TestQueue(ctx, func(cfg config.WorkerConfig) contracts.MessageQueue {
+		return NewRedisMessageQueue(log, rdb, cfg)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"livon/internal/core/domain"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type RedisResumeStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisResumeStore(rdb *redis.Client) *RedisResumeStore {
+	return &RedisResumeStore{rdb: rdb}
+}
+
+/*
+	type ResumeStore interface {
+		// Save stores or replaces the state behind token for ttl.
+		Save(ctx context.Context, token string, state domain.ResumeState, ttl time.Duration) error
+		// Take returns the state behind token and deletes it, so a token is used at
+		// most once. Unknown or expired tokens give domain.ErrResumeInvalid.
+		Take(ctx context.Context, token string) (*domain.ResumeState, error)
+	}
+*/
+
+func (s *RedisResumeStore) Save(ctx context.Context, token string, state domain.ResumeState, ttl time.Duration) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, "resume:"+token, data, ttl).Err()
+}
+
+func (s *RedisResumeStore) Take(ctx context.Context, token string) (*domain.ResumeState, error) {
+	data, err := s.rdb.GetDel(ctx, "resume:"+token).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, domain.ErrResumeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state domain.ResumeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, domain.ErrResumeInvalid
+	}
+	return &state, nil
+}
@@ -0,0 +1,3 @@
+-- Conversation type selects per-type policies (e.g. rate limits)
+ALTER TABLE conversations
+ADD COLUMN type TEXT NOT NULL DEFAULT 'group';
@@ -0,0 +1,2 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS edited_at;
+ALTER TABLE conversation_participants DROP COLUMN IF EXISTS role;
@@ -0,0 +1,8 @@
+-- Per-participant role; the participant that creates a conversation is its owner
+ALTER TABLE conversation_participants
+ADD COLUMN role TEXT NOT NULL DEFAULT 'member'
+CHECK (role IN ('owner', 'moderator', 'member', 'read_only'));
+
+-- Edits keep the original seq and record when the payload changed
+ALTER TABLE messages
+ADD COLUMN edited_at TIMESTAMPTZ;
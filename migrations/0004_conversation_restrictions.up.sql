@@ -0,0 +1,12 @@
+-- Bans and mutes are held against the hidden user_id so a fresh sender_id cannot bypass them
+CREATE TABLE conversation_restrictions (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id         TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind            TEXT NOT NULL CHECK (kind IN ('ban', 'mute')),
+    created_by      UUID NOT NULL, -- sender_id of the moderator
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at      TIMESTAMPTZ, -- NULL never expires
+
+    PRIMARY KEY (conversation_id, user_id, kind),
+    CONSTRAINT mute_expires CHECK (kind <> 'mute' OR expires_at IS NOT NULL)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS conversation_invites;
+DROP TABLE IF EXISTS conversation_members;
+ALTER TABLE conversations DROP COLUMN IF EXISTS visibility;
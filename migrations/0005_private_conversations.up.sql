@@ -0,0 +1,26 @@
+-- Private conversations admit only members and holders of a valid invite
+ALTER TABLE conversations
+ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public'
+CHECK (visibility IN ('public', 'private'));
+
+-- Explicit membership, held against the hidden user_id rather than a sender_id
+CREATE TABLE conversation_members (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id         TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    added_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (conversation_id, user_id)
+);
+
+CREATE TABLE conversation_invites (
+    id              UUID PRIMARY KEY,
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    created_by      UUID NOT NULL, -- sender_id of the inviter
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at      TIMESTAMPTZ NOT NULL,
+    single_use      BOOLEAN NOT NULL DEFAULT false,
+    used_at         TIMESTAMPTZ,
+    revoked_at      TIMESTAMPTZ
+);
+
+CREATE INDEX idx_invites_conversation ON conversation_invites (conversation_id);
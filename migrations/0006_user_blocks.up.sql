@@ -0,0 +1,13 @@
+-- Blocks relate hidden user_ids so they follow the blocked user into new
+-- identities and conversations. Each row remembers the sender_id it was placed
+-- through; unblocking that sender_id removes only that row.
+CREATE TABLE user_blocks (
+    blocker_id  TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id  TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    via_sender  UUID NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (blocker_id, via_sender)
+);
+
+CREATE INDEX idx_user_blocks_blocker ON user_blocks (blocker_id, blocked_id);
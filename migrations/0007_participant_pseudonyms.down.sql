@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS uniq_participant_display_name;
+ALTER TABLE conversation_participants DROP COLUMN IF EXISTS avatar_seed;
+ALTER TABLE conversation_participants DROP COLUMN IF EXISTS display_name;
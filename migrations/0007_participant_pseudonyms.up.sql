@@ -0,0 +1,18 @@
+-- Pseudonymous display name and avatar seed per participant (per sender_id)
+ALTER TABLE conversation_participants
+ADD COLUMN display_name TEXT,
+ADD COLUMN avatar_seed  TEXT;
+
+UPDATE conversation_participants
+SET display_name = 'guest-' || left(id::text, 8),
+    avatar_seed  = left(md5(id::text), 16)
+WHERE display_name IS NULL;
+
+ALTER TABLE conversation_participants
+ALTER COLUMN display_name SET NOT NULL,
+ALTER COLUMN avatar_seed SET NOT NULL;
+
+-- Names stay unique within a conversation, including for identities that left,
+-- so history never shows two senders under one name
+CREATE UNIQUE INDEX uniq_participant_display_name
+ON conversation_participants (conversation_id, lower(display_name));
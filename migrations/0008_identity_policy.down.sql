@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS uniq_active_participant;
+ALTER TABLE conversation_participants
+ADD CONSTRAINT unique_active_participant UNIQUE (user_id, conversation_id, left_at);
+ALTER TABLE conversations DROP COLUMN IF EXISTS resume_window_sec;
+ALTER TABLE conversations DROP COLUMN IF EXISTS identity_policy;
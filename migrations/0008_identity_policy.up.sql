@@ -0,0 +1,25 @@
+-- How returning users get their sender_id back; a NULL window uses the server default
+ALTER TABLE conversations
+ADD COLUMN identity_policy TEXT NOT NULL DEFAULT 'resume'
+CHECK (identity_policy IN ('resume', 'sticky', 'always_new')),
+ADD COLUMN resume_window_sec INTEGER CHECK (resume_window_sec > 0);
+
+-- NULLs compare distinct, so this never stopped a second active identity
+ALTER TABLE conversation_participants DROP CONSTRAINT IF EXISTS unique_active_participant;
+
+-- Keep only the most recently seen active identity per user before enforcing it
+UPDATE conversation_participants p
+SET left_at = now()
+WHERE p.left_at IS NULL
+  AND EXISTS (
+    SELECT 1 FROM conversation_participants q
+    WHERE q.user_id = p.user_id
+      AND q.conversation_id = p.conversation_id
+      AND q.left_at IS NULL
+      AND (q.last_seen_at, q.id) > (p.last_seen_at, p.id)
+  );
+
+-- At most one active identity per user and conversation
+CREATE UNIQUE INDEX uniq_active_participant
+ON conversation_participants (user_id, conversation_id)
+WHERE left_at IS NULL;
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS bus_messages;
+DROP TABLE IF EXISTS lease_members;
+DROP TABLE IF EXISTS leases;
+DROP TABLE IF EXISTS resume_tokens;
+DROP TABLE IF EXISTS presence;
+DROP TABLE IF EXISTS queue_dead_letters;
+DROP TABLE IF EXISTS queue_deliveries;
+DROP TABLE IF EXISTS queue_entries;
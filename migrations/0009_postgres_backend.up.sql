@@ -0,0 +1,90 @@
+-- Shared state for STATE_BACKEND=postgres and QUEUE_BACKEND=postgres, so a
+-- deployment can run with Postgres as its only dependency
+
+-- Ingestion stream entries; topic is the partition, key the conversation
+CREATE TABLE queue_entries (
+    id          BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    topic       TEXT NOT NULL,
+    key         TEXT NOT NULL,
+    data        BYTEA NOT NULL,
+    headers     JSONB NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_queue_entries_topic ON queue_entries (topic, id);
+CREATE INDEX idx_queue_entries_key ON queue_entries (topic, key);
+
+-- One row per entry handed to a consumer group; an entry without one has not
+-- been delivered yet
+CREATE TABLE queue_deliveries (
+    group_name    TEXT NOT NULL,
+    entry_id      BIGINT NOT NULL REFERENCES queue_entries(id) ON DELETE CASCADE,
+    consumer      TEXT NOT NULL,
+    delivered_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    deliveries    INTEGER NOT NULL DEFAULT 1,
+    acked         BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (group_name, entry_id)
+);
+
+CREATE INDEX idx_queue_deliveries_entry ON queue_deliveries (entry_id);
+
+-- Entries set aside after exhausting their deliveries
+CREATE TABLE queue_dead_letters (
+    id           BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    topic        TEXT NOT NULL,
+    key          TEXT NOT NULL,
+    data         BYTEA NOT NULL,
+    headers      JSONB NOT NULL DEFAULT '{}',
+    deliveries   INTEGER NOT NULL,
+    original_id  BIGINT NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_queue_dead_letters_key ON queue_dead_letters (topic, key, id);
+
+-- Presence is rebuilt by heartbeats within seconds of a restart, so it skips
+-- the WAL; an unlogged table is emptied after a crash
+CREATE UNLOGGED TABLE presence (
+    conversation_id  TEXT NOT NULL,
+    sender_id        TEXT NOT NULL,
+    connection_id    TEXT NOT NULL,
+    seen_at          TIMESTAMPTZ NOT NULL,
+    expires_at       TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (conversation_id, sender_id, connection_id)
+);
+
+CREATE INDEX idx_presence_expires ON presence (expires_at);
+
+-- Losing resume tokens only costs clients a full reconnect
+CREATE UNLOGGED TABLE resume_tokens (
+    token       TEXT PRIMARY KEY,
+    state       JSONB NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_resume_tokens_expires ON resume_tokens (expires_at);
+
+-- Partition leases stay logged: after a crash no node may believe it still
+-- owns a partition another node has taken
+CREATE TABLE leases (
+    key         TEXT PRIMARY KEY,
+    owner       TEXT NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE lease_members (
+    group_name  TEXT NOT NULL,
+    member      TEXT NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (group_name, member)
+);
+
+-- Cluster bus payloads too large for a NOTIFY; subscribers read them by id
+CREATE UNLOGGED TABLE bus_messages (
+    id          BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    channel     TEXT NOT NULL,
+    payload     BYTEA NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_bus_messages_created ON bus_messages (created_at);
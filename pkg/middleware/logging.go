@@ -1,16 +1,11 @@
 package middleware
 
 import (
-	"context"
+	"livon/internal/platform/logger"
 	"log/slog"
 	"net/http"
 )
 
-// type for context keys
-type loggerKeyType struct{}
-
-var LoggerKey = loggerKeyType{}
-
 // RequestLogger creates a middleware that logs requests and injects the logger.
 func RequestLogger(log *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -24,10 +19,10 @@ func RequestLogger(log *slog.Logger) func(http.Handler) http.Handler {
 			)
 
 			// inject this new logger into the context
-			ctx := context.WithValue(r.Context(), LoggerKey, reqLog)
+			ctx := logger.NewContext(r.Context(), reqLog)
 
 			// log the incoming request
-			reqLog.Info("request started")
+			reqLog.InfoContext(ctx, "request started")
 
 			// call the next handler with the NEW context
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"livon/internal/platform/metrics"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// MetricsMiddleware records http.server.request.duration with the labels the
+// golden-signals dashboard queries (service_name, method, route, code).
+// route is the ServeMux pattern the request matched, such as
+// /conversations/{id}/invites, never the raw path, so ids do not become labels.
+func MetricsMiddleware(app string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(wrapped, r)
+			metrics.HTTPServerDuration.Record(r.Context(), time.Since(start).Seconds(), metric.WithAttributes(
+				attribute.String("service_name", app),
+				attribute.String("method", r.Method),
+				attribute.String("route", route(r)),
+				attribute.String("code", strconv.Itoa(wrapped.statusCode)),
+			))
+		})
+	}
+}
+
+// route returns the path of the pattern that matched r, without its method.
+func route(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unmatched"
+	}
+	if _, path, ok := strings.Cut(r.Pattern, " "); ok {
+		return path
+	}
+	return r.Pattern
+}